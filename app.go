@@ -2,89 +2,480 @@ package synth
 
 import (
 	"context"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"maps"
 	"os"
+	"runtime"
+	"sync"
+	"time"
 
 	"github.com/environment-toolkit/go-synth/auth"
-	"github.com/environment-toolkit/go-synth/executors"
 	"github.com/environment-toolkit/go-synth/models"
+	"github.com/environment-toolkit/go-synth/redact"
+	"github.com/environment-toolkit/go-synth/tfjson"
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
 )
 
 // App defines the interface for managing the synthesis process.
+//
+// An App is safe for concurrent use: Eval may be called from multiple
+// goroutines, and Configure may be called while Evals are running, in which
+// case the running Evals keep the previous configuration.
+//
+// Hooks, the ExecutorPool and the output sink are shared by concurrent Evals
+// and must be safe for concurrent use.
 type App interface {
 	// Configure is a one time set up for the App environment reused by each Eval call.
 	//
 	// Configure is meant to handle Auth configuration and other setup that is shared across multiple Eval calls.
+	//
+	// The config is validated first, reporting all problems at once.
 	Configure(ctx context.Context, config models.AppConfig) error
 	// Eval runs the provided main.ts script in the App environment.
 	//
 	// Once the script has run, the contents of the src directory are
 	// copied to the dest directory into the provided fs.
 	//
-	// Each call to Eval is independent.
+	// Each call to Eval is independent, the Hooks set with WithHooks are
+	// called around the setup, exec and copy phases.
+	//
+	// Secret values (registry tokens and AppConfig.SecretEnvVars) are
+	// redacted from the executor logs and the returned error.
 	Eval(ctx context.Context, fs afero.Fs, mainTs, src, dest string) error
+	// EvalArchive runs the provided main.ts script like Eval, and streams the
+	// contents of the src directory to w as a format archive.
+	//
+	// The same synthesized files give a byte-identical archive.
+	EvalArchive(ctx context.Context, w io.Writer, format models.ArchiveFormat, mainTs, src string) error
+	// Run runs a single request like Eval or EvalArchive and returns its
+	// result: the redacted error, the files handled by the copy phase, e.g.
+	// the files deleted in CopySync mode, and the validation Diagnostics.
+	Run(ctx context.Context, req EvalRequest) EvalResult
+	// EvalMany runs the requests with at most workers concurrent Eval calls.
+	//
+	// The results are in the order of the requests and each request succeeds
+	// or fails independently. workers <= 0 uses runtime.GOMAXPROCS(0).
+	EvalMany(ctx context.Context, requests []EvalRequest, workers int) []EvalResult
+	// Prepare runs Setup once and returns a Session running many scripts with
+	// the installed dependencies.
+	//
+	// The Executor must implement models.WorkspaceExecutor, the Session must be closed.
+	Prepare(ctx context.Context) (Session, error)
+	// EvalBatch runs the requests in a single Session, sharing one dependency install.
+	//
+	// The returned error is set when the Session can not be prepared or closed,
+	// each request succeeds or fails independently.
+	EvalBatch(ctx context.Context, requests []EvalRequest, workers int) ([]EvalResult, error)
 }
 
 type app struct {
-	config        models.AppConfig
 	newExecutorFn models.NewExecutorFn
 	authProvider  auth.Provider
-	envVars       map[string]string
+	optionKeys    []string
+	pool          ExecutorPool
+	tempDir       string
+	output        io.Writer
+	hooks         multiHooks
+	now           func() time.Time
+	manifestKey   ed25519.PrivateKey
+	validate      bool
 	logger        *zap.Logger
+
+	mu  sync.RWMutex
+	env *environment
+
+	// probeKeys reads the option keys of an Executor once, unless set with WithExecutorOptionKeys.
+	probeKeys    sync.Once
+	probedKeys   []string
+	probeKeysErr error
+}
+
+// environment is the state set by Configure and shared by the Eval calls.
+//
+// It is replaced as a whole by Configure and never modified, so Eval calls
+// already running keep using the environment they started with.
+type environment struct {
+	config     models.AppConfig
+	installEnv map[string]string
+	execEnv    map[string]string
+	redactor   *redact.Redactor
+}
+
+// EvalRequest is a single script run by EvalMany.
+type EvalRequest struct {
+	// Fs receives the result.
+	Fs afero.Fs
+	// MainTs is the main.ts script to run.
+	MainTs string
+	// Src is the directory copied from the executor working directory.
+	Src string
+	// Dest is the directory Src is copied to in Fs.
+	Dest string
+	// Archive receives Src as a Format archive instead of Fs, if set.
+	Archive io.Writer
+	// Format of the Archive.
+	Format models.ArchiveFormat
+}
+
+// EvalResult is the outcome of an EvalRequest.
+type EvalResult struct {
+	// Err is the redacted error of the Eval, nil on success.
+	Err error
+	// Duration of the Eval.
+	Duration time.Duration
+	// Copy lists the files handled by the copy phase.
+	Copy models.CopyResult
+	// Diagnostics are the findings of the validation of the synthesized
+	// stacks, set with WithValidation.
+	Diagnostics tfjson.Diagnostics
+}
+
+// Option configures an App created by NewApp.
+type Option func(*app)
+
+// WithAuthProvider sets the Provider used to authenticate scoped package registries.
+//
+// Defaults to auth.NewAuthProvider().
+func WithAuthProvider(provider auth.Provider) Option {
+	return func(a *app) {
+		a.authProvider = provider
+	}
+}
+
+// WithExecutorOptionKeys sets the AppConfig.ExecutorOptions keys accepted by Configure.
+//
+// e.g. executors.NodeOptionKeys, by default the keys are the ones reported by
+// the Executor if it implements models.OptionKeysReporter.
+func WithExecutorOptionKeys(keys []string) Option {
+	return func(a *app) {
+		a.optionKeys = keys
+	}
+}
+
+// WithTempDir sets the directory the executors create their working directory in.
+//
+// Defaults to os.TempDir().
+func WithTempDir(dir string) Option {
+	return func(a *app) {
+		a.tempDir = dir
+	}
+}
+
+// WithExecutorPool sets the pool providing the Executor of each Eval.
+//
+// By default each Eval creates a new Executor and cleans it up when done.
+func WithExecutorPool(pool ExecutorPool) Option {
+	return func(a *app) {
+		a.pool = pool
+	}
 }
 
-func NewApp(newFn models.NewExecutorFn, logger *zap.Logger) App {
-	return &app{
+// WithOutputSink sets a writer receiving each line of the executor subprocess output.
+//
+// Secret values are redacted, the output is logged regardless.
+func WithOutputSink(w io.Writer) Option {
+	return func(a *app) {
+		a.output = w
+	}
+}
+
+// WithHooks adds Hooks called around every Eval phase, in order.
+func WithHooks(hooks ...Hooks) Option {
+	return func(a *app) {
+		a.hooks = append(a.hooks, hooks...)
+	}
+}
+
+// WithManifestKey sets the key signing the manifests written when
+// CopyOptions.Manifest is set.
+//
+// Without a key the manifests are not signed.
+func WithManifestKey(key ed25519.PrivateKey) Option {
+	return func(a *app) {
+		a.manifestKey = key
+	}
+}
+
+// WithValidation validates the synthesized stacks/<name>/cdk.tf.json files
+// of the src directory before they are copied, see tfjson.Validate.
+//
+// The findings are returned as EvalResult.Diagnostics by Run and EvalMany,
+// Eval and EvalArchive only return their error. An Eval fails without
+// copying anything when one of them is an error.
+func WithValidation() Option {
+	return func(a *app) {
+		a.validate = true
+	}
+}
+
+// WithClock sets the clock timing the Eval phases.
+//
+// Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(a *app) {
+		a.now = now
+	}
+}
+
+// NewApp returns an App creating executors with newFn.
+func NewApp(newFn models.NewExecutorFn, logger *zap.Logger, opts ...Option) App {
+	a := &app{
 		newExecutorFn: newFn,
 		authProvider:  auth.NewAuthProvider(),
+		env:           &environment{redactor: redact.New()},
+		pool:          ephemeralPool{},
+		now:           time.Now,
 		logger:        logger,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *app) Configure(ctx context.Context, config models.AppConfig) error {
-	envVars := config.EnvVars
-	if envVars == nil {
-		a.logger.Debug("using os env vars")
-		envVars = executors.EnvMap(os.Environ())
-	}
-	a.envVars = envVars
-	a.config = config
-	for _, scopedPackage := range a.config.Scopes {
+	optionKeys := a.optionKeys
+	if len(config.ExecutorOptions) > 0 {
+		var err error
+		if optionKeys, err = a.executorOptionKeys(ctx); err != nil {
+			return err
+		}
+	}
+	if err := config.Validate(optionKeys); err != nil {
+		return err
+	}
+	env, err := baseEnv(config, os.Environ())
+	if err != nil {
+		return err
+	}
+	installEnv := withEnv(env, config.Env.Install)
+	execEnv := withEnv(env, config.Env.Exec)
+
+	var secrets []string
+	for _, name := range config.SecretEnvVars {
+		for _, envVars := range []map[string]string{installEnv, execEnv} {
+			if v, ok := envVars[name]; ok {
+				secrets = append(secrets, v)
+			}
+		}
+	}
+	// mask what is known so far in case authentication fails
+	redactor := redact.New(secrets...)
+	for _, scopedPackage := range config.Scopes {
 		if !scopedPackage.RequiresAuth {
 			continue
 		}
-		authenticator, err := a.authProvider.Provide(ctx, scopedPackage.RegistryURL)
+		authenticator, err := a.authProvider.Provide(ctx, scopedPackage)
 		if err != nil {
-			return err
+			return redactor.Error(err)
 		}
-		a.envVars, err = authenticator.Auth(ctx, *scopedPackage.AuthTokenEnvVar, a.envVars)
+		// registry tokens are only needed to install dependencies
+		before := maps.Clone(installEnv)
+		installEnv, err = authenticator.Auth(ctx, *scopedPackage.AuthTokenEnvVar, installEnv)
 		if err != nil {
-			return err
+			return redactor.Error(err)
 		}
+		secrets = append(secrets, injectedValues(before, installEnv)...)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.env = &environment{
+		config:     config,
+		installEnv: installEnv,
+		execEnv:    execEnv,
+		redactor:   redact.New(secrets...),
 	}
 	return nil
 }
 
+// executorOptionKeys returns the keys set by WithExecutorOptionKeys, or the
+// keys reported by an Executor, nil if they are unknown.
+//
+// Configure only calls it when the config sets ExecutorOptions, to not create
+// an Executor otherwise.
+func (a *app) executorOptionKeys(ctx context.Context) ([]string, error) {
+	if a.optionKeys != nil {
+		return a.optionKeys, nil
+	}
+	a.probeKeys.Do(func() {
+		e, err := a.newExecutor(a.environment())
+		if err != nil {
+			a.probeKeysErr = fmt.Errorf("error creating executor to read its option keys: %w", err)
+			return
+		}
+		if reporter, ok := e.(models.OptionKeysReporter); ok {
+			a.probedKeys = reporter.OptionKeys()
+		}
+		if err := e.Cleanup(ctx); err != nil {
+			a.logger.Warn("error cleaning up executor", zap.Error(err))
+		}
+	})
+	return a.probedKeys, a.probeKeysErr
+}
+
+// environment returns the state set by the last Configure call.
+func (a *app) environment() *environment {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.env
+}
+
 func (a *app) Eval(ctx context.Context, dstFs afero.Fs, mainTs, src, dstPath string) error {
-	e, err := a.newExecutorFn(a.logger)
+	env := a.environment()
+	_, err := a.eval(ctx, env, EvalRequest{Fs: dstFs, MainTs: mainTs, Src: src, Dest: dstPath})
+	return env.redactor.Error(err)
+}
+
+func (a *app) EvalArchive(ctx context.Context, w io.Writer, format models.ArchiveFormat, mainTs, src string) error {
+	env := a.environment()
+	_, err := a.eval(ctx, env, EvalRequest{Archive: w, Format: format, MainTs: mainTs, Src: src})
+	return env.redactor.Error(err)
+}
+
+func (a *app) Run(ctx context.Context, req EvalRequest) EvalResult {
+	env := a.environment()
+	return a.timed(env.redactor, func() (EvalResult, error) { return a.eval(ctx, env, req) })
+}
+
+func (a *app) EvalMany(ctx context.Context, requests []EvalRequest, workers int) []EvalResult {
+	env := a.environment()
+	return a.evalMany(requests, workers, env.redactor, func(req EvalRequest) (EvalResult, error) {
+		return a.eval(ctx, env, req)
+	})
+}
+
+// evalMany runs the requests with evalFn on at most workers goroutines,
+// timing each request and redacting its error.
+func (a *app) evalMany(requests []EvalRequest, workers int, redactor *redact.Redactor, evalFn func(EvalRequest) (EvalResult, error)) []EvalResult {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]EvalResult, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(requests)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = a.timed(redactor, func() (EvalResult, error) { return evalFn(requests[i]) })
+			}
+		}()
+	}
+	for i := range requests {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// timed runs evalFn, timing it and redacting its error.
+func (a *app) timed(redactor *redact.Redactor, evalFn func() (EvalResult, error)) EvalResult {
+	start := a.now()
+	result, err := evalFn()
+	result.Err = redactor.Error(err)
+	result.Duration = a.now().Sub(start)
+	return result
+}
+
+func (a *app) eval(ctx context.Context, env *environment, req EvalRequest) (EvalResult, error) {
+	if err := checkRequest(env, req); err != nil {
+		return EvalResult{}, err
+	}
+	start := a.now()
+	e, err := a.pool.Get(ctx, func() (models.Executor, error) {
+		return a.newExecutor(env)
+	})
 	if err != nil {
-		return err
+		return EvalResult{}, a.setupFailed(ctx, nil, err)
 	}
-	defer e.Cleanup(ctx)
-	if a.config.PreSetupFn != nil {
-		if err := a.config.PreSetupFn(e); err != nil {
-			return err
+	defer a.pool.Put(ctx, e)
+	if env.config.PreSetupFn != nil {
+		if err := env.config.PreSetupFn(e); err != nil {
+			return EvalResult{}, a.setupFailed(ctx, e, err)
 		}
 	}
-	if err := e.Setup(ctx, a.config, a.envVars); err != nil {
-		return err
+	if err := a.runPhase(ctx, e, PhaseSetup, func(*PhaseInfo) error {
+		return e.Setup(ctx, env.config, env.installEnv)
+	}); err != nil {
+		return EvalResult{}, err
 	}
-	if err := e.Exec(ctx, mainTs, a.envVars); err != nil {
-		return err
+	if err := a.runPhase(ctx, e, PhaseExec, func(*PhaseInfo) error {
+		return e.Exec(ctx, req.MainTs, env.execEnv)
+	}); err != nil {
+		return EvalResult{}, err
 	}
-	if err := e.CopyTo(ctx, src, dstFs, dstPath, models.CopyOptions{}); err != nil {
+	return a.copyAndValidate(ctx, env, e, req, req.Src, start)
+}
+
+// copyAndValidate validates the stacks of src, then runs its copy phase
+// unless a stack is invalid.
+func (a *app) copyAndValidate(ctx context.Context, env *environment, e models.Executor, req EvalRequest, src string, start time.Time) (EvalResult, error) {
+	var result EvalResult
+	if a.validate {
+		var err error
+		if result.Diagnostics, err = validateSource(ctx, e, src); err != nil {
+			return result, err
+		}
+		if err := result.Diagnostics.Err(); err != nil {
+			return result, err
+		}
+	}
+	var err error
+	result.Copy, err = a.copyPhase(ctx, e, func() (models.CopyResult, error) {
+		return a.copyOut(ctx, env, e, req, src, start)
+	})
+	return result, err
+}
+
+func (a *app) copyPhase(ctx context.Context, e models.Executor, copyFn func() (models.CopyResult, error)) (models.CopyResult, error) {
+	var result models.CopyResult
+	err := a.runPhase(ctx, e, PhaseCopy, func(info *PhaseInfo) error {
+		var err error
+		result, err = copyFn()
+		info.Copy = &result
 		return err
+	})
+	return result, err
+}
+
+// copyOut copies src from the Executor to the request destination, followed by its manifest.
+func (a *app) copyOut(ctx context.Context, env *environment, e models.Executor, req EvalRequest, src string, start time.Time) (models.CopyResult, error) {
+	options := env.config.CopyOptions
+	if req.Archive != nil {
+		return e.ArchiveTo(ctx, src, req.Archive, req.Format, options)
 	}
-	return nil
+	result, err := e.CopyTo(ctx, src, req.Fs, req.Dest, options)
+	if err != nil || options.Manifest == "" {
+		return result, err
+	}
+	return result, a.writeManifest(ctx, env, e, req.Fs, req.Dest, result, start)
+}
+
+// newExecutor creates an Executor with the App logger and settings.
+func (a *app) newExecutor(env *environment) (models.Executor, error) {
+	var opts []models.ExecutorOption
+	if a.tempDir != "" {
+		opts = append(opts, models.WithTempDir(a.tempDir))
+	}
+	if a.output != nil {
+		opts = append(opts, models.WithOutput(env.redactor.Writer(a.output)))
+	}
+	return a.newExecutorFn(env.redactor.Logger(a.logger), opts...)
+}
+
+// injectedValues returns the values added or changed in after compared to before.
+func injectedValues(before, after map[string]string) []string {
+	var values []string
+	for k, v := range after {
+		if prev, ok := before[k]; !ok || prev != v {
+			values = append(values, v)
+		}
+	}
+	return values
 }
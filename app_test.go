@@ -0,0 +1,612 @@
+package synth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/environment-toolkit/go-synth/auth"
+	"github.com/environment-toolkit/go-synth/manifest"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/environment-toolkit/go-synth/tfjson"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// fakeExecutor runs the provided functions instead of a package manager.
+type fakeExecutor struct {
+	logger  *zap.Logger
+	setupFn func(envVars map[string]string) error
+	execFn  func(envVars map[string]string) error
+	mainTS  string
+}
+
+func (f *fakeExecutor) Setup(ctx context.Context, config models.AppConfig, envVars map[string]string) error {
+	if f.setupFn != nil {
+		return f.setupFn(envVars)
+	}
+	return nil
+}
+
+func (f *fakeExecutor) Exec(ctx context.Context, mainTS string, envVars map[string]string) error {
+	f.mainTS = mainTS
+	if f.execFn != nil {
+		return f.execFn(envVars)
+	}
+	return nil
+}
+
+// CopyTo writes the main.ts of the last Exec to dstDir.
+func (f *fakeExecutor) CopyTo(ctx context.Context, srcDir string, dstFS afero.Fs, dstDir string, options models.CopyOptions) (models.CopyResult, error) {
+	result := models.CopyResult{Added: []string{"main.ts"}}
+	return result, afero.WriteFile(dstFS, filepath.Join(dstDir, "main.ts"), []byte(f.mainTS), 0644)
+}
+
+// ArchiveTo writes the main.ts of the last Exec to w.
+func (f *fakeExecutor) ArchiveTo(ctx context.Context, srcDir string, w io.Writer, format models.ArchiveFormat, options models.CopyOptions) (models.CopyResult, error) {
+	result := models.CopyResult{Added: []string{"main.ts"}}
+	return result, archive.Write(w, format, map[string][]byte{"main.ts": []byte(f.mainTS)})
+}
+
+func (f *fakeExecutor) CopyFrom(ctx context.Context, srcFS afero.Fs, srcDir, dstDir string, options models.CopyOptions) (models.CopyResult, error) {
+	return models.CopyResult{}, nil
+}
+
+func (f *fakeExecutor) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+type staticAuthenticator struct {
+	token string
+}
+
+func (s *staticAuthenticator) Auth(ctx context.Context, envKey string, envVars map[string]string) (map[string]string, error) {
+	envVars[envKey] = s.token
+	return envVars, nil
+}
+
+func newStaticProvider(token string) auth.Provider {
+	provider := auth.NewAuthProvider()
+	provider.Register(func(string) bool { return true }, func(ctx context.Context, scope models.ScopedPackageOptions) (auth.Authenticator, error) {
+		return &staticAuthenticator{token: token}, nil
+	})
+	return provider
+}
+
+func Test_app_Redaction(t *testing.T) {
+	ctx := context.Background()
+	core, logs := observer.New(zap.DebugLevel)
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{
+			logger: logger,
+			setupFn: func(envVars map[string]string) error {
+				logger.Info("npm ERR! 401 token " + envVars["NPM_TOKEN"] + " " + envVars["API_KEY"])
+				return fmt.Errorf("install failed with %s", envVars["NPM_TOKEN"])
+			},
+		}, nil
+	}
+	tokenEnvVar := "NPM_TOKEN"
+	a := NewApp(newFn, zap.New(core), WithAuthProvider(newStaticProvider("registry-token")))
+	err := a.Configure(ctx, models.AppConfig{
+		EnvVars: map[string]string{
+			"API_KEY": "api-key-value",
+		},
+		SecretEnvVars: []string{"API_KEY"},
+		Scopes: []models.ScopedPackageOptions{
+			{
+				Scope:           "@example",
+				RegistryURL:     "https://npm.example.com/",
+				RequiresAuth:    true,
+				AuthTokenEnvVar: &tokenEnvVar,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	err = a.Eval(ctx, afero.NewMemMapFs(), "", "cdktf.out", "out")
+	require.EqualError(t, err, "install failed with [REDACTED]")
+	entries := logs.FilterMessageSnippet("npm ERR!").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "npm ERR! 401 token [REDACTED] [REDACTED]", entries[0].Message)
+}
+
+func Test_app_EnvPolicy(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("GO_SYNTH_TEST_ALLOWED", "allowed")
+	t.Setenv("GO_SYNTH_TEST_SECRET", "host-secret")
+
+	var setupEnv, execEnv map[string]string
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{
+			logger: logger,
+			setupFn: func(envVars map[string]string) error {
+				setupEnv = envVars
+				return nil
+			},
+			execFn: func(envVars map[string]string) error {
+				execEnv = envVars
+				return nil
+			},
+		}, nil
+	}
+	tokenEnvVar := "NPM_TOKEN"
+	a := NewApp(newFn, zap.NewNop(), WithAuthProvider(newStaticProvider("registry-token")))
+	err := a.Configure(ctx, models.AppConfig{
+		EnvVars: map[string]string{
+			"EXPLICIT": "explicit",
+		},
+		Env: models.EnvPolicy{
+			Mode:    models.EnvAllowlist,
+			Allow:   []string{"PATH", "GO_SYNTH_TEST_ALLOW*"},
+			Install: map[string]string{"INSTALL_ONLY": "install"},
+			Exec:    map[string]string{"EXEC_ONLY": "exec"},
+		},
+		Scopes: []models.ScopedPackageOptions{
+			{
+				Scope:           "@example",
+				RegistryURL:     "https://npm.example.com/",
+				RequiresAuth:    true,
+				AuthTokenEnvVar: &tokenEnvVar,
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, a.Eval(ctx, afero.NewMemMapFs(), "", "cdktf.out", "out"))
+
+	for _, env := range []map[string]string{setupEnv, execEnv} {
+		require.Equal(t, "allowed", env["GO_SYNTH_TEST_ALLOWED"])
+		require.Equal(t, "explicit", env["EXPLICIT"])
+		require.NotContains(t, env, "GO_SYNTH_TEST_SECRET")
+	}
+	require.Equal(t, "registry-token", setupEnv["NPM_TOKEN"])
+	require.Equal(t, "install", setupEnv["INSTALL_ONLY"])
+	require.NotContains(t, setupEnv, "EXEC_ONLY")
+	require.NotContains(t, execEnv, "NPM_TOKEN")
+	require.NotContains(t, execEnv, "INSTALL_ONLY")
+	require.Equal(t, "exec", execEnv["EXEC_ONLY"])
+}
+
+// countingPool records the Executors handed out by the App.
+type countingPool struct {
+	gets, puts int
+}
+
+func (p *countingPool) Get(ctx context.Context, newFn func() (models.Executor, error)) (models.Executor, error) {
+	p.gets++
+	return newFn()
+}
+
+func (p *countingPool) Put(ctx context.Context, e models.Executor) error {
+	p.puts++
+	return e.Cleanup(ctx)
+}
+
+func Test_app_Options(t *testing.T) {
+	ctx := context.Background()
+	var settings models.ExecutorSettings
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		settings = models.NewExecutorSettings(opts...)
+		return &fakeExecutor{
+			logger: logger,
+			execFn: func(envVars map[string]string) error {
+				_, err := io.WriteString(settings.Output, "using "+envVars["API_KEY"]+"\n")
+				return err
+			},
+		}, nil
+	}
+	pool := &countingPool{}
+	var output strings.Builder
+	a := NewApp(newFn, zap.NewNop(),
+		WithTempDir("/var/tmp/go-synth"),
+		WithExecutorPool(pool),
+		WithOutputSink(&output),
+	)
+	require.NoError(t, a.Configure(ctx, models.AppConfig{
+		EnvVars:       map[string]string{"API_KEY": "api-key-value"},
+		SecretEnvVars: []string{"API_KEY"},
+	}))
+	require.NoError(t, a.Eval(ctx, afero.NewMemMapFs(), "", "cdktf.out", "out"))
+
+	require.Equal(t, "/var/tmp/go-synth", settings.TempDir)
+	require.Equal(t, "using [REDACTED]\n", output.String())
+	require.Equal(t, 1, pool.gets)
+	require.Equal(t, 1, pool.puts)
+}
+
+// keysExecutor reports the option keys it accepts.
+type keysExecutor struct {
+	*fakeExecutor
+}
+
+func (keysExecutor) OptionKeys() []string {
+	return []string{"entrypoint"}
+}
+
+func Test_app_ExecutorOptionKeys(t *testing.T) {
+	ctx := context.Background()
+	created := 0
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		created++
+		return keysExecutor{&fakeExecutor{logger: logger}}, nil
+	}
+	a := NewApp(newFn, zap.NewNop())
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+	require.Zero(t, created, "no executor is created without executor options")
+
+	err := a.Configure(ctx, models.AppConfig{ExecutorOptions: map[string]string{"entrypiont": "bun"}})
+	require.ErrorContains(t, err, `executorOptions: unknown key "entrypiont"`)
+	require.NoError(t, a.Configure(ctx, models.AppConfig{ExecutorOptions: map[string]string{"entrypoint": "bun"}}))
+	require.Equal(t, 1, created, "the keys are read once")
+
+	a = NewApp(newFn, zap.NewNop(), WithExecutorOptionKeys([]string{"other"}))
+	require.NoError(t, a.Configure(ctx, models.AppConfig{ExecutorOptions: map[string]string{"other": "x"}}))
+}
+
+// recordingHooks records the hook calls as "<hook>:<phase>".
+type recordingHooks struct {
+	NopHooks
+	calls      []string
+	durations  []time.Duration
+	copied     *models.CopyResult
+	vetoCopy   bool
+	errorPhase Phase
+}
+
+func (h *recordingHooks) BeforeSetup(ctx context.Context, e models.Executor, info PhaseInfo) error {
+	h.calls = append(h.calls, "before:"+string(info.Phase))
+	return nil
+}
+
+func (h *recordingHooks) AfterSetup(ctx context.Context, e models.Executor, info PhaseInfo) error {
+	h.calls = append(h.calls, "after:"+string(info.Phase))
+	h.durations = append(h.durations, info.Duration)
+	return nil
+}
+
+func (h *recordingHooks) AfterExec(ctx context.Context, e models.Executor, info PhaseInfo) error {
+	h.calls = append(h.calls, "after:"+string(info.Phase))
+	h.durations = append(h.durations, info.Duration)
+	return nil
+}
+
+func (h *recordingHooks) BeforeCopy(ctx context.Context, e models.Executor, info PhaseInfo) error {
+	h.calls = append(h.calls, "before:"+string(info.Phase))
+	if h.vetoCopy {
+		return errors.New("copy vetoed")
+	}
+	return nil
+}
+
+func (h *recordingHooks) AfterCopy(ctx context.Context, e models.Executor, info PhaseInfo) error {
+	h.calls = append(h.calls, "after:"+string(info.Phase))
+	h.copied = info.Copy
+	return nil
+}
+
+func (h *recordingHooks) OnError(ctx context.Context, e models.Executor, info PhaseInfo) {
+	h.calls = append(h.calls, "error:"+string(info.Phase))
+	h.errorPhase = info.Phase
+}
+
+func Test_app_Hooks(t *testing.T) {
+	ctx := context.Background()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{logger: logger}, nil
+	}
+	// each call to the clock advances a second
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	hooks := &recordingHooks{}
+	a := NewApp(newFn, zap.NewNop(), WithHooks(hooks), WithClock(clock))
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+	require.NoError(t, a.Eval(ctx, afero.NewMemMapFs(), "", "cdktf.out", "out"))
+	require.Equal(t, []string{"before:setup", "after:setup", "after:exec", "before:copy", "after:copy"}, hooks.calls)
+	require.Equal(t, []time.Duration{time.Second, time.Second}, hooks.durations)
+	require.Equal(t, &models.CopyResult{Added: []string{"main.ts"}}, hooks.copied)
+
+	veto := &recordingHooks{vetoCopy: true}
+	a = NewApp(newFn, zap.NewNop(), WithHooks(veto))
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+	err := a.Eval(ctx, afero.NewMemMapFs(), "", "cdktf.out", "out")
+	require.EqualError(t, err, "copy vetoed")
+	require.Equal(t, []string{"before:setup", "after:setup", "after:exec", "before:copy", "error:copy"}, veto.calls)
+	require.Equal(t, PhaseCopy, veto.errorPhase)
+
+	failing := &recordingHooks{}
+	a = NewApp(func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return nil, errors.New("no executor")
+	}, zap.NewNop(), WithHooks(failing))
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+	require.EqualError(t, a.Eval(ctx, afero.NewMemMapFs(), "", "cdktf.out", "out"), "no executor")
+	require.Equal(t, []string{"error:setup"}, failing.calls)
+
+	preSetup := &recordingHooks{}
+	a = NewApp(newFn, zap.NewNop(), WithHooks(preSetup))
+	require.NoError(t, a.Configure(ctx, models.AppConfig{PreSetupFn: func(models.Executor) error {
+		return errors.New("pre setup failed")
+	}}))
+	require.EqualError(t, a.Eval(ctx, afero.NewMemMapFs(), "", "cdktf.out", "out"), "pre setup failed")
+	require.Equal(t, []string{"error:setup"}, preSetup.calls)
+}
+
+func Test_app_EvalMany(t *testing.T) {
+	ctx := context.Background()
+	var running, maxRunning atomic.Int32
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		f := &fakeExecutor{logger: logger}
+		f.execFn = func(envVars map[string]string) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				current := maxRunning.Load()
+				if n <= current || maxRunning.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			if f.mainTS == "fail" {
+				return errors.New("synth failed")
+			}
+			return nil
+		}
+		return f, nil
+	}
+	a := NewApp(newFn, zap.NewNop())
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+
+	dstFs := afero.NewMemMapFs()
+	var requests []EvalRequest
+	for i := 0; i < 10; i++ {
+		mainTs := fmt.Sprintf("stack-%d", i)
+		if i == 3 {
+			mainTs = "fail"
+		}
+		requests = append(requests, EvalRequest{
+			Fs:     dstFs,
+			MainTs: mainTs,
+			Src:    "cdktf.out",
+			Dest:   fmt.Sprintf("out/%d", i),
+		})
+	}
+	results := a.EvalMany(ctx, requests, 3)
+	require.Len(t, results, len(requests))
+	for i, result := range results {
+		if i == 3 {
+			require.EqualError(t, result.Err, "synth failed")
+			continue
+		}
+		require.NoError(t, result.Err)
+		require.Equal(t, []string{"main.ts"}, result.Copy.Added)
+		content, err := afero.ReadFile(dstFs, fmt.Sprintf("out/%d/main.ts", i))
+		require.NoError(t, err)
+		require.Equal(t, requests[i].MainTs, string(content))
+	}
+	require.LessOrEqual(t, maxRunning.Load(), int32(3))
+	require.Greater(t, maxRunning.Load(), int32(1))
+}
+
+func Test_app_EvalArchive(t *testing.T) {
+	ctx := context.Background()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{logger: logger}, nil
+	}
+	hooks := &recordingHooks{}
+	a := NewApp(newFn, zap.NewNop(), WithHooks(hooks))
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+
+	var got, want bytes.Buffer
+	require.NoError(t, a.EvalArchive(ctx, &got, models.ArchiveZip, "stack", "cdktf.out"))
+	require.NoError(t, archive.Zip(&want, map[string][]byte{"main.ts": []byte("stack")}))
+	require.Equal(t, want.Bytes(), got.Bytes())
+	require.Equal(t, &models.CopyResult{Added: []string{"main.ts"}}, hooks.copied)
+
+	var out bytes.Buffer
+	results := a.EvalMany(ctx, []EvalRequest{{Archive: &out, Format: models.ArchiveZip, MainTs: "stack", Src: "cdktf.out"}}, 1)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, want.Bytes(), out.Bytes())
+
+	out.Reset()
+	result := a.Run(ctx, EvalRequest{Archive: &out, Format: models.ArchiveZip, MainTs: "stack", Src: "cdktf.out"})
+	require.NoError(t, result.Err)
+	require.Equal(t, models.CopyResult{Added: []string{"main.ts"}}, result.Copy)
+	require.Equal(t, want.Bytes(), out.Bytes())
+}
+
+func Test_app_Manifest(t *testing.T) {
+	ctx := context.Background()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{logger: logger}, nil
+	}
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewApp(newFn, zap.NewNop(), WithManifestKey(key), WithClock(func() time.Time { return now }))
+	config := models.AppConfig{
+		EnvVars:       map[string]string{"TOKEN": "secret"},
+		SecretEnvVars: []string{"TOKEN"},
+		CopyOptions:   models.CopyOptions{Manifest: "manifest.json"},
+	}
+	require.NoError(t, a.Configure(ctx, config))
+
+	// a merge copy into a non-empty destination keeps the other files
+	dstFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(dstFs, "out/previous.txt", []byte("previous"), 0644))
+	require.NoError(t, a.Eval(ctx, dstFs, "stack", "cdktf.out", "out"))
+	m, err := manifest.Verify(dstFs, "out", "manifest.json", pub)
+	require.NoError(t, err)
+	require.Equal(t, []string{"main.ts"}, []string{m.Files[0].Path})
+	require.Equal(t, now, m.Metadata.CreatedAt)
+	require.True(t, m.Metadata.Partial)
+
+	// a sync copy holds only the listed files
+	config.CopyOptions.Mode = models.CopySync
+	require.NoError(t, a.Configure(ctx, config))
+	require.NoError(t, a.Eval(ctx, dstFs, "stack", "cdktf.out", "synced"))
+	synced, err := manifest.Verify(dstFs, "synced", "manifest.json", pub)
+	require.NoError(t, err)
+	require.False(t, synced.Metadata.Partial)
+	require.NoError(t, afero.WriteFile(dstFs, "synced/extra.txt", []byte("extra"), 0644))
+	_, err = manifest.Verify(dstFs, "synced", "manifest.json", pub)
+	require.ErrorContains(t, err, "extra.txt: not in the manifest")
+	config.CopyOptions.Mode = ""
+	require.NoError(t, a.Configure(ctx, config))
+
+	// the hash does not depend on the env var values
+	config.EnvVars = map[string]string{"TOKEN": "other"}
+	want, err := manifest.ConfigHash(config)
+	require.NoError(t, err)
+	require.NotEqual(t, want, m.Metadata.ConfigHash)
+	config.EnvVars = map[string]string{"TOKEN": ""}
+	want, err = manifest.ConfigHash(config)
+	require.NoError(t, err)
+	require.Equal(t, want, m.Metadata.ConfigHash)
+
+	config.EnvVars = map[string]string{"TOKEN": "secret", "REGION": "eu-west-1"}
+	config.Env.Install = map[string]string{"NPM_TOKEN": "install"}
+	require.NoError(t, a.Configure(ctx, config))
+	require.NoError(t, a.Eval(ctx, dstFs, "stack", "cdktf.out", "out"))
+	m, err = manifest.Verify(dstFs, "out", "manifest.json", pub)
+	require.NoError(t, err)
+	config.EnvVars = map[string]string{"TOKEN": "", "REGION": ""}
+	config.Env.Install = map[string]string{"NPM_TOKEN": ""}
+	want, err = manifest.ConfigHash(config)
+	require.NoError(t, err)
+	require.Equal(t, want, m.Metadata.ConfigHash, "the hash does not reveal non-secret values either")
+
+	_, err = manifest.Verify(dstFs, "out", "manifest.json", nil)
+	require.ErrorIs(t, err, manifest.ErrNoKey)
+
+	var out bytes.Buffer
+	err = a.EvalArchive(ctx, &out, models.ArchiveZip, "stack", "cdktf.out")
+	require.ErrorIs(t, err, ErrArchiveManifest)
+	require.Zero(t, out.Len())
+}
+
+// stackExecutor writes the main.ts of the last Exec as the cdk.tf.json of a dev stack.
+type stackExecutor struct {
+	*fakeExecutor
+}
+
+func (f stackExecutor) CopyTo(ctx context.Context, srcDir string, dstFS afero.Fs, dstDir string, options models.CopyOptions) (models.CopyResult, error) {
+	result := models.CopyResult{Added: []string{"stacks/dev/cdk.tf.json"}}
+	return result, afero.WriteFile(dstFS, filepath.Join(dstDir, "stacks/dev/cdk.tf.json"), []byte(f.mainTS), 0644)
+}
+
+func (f stackExecutor) ArchiveTo(ctx context.Context, srcDir string, w io.Writer, format models.ArchiveFormat, options models.CopyOptions) (models.CopyResult, error) {
+	result := models.CopyResult{Added: []string{"stacks/dev/cdk.tf.json"}}
+	return result, archive.Write(w, format, map[string][]byte{"stacks/dev/cdk.tf.json": []byte(f.mainTS)})
+}
+
+func Test_app_Validation(t *testing.T) {
+	ctx := context.Background()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return stackExecutor{&fakeExecutor{logger: logger}}, nil
+	}
+	a := NewApp(newFn, zap.NewNop(), WithValidation())
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+
+	valid := `{"terraform": {"required_providers": {"null": {}}}, "resource": {"null_resource": {"r": {}}}}`
+	warning := `{"resource": {"null_resource": {"r": {}}}}`
+	invalid := `{"output": {"id": {"value": "${null_resource.missing.id}"}}}`
+	dstFs := afero.NewMemMapFs()
+	var out bytes.Buffer
+	results := a.EvalMany(ctx, []EvalRequest{
+		{Fs: dstFs, MainTs: valid, Src: "cdktf.out", Dest: "valid"},
+		{Fs: dstFs, MainTs: warning, Src: "cdktf.out", Dest: "warning"},
+		{Archive: &out, Format: models.ArchiveTarGz, MainTs: invalid, Src: "cdktf.out"},
+	}, 1)
+	require.NoError(t, results[0].Err)
+	require.Empty(t, results[0].Diagnostics)
+	require.NoError(t, results[1].Err, "warnings do not fail the Eval")
+	require.Equal(t, tfjson.Diagnostics{{
+		Severity: tfjson.SeverityWarning,
+		Code:     tfjson.CodeUndeclaredProvider,
+		Stack:    "dev",
+		Address:  "null_resource.r",
+		Message:  `provider "null" of null_resource is not in the required_providers`,
+	}}, results[1].Diagnostics)
+	require.EqualError(t, results[2].Err, "invalid Terraform JSON: error: dev: output.id: reference to undeclared null_resource.missing")
+	require.Equal(t, tfjson.CodeUnresolvedReference, results[2].Diagnostics[0].Code)
+	require.Zero(t, out.Len(), "an invalid stack is not archived")
+	require.Empty(t, results[2].Copy)
+
+	err := a.Eval(ctx, dstFs, invalid, "cdktf.out", "invalid")
+	require.ErrorContains(t, err, "reference to undeclared null_resource.missing")
+	exists, err := afero.DirExists(dstFs, "invalid")
+	require.NoError(t, err)
+	require.False(t, exists, "an invalid stack is not copied")
+
+	// Run exposes the diagnostics of a single request, the manifest is not written
+	require.NoError(t, a.Configure(ctx, models.AppConfig{CopyOptions: models.CopyOptions{Manifest: "manifest.json"}}))
+	result := a.Run(ctx, EvalRequest{Fs: dstFs, MainTs: invalid, Src: "cdktf.out", Dest: "manifest"})
+	require.Error(t, result.Err)
+	require.Equal(t, tfjson.CodeUnresolvedReference, result.Diagnostics[0].Code)
+	exists, err = afero.Exists(dstFs, "manifest/manifest.json")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// without WithValidation the output is not checked
+	a = NewApp(newFn, zap.NewNop())
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+	results = a.EvalMany(ctx, []EvalRequest{{Fs: dstFs, MainTs: invalid, Src: "cdktf.out", Dest: "unchecked"}}, 1)
+	require.NoError(t, results[0].Err)
+	require.Nil(t, results[0].Diagnostics)
+}
+
+func Test_app_ConcurrentConfigureAndEval(t *testing.T) {
+	ctx := context.Background()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{logger: logger}, nil
+	}
+	tokenEnvVar := "NPM_TOKEN"
+	a := NewApp(newFn, zap.NewNop(), WithAuthProvider(newStaticProvider("registry-token")))
+	config := models.AppConfig{
+		EnvVars: map[string]string{},
+		Scopes: []models.ScopedPackageOptions{
+			{
+				Scope:           "@example",
+				RegistryURL:     "https://npm.example.com/",
+				RequiresAuth:    true,
+				AuthTokenEnvVar: &tokenEnvVar,
+			},
+		},
+	}
+	require.NoError(t, a.Configure(ctx, config))
+
+	dstFs := afero.NewMemMapFs()
+	// require must not be called outside of the test goroutine
+	errs := make(chan error, 16)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- a.Configure(ctx, config)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			errs <- a.Eval(ctx, dstFs, "", "cdktf.out", fmt.Sprintf("out/%d", i))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package archive packs synthesized files as tar.gz or zip archives.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+)
+
+// ReadFiles returns the files of root in fs by slash separated path relative to root.
+//
+// A missing root has no files.
+func ReadFiles(fs afero.Fs, root string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// Read returns the files of a tar.gz or zip archive by slash separated path,
+// the format is detected from its content.
+func Read(data []byte) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %w", err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return files, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error reading archive: %w", err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", header.Name, err)
+			}
+			files[path.Clean(header.Name)] = content
+		}
+	case bytes.HasPrefix(data, []byte("PK")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %w", err)
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", f.Name, err)
+			}
+			content, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", f.Name, err)
+			}
+			files[path.Clean(f.Name)] = content
+		}
+		return files, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format, expected tar.gz or zip")
+	}
+}
+
+// modTime is the modification time of the tar entries, zip entries carry none.
+var modTime = time.Unix(0, 0).UTC()
+
+// Writer streams files to a tar.gz or zip archive.
+//
+// The entries carry normalized modes and timestamps, so writing the same files
+// in the same order gives the same archive.
+type Writer struct {
+	format models.ArchiveFormat
+	gz     *gzip.Writer
+	tw     *tar.Writer
+	zw     *zip.Writer
+}
+
+// NewWriter returns a Writer of format to w, it must be closed to complete the archive.
+func NewWriter(w io.Writer, format models.ArchiveFormat) (*Writer, error) {
+	aw := &Writer{format: format}
+	switch format {
+	case models.ArchiveTarGz:
+		aw.gz = gzip.NewWriter(w)
+		aw.tw = tar.NewWriter(aw.gz)
+	case models.ArchiveZip:
+		aw.zw = zip.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	return aw, nil
+}
+
+// WriteFile adds the size bytes of r as the slash separated name.
+//
+// The mode is normalized to 0755 if any executable bit is set and 0644 otherwise.
+func (w *Writer) WriteFile(name string, mode os.FileMode, size int64, r io.Reader) error {
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	var fw io.Writer
+	if w.tw != nil {
+		if err := w.tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     int64(perm),
+			Size:     size,
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+		fw = w.tw
+	} else {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(perm)
+		var err error
+		if fw, err = w.zw.CreateHeader(header); err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+	}
+	if _, err := io.CopyN(fw, r, size); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close completes the archive, it does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// Write writes files to w as a format archive, sorted by name.
+func Write(w io.Writer, format models.ArchiveFormat, files map[string][]byte) error {
+	aw, err := NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedNames(files) {
+		content := files[name]
+		if err := aw.WriteFile(name, 0644, int64(len(content)), bytes.NewReader(content)); err != nil {
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+// TarGz writes files to w as a gzipped tarball.
+//
+// Entries are sorted with normalized modes and timestamps, so the same files give the same archive.
+func TarGz(w io.Writer, files map[string][]byte) error {
+	return Write(w, models.ArchiveTarGz, files)
+}
+
+// Zip writes files to w as a zip archive.
+//
+// Entries are sorted with normalized modes and timestamps, so the same files give the same archive.
+func Zip(w io.Writer, files map[string][]byte) error {
+	return Write(w, models.ArchiveZip, files)
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
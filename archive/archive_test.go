@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "out/stacks/a/cdk.tf.json", []byte("a"), 0644))
+	require.NoError(t, afero.WriteFile(fs, "out/manifest.json", []byte("m"), 0644))
+
+	files, err := ReadFiles(fs, "out")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{
+		"stacks/a/cdk.tf.json": []byte("a"),
+		"manifest.json":        []byte("m"),
+	}, files)
+
+	files, err = ReadFiles(fs, "missing")
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestArchives(t *testing.T) {
+	files := map[string][]byte{
+		"stacks/b/cdk.tf.json": []byte("b"),
+		"stacks/a/cdk.tf.json": []byte("a"),
+	}
+	testCases := []struct {
+		name  string
+		write func(io.Writer, map[string][]byte) error
+		read  func(t *testing.T, data []byte) map[string]string
+	}{
+		{
+			name:  "tar.gz",
+			write: TarGz,
+			read: func(t *testing.T, data []byte) map[string]string {
+				gz, err := gzip.NewReader(bytes.NewReader(data))
+				require.NoError(t, err)
+				tr := tar.NewReader(gz)
+				got := map[string]string{}
+				for {
+					header, err := tr.Next()
+					if err == io.EOF {
+						return got
+					}
+					require.NoError(t, err)
+					content, err := io.ReadAll(tr)
+					require.NoError(t, err)
+					got[header.Name] = string(content)
+				}
+			},
+		},
+		{
+			name:  "zip",
+			write: Zip,
+			read: func(t *testing.T, data []byte) map[string]string {
+				zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+				require.NoError(t, err)
+				got := map[string]string{}
+				for _, f := range zr.File {
+					r, err := f.Open()
+					require.NoError(t, err)
+					content, err := io.ReadAll(r)
+					require.NoError(t, err)
+					got[f.Name] = string(content)
+				}
+				return got
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var first, second bytes.Buffer
+			require.NoError(t, tc.write(&first, files))
+			require.NoError(t, tc.write(&second, files))
+			require.Equal(t, first.Bytes(), second.Bytes(), "archives of the same files should be identical")
+			require.Equal(t, map[string]string{
+				"stacks/a/cdk.tf.json": "a",
+				"stacks/b/cdk.tf.json": "b",
+			}, tc.read(t, first.Bytes()))
+			read, err := Read(first.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, files, read)
+		})
+	}
+}
+
+func TestRead_unknownFormat(t *testing.T) {
+	_, err := Read([]byte("{}"))
+	require.EqualError(t, err, "unknown archive format, expected tar.gz or zip")
+}
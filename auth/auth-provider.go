@@ -3,6 +3,9 @@ package auth
 import (
 	"context"
 	"fmt"
+	"sync"
+
+	"github.com/environment-toolkit/go-synth/models"
 )
 
 type Authenticator interface {
@@ -10,36 +13,96 @@ type Authenticator interface {
 	Auth(ctx context.Context, envKey string, envVars map[string]string) (map[string]string, error)
 }
 
+// Matcher reports whether a Factory handles the registry URL.
+type Matcher func(registryUrl string) bool
+
+// Factory returns an Authenticator for the scoped package registry.
+type Factory func(ctx context.Context, scope models.ScopedPackageOptions) (Authenticator, error)
+
 type Provider interface {
-	Provide(ctx context.Context, registryUrl string) (Authenticator, error)
+	Provide(ctx context.Context, scope models.ScopedPackageOptions) (Authenticator, error)
+}
+
+// Registry is a Provider choosing the Authenticator of a registry among the registered factories.
+type Registry interface {
+	Provider
+
+	// Register adds a Factory for the registry URLs accepted by matcher.
+	//
+	// Factories registered later take precedence over earlier ones, including
+	// the built-in ones. The Authenticators already provided are discarded.
+	Register(matcher Matcher, factory Factory)
 }
 
+// provider is safe for concurrent use.
 type provider struct {
-	// authenticators is a map of registry URL to Authenticator.
-	authenticators map[string]Authenticator
+	mu sync.Mutex
+	// authenticators is a map of registry URL and options to Authenticator.
+	authenticators map[authenticatorKey]Authenticator
+	// factories in registration order.
+	factories []registration
+}
+
+// authenticatorKey identifies a cached Authenticator, the options are
+// compared by value so the scopes decoded from each request share it.
+type authenticatorKey struct {
+	registryUrl  string
+	codeArtifact models.CodeArtifactOptions
 }
 
-func NewAuthProvider() Provider {
-	return &provider{
-		authenticators: make(map[string]Authenticator),
+type registration struct {
+	matcher Matcher
+	factory Factory
+}
+
+// NewAuthProvider returns a Registry with the built-in registry types registered.
+func NewAuthProvider() Registry {
+	ap := &provider{
+		authenticators: make(map[authenticatorKey]Authenticator),
 	}
+	ap.Register(IsCodeArtifactURL, newCodeArtifactFromScope)
+	return ap
+}
+
+func (ap *provider) Register(matcher Matcher, factory Factory) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	ap.factories = append(ap.factories, registration{
+		matcher: matcher,
+		factory: factory,
+	})
+	// a cached Authenticator may come from a factory the new one overrides
+	clear(ap.authenticators)
 }
 
-func (ap *provider) Provide(ctx context.Context, registryUrl string) (Authenticator, error) {
-	if authenticator, ok := ap.authenticators[registryUrl]; ok {
+func (ap *provider) Provide(ctx context.Context, scope models.ScopedPackageOptions) (Authenticator, error) {
+	key := authenticatorKey{registryUrl: scope.RegistryURL}
+	if scope.CodeArtifact != nil {
+		key.codeArtifact = *scope.CodeArtifact
+	}
+	// hold the lock while creating the Authenticator so concurrent calls share it
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	if authenticator, ok := ap.authenticators[key]; ok {
 		return authenticator, nil
 	}
-	authenticator, err := ap.newAuthenticator(ctx, registryUrl)
+	authenticator, err := ap.newAuthenticator(ctx, scope)
 	if err != nil {
 		return nil, err
 	}
-	ap.authenticators[registryUrl] = authenticator
+	ap.authenticators[key] = authenticator
 	return authenticator, nil
 }
 
-func (ap *provider) newAuthenticator(ctx context.Context, registryUrl string) (Authenticator, error) {
-	if IsCodeArtifactURL(registryUrl) {
-		return NewCodeArtifact(ctx, registryUrl)
+func (ap *provider) newAuthenticator(ctx context.Context, scope models.ScopedPackageOptions) (Authenticator, error) {
+	for i := len(ap.factories) - 1; i >= 0; i-- {
+		if ap.factories[i].matcher(scope.RegistryURL) {
+			return ap.factories[i].factory(ctx, scope)
+		}
 	}
-	return nil, fmt.Errorf("unsupported registry URL: %s", registryUrl)
+	return nil, fmt.Errorf("unsupported registry URL: %s", scope.RegistryURL)
+}
+
+func newCodeArtifactFromScope(ctx context.Context, scope models.ScopedPackageOptions) (Authenticator, error) {
+	return NewCodeArtifact(ctx, scope.RegistryURL, scope.CodeArtifact)
 }
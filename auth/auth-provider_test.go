@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/environment-toolkit/go-synth/models"
+)
+
+type staticAuthenticator struct {
+	token string
+}
+
+func (s *staticAuthenticator) Auth(ctx context.Context, envKey string, envVars map[string]string) (map[string]string, error) {
+	envVars[envKey] = s.token
+	return envVars, nil
+}
+
+func Test_provider_Register(t *testing.T) {
+	ap := NewAuthProvider()
+	calls := 0
+	ap.Register(func(registryUrl string) bool {
+		return strings.HasPrefix(registryUrl, "https://npm.example.com")
+	}, func(ctx context.Context, scope models.ScopedPackageOptions) (Authenticator, error) {
+		calls++
+		return &staticAuthenticator{token: "example-token"}, nil
+	})
+
+	ctx := context.Background()
+	scope := models.ScopedPackageOptions{
+		Scope:        "@example",
+		RegistryURL:  "https://npm.example.com/",
+		RequiresAuth: true,
+	}
+	for i := 0; i < 2; i++ {
+		authenticator, err := ap.Provide(ctx, scope)
+		if err != nil {
+			t.Fatalf("Provide() error = %v", err)
+		}
+		envVars, err := authenticator.Auth(ctx, "TOKEN", map[string]string{})
+		if err != nil {
+			t.Fatalf("Auth() error = %v", err)
+		}
+		if envVars["TOKEN"] != "example-token" {
+			t.Errorf("Auth() TOKEN = %q, want %q", envVars["TOKEN"], "example-token")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("factory called %d times, want 1", calls)
+	}
+
+	// scopes decoded from different requests share the Authenticator
+	withOptions := scope
+	for i := 0; i < 2; i++ {
+		withOptions.CodeArtifact = &models.CodeArtifactOptions{RoleARN: "arn:aws:iam::123456789012:role/read"}
+		if _, err := ap.Provide(ctx, withOptions); err != nil {
+			t.Fatalf("Provide() error = %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("factory called %d times, want 2", calls)
+	}
+
+	if _, err := ap.Provide(ctx, models.ScopedPackageOptions{RegistryURL: "https://unknown.example.com/"}); err == nil {
+		t.Errorf("Provide() expected error for unsupported registry")
+	}
+
+	// registering drops the cached Authenticators
+	ap.Register(func(string) bool { return true }, func(ctx context.Context, scope models.ScopedPackageOptions) (Authenticator, error) {
+		return &staticAuthenticator{token: "override-token"}, nil
+	})
+	authenticator, err := ap.Provide(ctx, scope)
+	if err != nil {
+		t.Fatalf("Provide() error = %v", err)
+	}
+	envVars, err := authenticator.Auth(ctx, "TOKEN", map[string]string{})
+	if err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	if envVars["TOKEN"] != "override-token" {
+		t.Errorf("Auth() TOKEN = %q after Register, want %q", envVars["TOKEN"], "override-token")
+	}
+}
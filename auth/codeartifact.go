@@ -3,39 +3,83 @@ package auth
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"regexp"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/codeartifact"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/environment-toolkit/go-synth/models"
 )
 
-const AWS_CODEARTIFACT_REGISTRY_REGEX = `\.codeartifact.*\.amazonaws\.com`
-const AWS_CODEARTIFACT_CAPTURE_REGEX = `([a-z0-9-]+)-(.+)\.d\.codeartifact\.(.+)\.amazonaws\.com`
+// AWS_CODEARTIFACT_REGISTRY_REGEX matches the host of a CodeArtifact registry URL.
+const AWS_CODEARTIFACT_REGISTRY_REGEX = `^[a-z0-9-]+-\d{12}\.d\.codeartifact\.[a-z0-9-]+\.amazonaws\.com$`
+
+// AWS_CODEARTIFACT_CAPTURE_REGEX captures the domain, account and region of a CodeArtifact registry host.
+const AWS_CODEARTIFACT_CAPTURE_REGEX = `^([a-z0-9-]+)-(\d{12})\.d\.codeartifact\.([a-z0-9-]+)\.amazonaws\.com$`
+
+var (
+	codeArtifactHost    = regexp.MustCompile(AWS_CODEARTIFACT_REGISTRY_REGEX)
+	codeArtifactCapture = regexp.MustCompile(AWS_CODEARTIFACT_CAPTURE_REGEX)
+)
+
+// tokenRefreshMargin is how long before its expiration a cached token is renewed.
+const tokenRefreshMargin = 5 * time.Minute
 
 type codeArtifactAuthenticator struct {
-	domain  *string
-	account *string
-	client  *codeartifact.Client
+	domain          *string
+	account         *string
+	durationSeconds *int64
+	client          *codeartifact.Client
+
+	// the token is cached until tokenRefreshMargin before its expiration
+	mu         sync.Mutex
+	token      string
+	expiration time.Time
 }
 
 func (c *codeArtifactAuthenticator) Auth(ctx context.Context, envKey string, envVars map[string]string) (map[string]string, error) {
-	resp, err := c.client.GetAuthorizationToken(ctx, &codeartifact.GetAuthorizationTokenInput{
-		Domain:      c.domain,
-		DomainOwner: c.account,
-	})
-	if err != nil {
-		return envVars, err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == "" || time.Now().Add(tokenRefreshMargin).After(c.expiration) {
+		resp, err := c.client.GetAuthorizationToken(ctx, &codeartifact.GetAuthorizationTokenInput{
+			Domain:          c.domain,
+			DomainOwner:     c.account,
+			DurationSeconds: c.durationSeconds,
+		})
+		if err != nil {
+			return envVars, err
+		}
+		c.token = aws.ToString(resp.AuthorizationToken)
+		c.expiration = aws.ToTime(resp.Expiration)
 	}
-	envVars[envKey] = *resp.AuthorizationToken
+	envVars[envKey] = c.token
 	return envVars, nil
 }
 
-func IsCodeArtifactURL(url string) bool {
-	regex := regexp.MustCompile(AWS_CODEARTIFACT_REGISTRY_REGEX)
-	return regex.MatchString(url)
+// IsCodeArtifactURL reports whether rawURL is an https URL whose host is a CodeArtifact registry.
+func IsCodeArtifactURL(rawURL string) bool {
+	host, ok := registryHost(rawURL)
+	return ok && codeArtifactHost.MatchString(host)
+}
+
+// registryHost returns the host of an https registry URL, without port.
+func registryHost(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return "", false
+	}
+	return u.Hostname(), true
 }
 
-func NewCodeArtifact(ctx context.Context, url string) (Authenticator, error) {
+// NewCodeArtifact returns an Authenticator for the CodeArtifact registry url.
+//
+// opts may be nil, in which case the default AWS config for the registry region is used.
+func NewCodeArtifact(ctx context.Context, url string, opts *models.CodeArtifactOptions) (Authenticator, error) {
 	if !IsCodeArtifactURL(url) {
 		return nil, fmt.Errorf("registry URL is not a CodeArtifact URL, got: %s", url)
 	}
@@ -44,30 +88,73 @@ func NewCodeArtifact(ctx context.Context, url string) (Authenticator, error) {
 	if err != nil {
 		return nil, err
 	}
+	if opts == nil {
+		opts = &models.CodeArtifactOptions{}
+	}
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(spec.region))
+	cfg, err := loadAWSConfig(ctx, spec.region, opts)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("error loading AWS config for %s: %w", url, err)
+	}
+
+	var durationSeconds *int64
+	if opts.DurationSeconds > 0 {
+		durationSeconds = aws.Int64(opts.DurationSeconds)
 	}
 
 	return &codeArtifactAuthenticator{
-		domain:  &spec.domain,
-		account: &spec.account,
-		client:  codeartifact.NewFromConfig(cfg),
+		domain:          &spec.domain,
+		account:         &spec.account,
+		durationSeconds: durationSeconds,
+		client: codeartifact.NewFromConfig(cfg, func(o *codeartifact.Options) {
+			if opts.Endpoint != "" {
+				o.BaseEndpoint = aws.String(opts.Endpoint)
+			}
+		}),
 	}, nil
 }
 
+// loadAWSConfig returns the AWS config for the registry region, assuming opts.RoleARN if set.
+func loadAWSConfig(ctx context.Context, region string, opts *models.CodeArtifactOptions) (aws.Config, error) {
+	var cfg aws.Config
+	if opts.AWSConfig != nil {
+		cfg = opts.AWSConfig.Copy()
+		if cfg.Region == "" {
+			cfg.Region = region
+		}
+	} else {
+		loadOpts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+		if opts.Profile != "" {
+			loadOpts = append(loadOpts, config.WithSharedConfigProfile(opts.Profile))
+		}
+		var err error
+		if cfg, err = config.LoadDefaultConfig(ctx, loadOpts...); err != nil {
+			return cfg, err
+		}
+	}
+
+	if opts.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if opts.ExternalID != "" {
+				o.ExternalID = aws.String(opts.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
+
 type codeArtifactSpec struct {
 	domain  string
 	account string
 	region  string
 }
 
-func parseRegistryUrl(url string) (*codeArtifactSpec, error) {
-	regex := regexp.MustCompile(AWS_CODEARTIFACT_CAPTURE_REGEX)
-	matches := regex.FindStringSubmatch(url)
+func parseRegistryUrl(rawURL string) (*codeArtifactSpec, error) {
+	host, _ := registryHost(rawURL)
+	matches := codeArtifactCapture.FindStringSubmatch(host)
 	if len(matches) == 0 {
-		return nil, fmt.Errorf("registry URL is not a valid CodeArtifact URL, got: %s", url)
+		return nil, fmt.Errorf("registry URL is not a valid CodeArtifact URL, got: %s", rawURL)
 	}
 	return &codeArtifactSpec{
 		domain:  matches[1],
@@ -1,8 +1,17 @@
 package auth
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/environment-toolkit/go-synth/models"
 )
 
 func Test_parseRegistryUrl(t *testing.T) {
@@ -28,10 +37,31 @@ func Test_parseRegistryUrl(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name:    "CodeArtifact host in the path",
+			url:     "https://attacker.example/x/d-123456789012.d.codeartifact.us-east-1.amazonaws.com/",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "CodeArtifact host as a subdomain",
+			url:     "https://d-123456789012.d.codeartifact.us-east-1.amazonaws.com.attacker.example/",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "CodeArtifact host over http",
+			url:     "http://envtio-prod-481471033259.d.codeartifact.us-east-1.amazonaws.com/npm/npm-releases/",
+			want:    nil,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCodeArtifactURL(tt.url); got == tt.wantErr {
+				t.Errorf("IsCodeArtifactURL() = %v, want %v", got, !tt.wantErr)
+			}
 			got, err := parseRegistryUrl(tt.url)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseRegistryUrl() error = %v, wantErr %v", err, tt.wantErr)
@@ -43,3 +73,54 @@ func Test_parseRegistryUrl(t *testing.T) {
 		})
 	}
 }
+
+func Test_codeArtifactAuthenticator_Endpoint(t *testing.T) {
+	calls := 0
+	expiration := "4102444800"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/v1/authorization-token" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("domain") != "envtio-prod" || query.Get("domain-owner") != "481471033259" || query.Get("duration") != "900" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"authorizationToken": "test-token", "expiration": %s}`, expiration)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	authenticator, err := NewCodeArtifact(ctx, "https://envtio-prod-481471033259.d.codeartifact.us-east-1.amazonaws.com/npm/npm-releases/", &models.CodeArtifactOptions{
+		AWSConfig: &aws.Config{
+			Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		},
+		DurationSeconds: 900,
+		Endpoint:        server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewCodeArtifact() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		envVars, err := authenticator.Auth(ctx, "TOKEN", map[string]string{})
+		if err != nil {
+			t.Fatalf("Auth() error = %v", err)
+		}
+		if envVars["TOKEN"] != "test-token" {
+			t.Errorf("Auth() TOKEN = %q, want %q", envVars["TOKEN"], "test-token")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("token requested %d times, want 1 until it expires", calls)
+	}
+
+	// an expired token is renewed
+	authenticator.(*codeArtifactAuthenticator).expiration = time.Now()
+	if _, err := authenticator.Auth(ctx, "TOKEN", map[string]string{}); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("token requested %d times, want 2 once expired", calls)
+	}
+}
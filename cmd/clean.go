@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// tempDirPatterns match the working directories left behind by the executors.
+var tempDirPatterns = []string{"go-synth-bun*", "go-synth-node*"}
+
+// cleanResult is the json output of the clean command.
+type cleanResult struct {
+	Removed []string `json:"removed"`
+}
+
+func newCleanCmd(opts *globalOptions) *cobra.Command {
+	var olderThan time.Duration
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove the cache directory and the executor working directories",
+		Long: `Clean removes the package manager caches in --cache-dir and the working
+directories left in --temp-dir by interrupted runs.
+
+Working directories modified within --older-than may belong to a running
+process and are kept.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tempDir := opts.tempDir
+			if tempDir == "" {
+				tempDir = os.TempDir()
+			}
+			removed, err := clean(afero.NewOsFs(), opts.cacheDir, tempDir, olderThan, time.Now())
+			if err != nil {
+				return err
+			}
+			return opts.printer.print(cleanResult{Removed: removed}, func(w io.Writer) {
+				if len(removed) == 0 {
+					fmt.Fprintln(w, "Nothing to clean")
+				}
+				for _, path := range removed {
+					fmt.Fprintf(w, "Removed %s\n", path)
+				}
+			})
+		},
+	}
+	cmd.Flags().DurationVar(&olderThan, "older-than", 24*time.Hour, "Only remove the working directories not modified for this long, 0 removes all")
+	return cmd
+}
+
+// clean removes cacheDir and the executor working directories in tempDir not
+// modified within olderThan, returning the removed paths.
+func clean(fs afero.Fs, cacheDir, tempDir string, olderThan time.Duration, now time.Time) ([]string, error) {
+	var paths []string
+	if cacheDir != "" {
+		if exists, err := afero.DirExists(fs, cacheDir); err != nil {
+			return nil, err
+		} else if exists {
+			paths = append(paths, cacheDir)
+		}
+	}
+	for _, pattern := range tempDirPatterns {
+		matches, err := afero.Glob(fs, filepath.Join(tempDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range matches {
+			if olderThan > 0 {
+				modified, err := lastModified(fs, path)
+				if err != nil {
+					return nil, err
+				}
+				if now.Sub(modified) < olderThan {
+					continue
+				}
+			}
+			paths = append(paths, path)
+		}
+	}
+	removed := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if err := fs.RemoveAll(path); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// lastModified returns the newest modification time of dir and its entries.
+//
+// The executors write main.ts and the session run directories at the top of
+// their working directory, so its entries change while a process uses it.
+func lastModified(fs afero.Fs, dir string) (time.Time, error) {
+	info, err := fs.Stat(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	modified := info.ModTime()
+	entries, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, entry := range entries {
+		if entry.ModTime().After(modified) {
+			modified = entry.ModTime()
+		}
+	}
+	return modified, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/environment-toolkit/go-synth/tfjson"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// errOutputsDiffer makes diff --exit-code exit with 1 without printing an error.
+var errOutputsDiffer = errors.New("outputs differ")
+
+func newDiffCmd(opts *globalOptions) *cobra.Command {
+	var exitCode bool
+	cmd := &cobra.Command{
+		Use:   "diff BEFORE AFTER",
+		Short: "Compare the Terraform JSON of two synth outputs",
+		Long: `Diff compares the stacks of two cdktf.out directories or tar.gz/zip archives
+per Terraform address, listing the added, removed and changed resources, data
+sources, providers, backends, variables and outputs with their changed attributes.
+
+The stacks are the stacks/<name>/cdk.tf.json files, optionally under a common
+directory such as cdktf.out/. An output without stacks is an error.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			before, err := readOutput(afero.NewOsFs(), args[0])
+			if err != nil {
+				return err
+			}
+			after, err := readOutput(afero.NewOsFs(), args[1])
+			if err != nil {
+				return err
+			}
+			diff, err := tfjson.DiffFiles(before, after)
+			if err != nil {
+				return err
+			}
+			if err := opts.printer.print(diff, func(w io.Writer) { printDiff(w, diff) }); err != nil {
+				return err
+			}
+			if exitCode && !diff.Empty() {
+				return errOutputsDiffer
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with 1 when the outputs differ")
+	return cmd
+}
+
+// readOutput returns the files of a synth output directory or archive.
+func readOutput(fs afero.Fs, path string) (map[string][]byte, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return archive.ReadFiles(fs, path)
+	}
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := archive.Read(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return files, nil
+}
+
+// printDiff writes the diff as text, one line per object and attribute.
+func printDiff(w io.Writer, diff *tfjson.Diff) {
+	if diff.Empty() {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+	markers := map[tfjson.Change]string{tfjson.ChangeAdded: "+", tfjson.ChangeRemoved: "-", tfjson.ChangeChanged: "~"}
+	for _, stack := range diff.Stacks {
+		fmt.Fprintf(w, "%s stack %s\n", markers[stack.Change], stack.Name)
+		for _, object := range stack.Objects {
+			fmt.Fprintf(w, "  %s %s %s\n", markers[object.Change], object.Kind, object.Address)
+			for _, attr := range object.Attributes {
+				switch attr.Change {
+				case tfjson.ChangeAdded:
+					fmt.Fprintf(w, "      + %s: %s\n", attr.Path, formatValue(attr.After))
+				case tfjson.ChangeRemoved:
+					fmt.Fprintf(w, "      - %s: %s\n", attr.Path, formatValue(attr.Before))
+				default:
+					fmt.Fprintf(w, "      ~ %s: %s => %s\n", attr.Path, formatValue(attr.Before), formatValue(attr.After))
+				}
+			}
+		}
+	}
+}
+
+func formatValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/environment-toolkit/go-synth/tfjson"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_diffOutputs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "before/stacks/dev/cdk.tf.json", []byte(`{"resource":{"null_resource":{"r":{"triggers":{"a":"1"}}}}}`), 0644))
+	var buf bytes.Buffer
+	require.NoError(t, archive.TarGz(&buf, map[string][]byte{
+		"stacks/dev/cdk.tf.json": []byte(`{"resource":{"null_resource":{"r":{"triggers":{"a":"2","b":true}}}},"output":{"o":{"value":1}}}`),
+	}))
+	require.NoError(t, afero.WriteFile(fs, "after.tar.gz", buf.Bytes(), 0644))
+	require.NoError(t, afero.WriteFile(fs, "notes.txt", []byte("notes"), 0644))
+
+	before, err := readOutput(fs, "before")
+	require.NoError(t, err)
+	after, err := readOutput(fs, "after.tar.gz")
+	require.NoError(t, err)
+	_, err = readOutput(fs, "notes.txt")
+	require.ErrorContains(t, err, "notes.txt: unknown archive format")
+
+	diff, err := tfjson.DiffFiles(before, after)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	printDiff(&out, diff)
+	require.Equal(t, `~ stack dev
+  ~ resource null_resource.r
+      ~ triggers.a: "1" => "2"
+      + triggers.b: true
+  + output output.o
+`, out.String())
+
+	out.Reset()
+	printDiff(&out, &tfjson.Diff{})
+	require.Equal(t, "No changes\n", out.String())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+const initMainTs = `import { App, TerraformStack, TerraformOutput } from "cdktf";
+
+const outdir = "cdktf.out";
+const app = new App({
+  outdir,
+});
+const stack = new TerraformStack(app, "stack");
+
+new TerraformOutput(stack, "hello", {
+  value: "world",
+});
+
+app.synth();
+`
+
+const initConfigFile = `# yaml-language-server: $schema=https://raw.githubusercontent.com/environment-toolkit/go-synth/main/models/synth.schema.json
+executor: %s
+dependencies:
+  cdktf: ^0.20.0
+  constructs: ^10.3.0
+env:
+  mode: allowlist
+copy:
+  skipDirs:
+    - node_modules
+`
+
+// initResult is the json output of the init command.
+type initResult struct {
+	Created []string `json:"created"`
+}
+
+func newInitCmd(opts *globalOptions) *cobra.Command {
+	var dir string
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create a main.ts and a synth.yaml project file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			executor := opts.executor
+			if executor == "" {
+				executor = "bun"
+			}
+			if !slices.Contains(models.ConfigFileExecutors, executor) {
+				return fmt.Errorf("unknown executor %q, expected one of %v", executor, models.ConfigFileExecutors)
+			}
+			created, err := scaffold(afero.NewOsFs(), dir, executor, force)
+			if err != nil {
+				return err
+			}
+			return opts.printer.print(initResult{Created: created}, func(w io.Writer) {
+				for _, path := range created {
+					fmt.Fprintf(w, "Created %s\n", path)
+				}
+			})
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", ".", "Directory to create the files in")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing files")
+	return cmd
+}
+
+// scaffold writes a main.ts and a synth.yaml for executor to dir and returns their paths.
+//
+// Existing files are only overwritten with force.
+func scaffold(fs afero.Fs, dir, executor string, force bool) ([]string, error) {
+	files := []struct{ name, content string }{
+		{name: "main.ts", content: initMainTs},
+		{name: "synth.yaml", content: fmt.Sprintf(initConfigFile, executor)},
+	}
+	if !force {
+		for _, f := range files {
+			path := filepath.Join(dir, f.name)
+			if exists, err := afero.Exists(fs, path); err != nil {
+				return nil, err
+			} else if exists {
+				return nil, fmt.Errorf("%s already exists, use --force to overwrite it", path)
+			}
+		}
+	}
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	created := make([]string, 0, len(files))
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := afero.WriteFile(fs, path, []byte(f.content), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		created = append(created, path)
+	}
+	return created, nil
+}
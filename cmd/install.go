@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// installResult is the json output of the install command.
+type installResult struct {
+	Executor   string `json:"executor"`
+	CacheDir   string `json:"cacheDir"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+func newInstallCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "install",
+		Short: "Install the project dependencies into the cache directory",
+		Long: `Install runs the executor setup only, filling the package manager cache
+so later synth runs install the dependencies without downloading them.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.cacheDir == "" {
+				return fmt.Errorf("install requires a --cache-dir")
+			}
+			configFile, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			opts.withCache(configFile)
+
+			start := time.Now()
+			app := opts.newApp(configFile)
+			if err := app.Configure(cmd.Context(), configFile.AppConfig); err != nil {
+				return fmt.Errorf("failed to configure app: %w", err)
+			}
+			session, err := app.Prepare(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to install dependencies: %w", err)
+			}
+			if err := session.Close(cmd.Context()); err != nil {
+				return fmt.Errorf("failed to clean up: %w", err)
+			}
+			result := installResult{Executor: configFile.Executor, CacheDir: opts.cacheDir, DurationMs: time.Since(start).Milliseconds()}
+			return opts.printer.print(result, func(w io.Writer) {
+				fmt.Fprintf(w, "Installed dependencies with %s to %s in %s\n", result.Executor, result.CacheDir, time.Since(start).Round(time.Millisecond))
+			})
+		},
+	}
+}
@@ -2,81 +2,221 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
+	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
 
 	"github.com/environment-toolkit/go-synth"
 	"github.com/environment-toolkit/go-synth/executors"
-	"github.com/spf13/afero"
-
 	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 func main() {
-	// Define flags
-	mainTsPath := flag.String("file", "", "Path to the main.ts file")
-	dependencies := flag.String("deps", "", "Comma-separated list of dependencies in format 'pkg@version'")
-	devDependencies := flag.String("devdeps", "", "Comma-separated list of devDependencies in format 'pkg@version'")
-	srcDir := flag.String("src", "cdktf.out", "Source directory for synthesized files")
-	outDir := flag.String("out", ".", "Output directory for synthesized files")
+	// Handle OS signals to gracefully shut down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	opts := &globalOptions{}
+	cmd := newRootCmd(opts)
+	err := cmd.ExecuteContext(ctx)
+	stop()
+	if errors.Is(err, errOutputsDiffer) {
+		os.Exit(1)
+	}
+	if err != nil {
+		p := &printer{w: cmd.OutOrStdout(), json: opts.output == outputJSON}
+		p.error(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+// globalOptions are the flags shared by the subcommands.
+type globalOptions struct {
+	configPath string
+	executor   string
+	output     string
+	cacheDir   string
+	tempDir    string
+	scopes     []string
+	scopeAuth  []string
+	logger     *zap.Logger
+	printer    *printer
+}
 
-	// Parse flags
-	flag.Parse()
+func newRootCmd(opts *globalOptions) *cobra.Command {
+	root := &cobra.Command{
+		Use:           "synth",
+		Short:         "Synthesize CDKTF apps with bun or node",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if opts.output != outputText && opts.output != outputJSON {
+				return fmt.Errorf("unknown output %q, expected %s or %s", opts.output, outputText, outputJSON)
+			}
+			opts.printer = &printer{w: cmd.OutOrStdout(), json: opts.output == outputJSON}
+			opts.logger = newLogger()
+			return nil
+		},
+	}
+	flags := root.PersistentFlags()
+	flags.StringVarP(&opts.configPath, "config", "c", "", "Path to a synth.yaml or synth.json project file, defaults to the one in the working directory")
+	flags.StringVarP(&opts.executor, "executor", "e", "", "Executor to use ("+strings.Join(models.ConfigFileExecutors, "|")+"), defaults to the project file executor or bun")
+	flags.StringVarP(&opts.output, "output", "o", outputText, "Output format (text|json)")
+	flags.StringVar(&opts.cacheDir, "cache-dir", defaultCacheDir(), "Directory of the package manager caches, empty to disable")
+	flags.StringVar(&opts.tempDir, "temp-dir", "", "Directory of the executor working directories, defaults to the system temp dir")
+	flags.StringArrayVar(&opts.scopes, "scope", nil, "Registry of a package scope as @scope=url, repeatable")
+	flags.StringArrayVar(&opts.scopeAuth, "scope-auth", nil, "Env var holding the registry token of a package scope as @scope=ENV_VAR, repeatable")
+
+	root.AddCommand(
+		newSynthCmd(opts),
+		newInstallCmd(opts),
+		newInitCmd(opts),
+		newCleanCmd(opts),
+		newVersionCmd(opts),
+		newServeCmd(opts),
+		newDiffCmd(opts),
+	)
+	return root
+}
+
+// loadConfig returns the project file with the flags applied.
+func (o *globalOptions) loadConfig() (*models.ConfigFile, error) {
+	return o.loadConfigIn(afero.NewOsFs(), ".")
+}
+
+// loadConfigIn returns the project file set by --config, or else the one
+// found in dir if any, with the flags applied.
+func (o *globalOptions) loadConfigIn(fs afero.Fs, dir string) (*models.ConfigFile, error) {
+	path := o.configPath
+	if path == "" {
+		var err error
+		if path, err = models.FindConfigFile(fs, dir); errors.Is(err, models.ErrNoConfigFile) {
+			path = ""
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	configFile := &models.ConfigFile{}
+	if path != "" {
+		var err error
+		if configFile, err = models.LoadConfigFile(fs, path); err != nil {
+			return nil, err
+		}
+	}
+	if o.executor != "" {
+		configFile.Executor = o.executor
+	}
+	if configFile.Executor == "" {
+		configFile.Executor = "bun"
+	}
+	if !slices.Contains(models.ConfigFileExecutors, configFile.Executor) {
+		return nil, fmt.Errorf("unknown executor %q, expected one of %v", configFile.Executor, models.ConfigFileExecutors)
+	}
+	scopes, err := mergeScopes(configFile.Scopes, o.scopes, o.scopeAuth)
+	if err != nil {
+		return nil, err
+	}
+	configFile.Scopes = scopes
+	return configFile, nil
+}
 
+// withCache points the package manager cache of the install phase to the cache directory.
+func (o *globalOptions) withCache(configFile *models.ConfigFile) {
+	if o.cacheDir == "" {
+		return
+	}
+	install := maps.Clone(configFile.Env.Install)
+	if install == nil {
+		install = map[string]string{}
+	}
+	switch configFile.Executor {
+	case "node":
+		install["npm_config_store_dir"] = filepath.Join(o.cacheDir, "pnpm-store")
+	default:
+		install["BUN_INSTALL_CACHE_DIR"] = filepath.Join(o.cacheDir, "bun")
+	}
+	configFile.Env.Install = install
+}
+
+// newApp returns an App using the executor of the project file.
+func (o *globalOptions) newApp(configFile *models.ConfigFile) synth.App {
+	newExecutorFn, optionKeys := selectExecutor(configFile.Executor)
+	return synth.NewApp(newExecutorFn, o.logger, o.appOptions(optionKeys)...)
+}
+
+// appOptions returns the App options set by the flags.
+func (o *globalOptions) appOptions(optionKeys []string) []synth.Option {
+	opts := []synth.Option{synth.WithExecutorOptionKeys(optionKeys)}
+	if o.tempDir != "" {
+		opts = append(opts, synth.WithTempDir(o.tempDir))
+	}
+	return opts
+}
+
+func newLogger() *zap.Logger {
 	logConfig := zap.NewDevelopmentConfig()
 	logConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // Optional: colorize the log level
 	logConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder        // Optional: use ISO8601 time format
 	logConfig.Encoding = "console"
 	logger, _ := logConfig.Build()
+	return logger
+}
 
-	// Validate required flags
-	if *mainTsPath == "" {
-		logger.Fatal("The -file flag is required.")
+// defaultCacheDir returns the go-synth directory in the user cache directory.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(dir, "go-synth")
+}
 
-	depsMap := parseDependencies(*dependencies)
-	devDepsMap := parseDependencies(*devDependencies)
-
-	if _, err := os.Stat(*mainTsPath); os.IsNotExist(err) {
-		logger.Fatal("The specified main.ts file does not exist", zap.String("main.ts", *mainTsPath))
+// selectExecutor returns the executor named in the project file and its option keys, bun by default.
+func selectExecutor(name string) (models.NewExecutorFn, []string) {
+	if name == "node" {
+		return executors.NewNodeExecutor, executors.NodeOptionKeys
 	}
+	return executors.NewBunExecutor, executors.BunOptionKeys
+}
 
-	mainTs, err := os.ReadFile(*mainTsPath)
-	if err != nil {
-		logger.Fatal("Failed to read main.ts file", zap.Error(err))
+// mergeScopes returns scopes with the --scope and --scope-auth flags applied.
+func mergeScopes(scopes []models.ScopedPackageOptions, registries, auths []string) ([]models.ScopedPackageOptions, error) {
+	merged := slices.Clone(scopes)
+	find := func(scope string) *models.ScopedPackageOptions {
+		for i := range merged {
+			if merged[i].Scope == scope {
+				return &merged[i]
+			}
+		}
+		merged = append(merged, models.ScopedPackageOptions{Scope: scope})
+		return &merged[len(merged)-1]
 	}
-
-	// Set up context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Handle OS signals to gracefully shut down
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-stop
-		logger.Info("\nReceived interrupt signal, shutting down...")
-		cancel()
-	}()
-
-	app := synth.NewApp(executors.NewBunExecutor, logger)
-	app.Configure(ctx, models.AppConfig{
-		Dependencies:    depsMap,
-		DevDependencies: devDepsMap,
-	})
-	// prepare afero fs
-	dstFs := afero.NewOsFs()
-
-	// Execute the main.ts script
-	if err = app.Eval(ctx, dstFs, string(mainTs), *srcDir, *outDir); err != nil {
-		logger.Fatal("Failed to execute main.ts script", zap.Error(err))
+	for _, flag := range registries {
+		scope, url, ok := strings.Cut(flag, "=")
+		if !ok || scope == "" || url == "" {
+			return nil, fmt.Errorf("invalid --scope %q, expected @scope=url", flag)
+		}
+		find(scope).RegistryURL = url
+	}
+	for _, flag := range auths {
+		scope, envVar, ok := strings.Cut(flag, "=")
+		if !ok || scope == "" || envVar == "" {
+			return nil, fmt.Errorf("invalid --scope-auth %q, expected @scope=ENV_VAR", flag)
+		}
+		opts := find(scope)
+		opts.RequiresAuth = true
+		opts.AuthTokenEnvVar = &envVar
 	}
+	return merged, nil
 }
 
 // parseDependencies parses a comma-separated list of dependencies into a map.
@@ -95,3 +235,11 @@ func parseDependencies(deps string) map[string]string {
 	}
 	return depsMap
 }
+
+// mergeDependencies returns deps with the overrides applied.
+func mergeDependencies(deps, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(deps)+len(overrides))
+	maps.Copy(merged, deps)
+	maps.Copy(merged, overrides)
+	return merged
+}
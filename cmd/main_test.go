@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mergeScopes(t *testing.T) {
+	envVar := "NPM_TOKEN"
+	testCases := []struct {
+		name       string
+		scopes     []models.ScopedPackageOptions
+		registries []string
+		auths      []string
+		want       []models.ScopedPackageOptions
+		wantErr    string
+	}{
+		{
+			name:       "adds a scope",
+			registries: []string{"@acme=https://npm.acme.dev"},
+			auths:      []string{"@acme=NPM_TOKEN"},
+			want:       []models.ScopedPackageOptions{{Scope: "@acme", RegistryURL: "https://npm.acme.dev", RequiresAuth: true, AuthTokenEnvVar: &envVar}},
+		},
+		{
+			name:       "overrides the project file",
+			scopes:     []models.ScopedPackageOptions{{Scope: "@acme", RegistryURL: "https://old.acme.dev"}},
+			registries: []string{"@acme=https://npm.acme.dev"},
+			want:       []models.ScopedPackageOptions{{Scope: "@acme", RegistryURL: "https://npm.acme.dev"}},
+		},
+		{
+			name:       "invalid scope",
+			registries: []string{"@acme"},
+			wantErr:    `invalid --scope "@acme"`,
+		},
+		{
+			name:    "invalid scope auth",
+			auths:   []string{"@acme="},
+			wantErr: `invalid --scope-auth "@acme="`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mergeScopes(tc.scopes, tc.registries, tc.auths)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func Test_loadConfigIn(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "project/synth.yaml", []byte("executor: node\n"), 0644))
+	require.NoError(t, afero.WriteFile(fs, "other.yaml", []byte("executor: bun\nscopes: []\n"), 0644))
+	testCases := []struct {
+		name         string
+		dir          string
+		opts         globalOptions
+		wantExecutor string
+	}{
+		{name: "found in dir", dir: "project", wantExecutor: "node"},
+		{name: "config flag", dir: "project", opts: globalOptions{configPath: "other.yaml"}, wantExecutor: "bun"},
+		{name: "executor flag", dir: "project", opts: globalOptions{executor: "bun"}, wantExecutor: "bun"},
+		{name: "no project file", dir: "empty", wantExecutor: "bun"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configFile, err := tc.opts.loadConfigIn(fs, tc.dir)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantExecutor, configFile.Executor)
+		})
+	}
+}
+
+func Test_scaffold(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	created, err := scaffold(fs, "app", "node", false)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join("app", "main.ts"), filepath.Join("app", "synth.yaml")}, created)
+
+	data, err := afero.ReadFile(fs, filepath.Join("app", "synth.yaml"))
+	require.NoError(t, err)
+	configFile, err := models.ParseConfigFile(data, func(string) (string, bool) { return "", false })
+	require.NoError(t, err)
+	require.Equal(t, "node", configFile.Executor)
+	require.Contains(t, configFile.Dependencies, "cdktf")
+
+	_, err = scaffold(fs, "app", "bun", false)
+	require.ErrorContains(t, err, "already exists")
+	_, err = scaffold(fs, "app", "bun", true)
+	require.NoError(t, err)
+}
+
+func Test_clean(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	for _, dir := range []string{"cache/bun", "tmp/go-synth-bun123", "tmp/go-synth-node456", "tmp/go-synth-bun789/runs", "tmp/other"} {
+		require.NoError(t, fs.MkdirAll(dir, 0755))
+	}
+	for _, path := range []string{"tmp/go-synth-bun123", "tmp/go-synth-node456", "tmp/go-synth-bun789"} {
+		require.NoError(t, fs.Chtimes(path, old, old))
+	}
+	// a running session writes its run directories
+	require.NoError(t, fs.Chtimes("tmp/go-synth-bun789/runs", now, now))
+
+	removed, err := clean(fs, "cache", "tmp", 24*time.Hour, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cache", filepath.Join("tmp", "go-synth-bun123"), filepath.Join("tmp", "go-synth-node456")}, removed)
+	for _, dir := range []string{"other", "go-synth-bun789"} {
+		exists, err := afero.DirExists(fs, filepath.Join("tmp", dir))
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+
+	removed, err = clean(fs, "cache", "tmp", 0, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join("tmp", "go-synth-bun789")}, removed)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// printer writes the result of a command as text or as a single JSON document.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as JSON, or calls text with the writer.
+func (p *printer) print(v any, text func(w io.Writer)) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	text(p.w)
+	return nil
+}
+
+// error writes err as a JSON document to the output, or as text to stderr.
+func (p *printer) error(stderr io.Writer, err error) {
+	if p.json {
+		_ = p.print(map[string]string{"error": err.Error()}, nil)
+		return
+	}
+	fmt.Fprintln(stderr, "Error:", err)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/jobs"
+	"github.com/environment-toolkit/go-synth/server"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func newServeCmd(opts *globalOptions) *cobra.Command {
+	var httpAddr, grpcAddr, jobsDB, tokenFile string
+	var noAuth bool
+	var overrides []string
+	var maxConcurrent, jobWorkers, jobAttempts int
+	var maxRequestBytes int64
+	var drainTimeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve Configure and Eval over HTTP and gRPC",
+		Long: `Serve runs the synth service until SIGTERM or SIGINT, then drains the
+running requests. The --config project file is used until Configure is called.
+
+Requests must send the bearer token of --token-file, unless --no-auth is set.
+The scripts never get the whole host environment, request configs may not set
+env.allow, codeArtifact options, requiresAuth scopes or registries other than
+the public npm registry unless listed by --allow-override.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if httpAddr == "" && grpcAddr == "" {
+				return fmt.Errorf("at least one of --http or --grpc is required")
+			}
+			if tokenFile == "" && !noAuth {
+				return fmt.Errorf("--token-file is required, or --no-auth to serve unauthenticated requests")
+			}
+			allowed := make([]server.Override, 0, len(overrides))
+			for _, o := range overrides {
+				if o := server.Override(o); o != server.OverrideEnv && o != server.OverrideCodeArtifact && o != server.OverrideRegistries {
+					return fmt.Errorf("unknown --allow-override %q, expected %s, %s or %s", o, server.OverrideEnv, server.OverrideCodeArtifact, server.OverrideRegistries)
+				}
+				allowed = append(allowed, server.Override(o))
+			}
+			ctx, stop := context.WithCancel(cmd.Context())
+			defer stop()
+			logger := opts.logger
+			configFile, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			opts.withCache(configFile)
+			newExecutorFn, optionKeys := selectExecutor(configFile.Executor)
+			appOpts := opts.appOptions(optionKeys)
+
+			serverOpts := []server.Option{
+				server.WithAppOptions(appOpts...),
+				server.WithMaxRequestBytes(maxRequestBytes),
+				server.WithAllowedOverrides(allowed...),
+			}
+			if tokenFile != "" {
+				token, err := os.ReadFile(tokenFile)
+				if err != nil {
+					return fmt.Errorf("failed to read token file: %w", err)
+				}
+				if strings.TrimSpace(string(token)) == "" {
+					return fmt.Errorf("token file %s is empty", tokenFile)
+				}
+				serverOpts = append(serverOpts, server.WithBearerToken(strings.TrimSpace(string(token))))
+			}
+			if maxConcurrent > 0 {
+				serverOpts = append(serverOpts, server.WithMaxConcurrent(maxConcurrent))
+			}
+			if drainTimeout > 0 {
+				serverOpts = append(serverOpts, server.WithDrainTimeout(drainTimeout))
+			}
+
+			if jobsDB != "" {
+				store, err := jobs.OpenBoltStore(jobsDB)
+				if err != nil {
+					return fmt.Errorf("failed to open job store: %w", err)
+				}
+				defer store.Close()
+				runner := jobs.AppRunner(newExecutorFn, logger, server.RestrictEnv(configFile.AppConfig), appOpts...)
+				filter := func(req jobs.Request) (jobs.Request, error) {
+					if req.Config == nil {
+						return req, nil
+					}
+					if err := server.CheckOverrides(*req.Config, allowed...); err != nil {
+						return req, err
+					}
+					config := server.RestrictEnv(*req.Config)
+					req.Config = &config
+					return req, nil
+				}
+				jobOpts := []jobs.Option{jobs.WithWorkers(jobWorkers), jobs.WithRequestFilter(filter)}
+				if jobAttempts > 0 {
+					jobOpts = append(jobOpts, jobs.WithResume(jobAttempts))
+				}
+				manager := jobs.NewManager(store, runner, logger, jobOpts...)
+				if err := manager.Start(ctx); err != nil {
+					return fmt.Errorf("failed to start jobs: %w", err)
+				}
+				// the running jobs are queued again for the next start
+				defer manager.Wait()
+				defer stop()
+				jobsHandler := manager.Handler(maxRequestBytes)
+				serverOpts = append(serverOpts, server.WithHTTPHandler("/v1/jobs", jobsHandler), server.WithHTTPHandler("/v1/jobs/", jobsHandler))
+			}
+			srv := server.New(newExecutorFn, logger, serverOpts...)
+			if opts.configPath != "" {
+				if err := srv.Configure(ctx, configFile.AppConfig); err != nil {
+					return fmt.Errorf("failed to configure server: %w", err)
+				}
+			}
+
+			var httpLn, grpcLn net.Listener
+			if httpAddr != "" {
+				if httpLn, err = net.Listen("tcp", httpAddr); err != nil {
+					return fmt.Errorf("failed to listen on %s: %w", httpAddr, err)
+				}
+				logger.Info("Serving HTTP", zap.Stringer("addr", httpLn.Addr()))
+			}
+			if grpcAddr != "" {
+				if grpcLn, err = net.Listen("tcp", grpcAddr); err != nil {
+					if httpLn != nil {
+						httpLn.Close()
+					}
+					return fmt.Errorf("failed to listen on %s: %w", grpcAddr, err)
+				}
+				logger.Info("Serving gRPC", zap.Stringer("addr", grpcLn.Addr()))
+			}
+			if err := srv.Run(ctx, httpLn, grpcLn); err != nil {
+				return fmt.Errorf("server failed: %w", err)
+			}
+			logger.Info("Server stopped")
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&httpAddr, "http", ":8080", "HTTP listen address, empty to disable")
+	flags.StringVar(&grpcAddr, "grpc", ":9090", "gRPC listen address, empty to disable")
+	flags.IntVar(&maxConcurrent, "max-concurrent", 0, "Maximum number of concurrent Eval requests, 0 uses the number of CPUs")
+	flags.Int64Var(&maxRequestBytes, "max-request-bytes", 10<<20, "Maximum size of a request body or message")
+	flags.DurationVar(&drainTimeout, "drain-timeout", 0, "How long running requests may complete on shutdown, 0 uses 30s")
+	flags.StringVar(&tokenFile, "token-file", "", "File holding the bearer token of the requests")
+	flags.BoolVar(&noAuth, "no-auth", false, "Serve requests without a bearer token, e.g. behind an authenticating proxy")
+	flags.StringSliceVar(&overrides, "allow-override", nil, "Request config fields allowed: env, codeArtifact, registries")
+	flags.StringVar(&jobsDB, "jobs-db", "", "Path of the job store, enables the /v1/jobs API")
+	flags.IntVar(&jobWorkers, "job-workers", 1, "Number of jobs running at once")
+	flags.IntVar(&jobAttempts, "job-attempts", 0, "Resume the jobs interrupted by a crash up to this many attempts, 0 fails them")
+	return cmd
+}
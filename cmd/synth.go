@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/environment-toolkit/go-synth"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// synthResult is the json output of the synth command.
+type synthResult struct {
+	Out string `json:"out"`
+	// Files are the copied files, added, updated or unchanged.
+	Files []string `json:"files"`
+	// Copy lists the files by how the copy handled them.
+	Copy models.CopyResult `json:"copy"`
+	// Changes are only set in watch mode.
+	Changes    []fileChange `json:"changes,omitempty"`
+	DurationMs int64        `json:"durationMs"`
+}
+
+// newSynthResult returns the result of a run copying copied to out.
+func newSynthResult(out string, copied models.CopyResult, duration time.Duration) synthResult {
+	files := slices.Concat(copied.Added, copied.Updated, copied.Unchanged)
+	slices.Sort(files)
+	return synthResult{Out: out, Files: files, Copy: copied, DurationMs: duration.Milliseconds()}
+}
+
+// copySummary returns the counts of the copy result, empty if nothing was copied.
+func copySummary(copied models.CopyResult) string {
+	if len(copied.Added)+len(copied.Updated)+len(copied.Deleted)+len(copied.Unchanged) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d added, %d updated, %d deleted, %d unchanged)", len(copied.Added), len(copied.Updated), len(copied.Deleted), len(copied.Unchanged))
+}
+
+func newSynthCmd(opts *globalOptions) *cobra.Command {
+	var mainTsPath, dependencies, devDependencies, srcDir, outDir string
+	var locals []string
+	var watchMode bool
+	cmd := &cobra.Command{
+		Use:   "synth",
+		Short: "Synthesize a main.ts file into the output directory",
+		Long: `Synth installs the dependencies and synthesizes main.ts into --out.
+
+With --watch the dependencies are installed once and main.ts is synthesized
+again on every change of it or of a --local package, printing the changed files.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateLocals(locals); err != nil {
+				return err
+			}
+			configFile, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			opts.withCache(configFile)
+			config := configFile.AppConfig
+			config.Dependencies = mergeDependencies(config.Dependencies, parseDependencies(dependencies))
+			config.DevDependencies = mergeDependencies(config.DevDependencies, parseDependencies(devDependencies))
+			if len(locals) > 0 {
+				config.PreSetupFn = copyLocals(cmd.Context(), locals)
+			}
+
+			start := time.Now()
+			app := opts.newApp(configFile)
+			if err := app.Configure(cmd.Context(), config); err != nil {
+				return fmt.Errorf("failed to configure app: %w", err)
+			}
+			if watchMode {
+				return watch(cmd.Context(), opts, app, watchOptions{mainTsPath: mainTsPath, locals: locals, srcDir: srcDir, outDir: outDir})
+			}
+			mainTs, err := os.ReadFile(mainTsPath)
+			if err != nil {
+				return fmt.Errorf("failed to read main.ts file: %w", err)
+			}
+			evalResult := app.Run(cmd.Context(), synth.EvalRequest{Fs: afero.NewOsFs(), MainTs: string(mainTs), Src: srcDir, Dest: outDir})
+			if evalResult.Err != nil {
+				return fmt.Errorf("failed to execute main.ts script: %w", evalResult.Err)
+			}
+			duration := time.Since(start)
+			result := newSynthResult(outDir, evalResult.Copy, duration)
+			return opts.printer.print(result, func(w io.Writer) {
+				fmt.Fprintf(w, "Synthesized %d files to %s in %s%s\n", len(result.Files), outDir, duration.Round(time.Millisecond), copySummary(result.Copy))
+			})
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&mainTsPath, "file", "f", "", "Path to the main.ts file")
+	flags.StringVar(&dependencies, "deps", "", "Comma-separated list of dependencies in format 'pkg:version'")
+	flags.StringVar(&devDependencies, "devdeps", "", "Comma-separated list of devDependencies in format 'pkg:version'")
+	flags.StringVar(&srcDir, "src", "cdktf.out", "Source directory for synthesized files")
+	flags.StringVar(&outDir, "out", ".", "Output directory for synthesized files")
+	flags.StringArrayVar(&locals, "local", nil, "Local package directory copied to the same relative path before install, repeatable")
+	flags.BoolVarP(&watchMode, "watch", "w", false, "Synthesize again on every change of main.ts or a local package")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
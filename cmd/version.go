@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// versionResult is the json output of the version command.
+type versionResult struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+func newVersionCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result := versionResult{Version: version, GoVersion: runtime.Version()}
+			if info, ok := debug.ReadBuildInfo(); ok {
+				if result.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+					result.Version = info.Main.Version
+				}
+				for _, setting := range info.Settings {
+					if setting.Key == "vcs.revision" {
+						result.Commit = setting.Value
+					}
+				}
+			}
+			return opts.printer.print(result, func(w io.Writer) {
+				fmt.Fprintf(w, "synth %s", result.Version)
+				if result.Commit != "" {
+					fmt.Fprintf(w, " (%s)", result.Commit)
+				}
+				fmt.Fprintf(w, " %s\n", result.GoVersion)
+			})
+		},
+	}
+}
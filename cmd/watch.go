@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/environment-toolkit/go-synth"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+)
+
+// watchDebounce is how long the watcher waits for more changes before a run,
+// editors often write a file in several steps.
+const watchDebounce = 100 * time.Millisecond
+
+// localCopyOptions mirror a local package without its installed dependencies.
+var localCopyOptions = models.CopyOptions{Mode: models.CopySync, SkipDirs: []string{"node_modules"}}
+
+// fileChange is a file of the output directory changed by a run.
+type fileChange struct {
+	Path string `json:"path"`
+	// Change is one of added, modified or removed.
+	Change  string `json:"change"`
+	Added   int    `json:"added,omitempty"`
+	Removed int    `json:"removed,omitempty"`
+}
+
+// watchOptions are the synth flags used by watch.
+type watchOptions struct {
+	mainTsPath string
+	locals     []string
+	srcDir     string
+	outDir     string
+}
+
+// copyLocals returns a PreSetupFn copying the local package directories to
+// the same relative path of the working directory.
+func copyLocals(ctx context.Context, locals []string) func(e models.Executor) error {
+	return func(e models.Executor) error {
+		for _, dir := range locals {
+			if _, err := e.CopyFrom(ctx, afero.NewOsFs(), dir, dir, localCopyOptions); err != nil {
+				return fmt.Errorf("failed to copy local package %s: %w", dir, err)
+			}
+		}
+		return nil
+	}
+}
+
+// validateLocals checks the local package directories are inside the current directory.
+func validateLocals(locals []string) error {
+	for _, dir := range locals {
+		if !filepath.IsLocal(dir) {
+			return fmt.Errorf("invalid --local %q, expected a relative path inside the current directory", dir)
+		}
+	}
+	return nil
+}
+
+// watch prepares a Session once and synthesizes main.ts on every change of
+// it or of the local packages until ctx is done.
+//
+// Only the exec and copy phases run again, a changed local package is copied
+// to the working directory first. Failed runs are reported and watching goes on.
+func watch(ctx context.Context, opts *globalOptions, app synth.App, w watchOptions) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+	// editors replace main.ts on save, so its directory is watched
+	if err := watcher.Add(filepath.Dir(w.mainTsPath)); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", w.mainTsPath, err)
+	}
+	for _, dir := range w.locals {
+		if err := addWatchDirs(watcher, dir); err != nil {
+			return err
+		}
+	}
+
+	session, err := app.Prepare(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to install dependencies: %w", err)
+	}
+	defer func() {
+		if err := session.Close(context.Background()); err != nil {
+			opts.logger.Warn("Failed to clean up", zap.Error(err))
+		}
+	}()
+
+	dstFs := afero.NewOsFs()
+	previous := map[string][]byte{}
+	run := func(changedLocals map[string]bool) error {
+		for dir := range changedLocals {
+			if _, err := session.Executor().CopyFrom(ctx, afero.NewOsFs(), dir, dir, localCopyOptions); err != nil {
+				return fmt.Errorf("failed to copy local package %s: %w", dir, err)
+			}
+		}
+		mainTs, err := os.ReadFile(w.mainTsPath)
+		if err != nil {
+			return fmt.Errorf("failed to read main.ts file: %w", err)
+		}
+		start := time.Now()
+		evalResult := session.Run(ctx, synth.EvalRequest{Fs: dstFs, MainTs: string(mainTs), Src: w.srcDir, Dest: w.outDir})
+		if evalResult.Err != nil {
+			return fmt.Errorf("failed to execute main.ts script: %w", evalResult.Err)
+		}
+		current, err := readCopied(dstFs, w.outDir, evalResult.Copy)
+		if err != nil {
+			return err
+		}
+		changes := copyChanges(evalResult.Copy, previous, current)
+		previous = current
+		duration := time.Since(start)
+		result := newSynthResult(w.outDir, evalResult.Copy, duration)
+		result.Changes = changes
+		return opts.printer.print(result, func(out io.Writer) {
+			fmt.Fprintf(out, "Synthesized %d files to %s in %s, %d changed\n", len(result.Files), w.outDir, duration.Round(time.Millisecond), len(changes))
+			for _, c := range changes {
+				fmt.Fprintf(out, "  %s\n", c)
+			}
+		})
+	}
+	report := func(err error) {
+		if err != nil && ctx.Err() == nil {
+			opts.printer.error(os.Stderr, err)
+		}
+	}
+
+	report(run(nil))
+	mainTsPath := filepath.Clean(w.mainTsPath)
+	changedLocals := map[string]bool{}
+	pending := false
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			name := filepath.Clean(event.Name)
+			if name == mainTsPath {
+				pending = true
+			} else if dir, ok := localOf(w.locals, name); ok {
+				// new directories of a local package are watched too
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(name); err == nil && info.IsDir() {
+						report(addWatchDirs(watcher, name))
+					}
+				}
+				changedLocals[dir] = true
+				pending = true
+			}
+			if pending {
+				timer.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			opts.logger.Warn("Watch error", zap.Error(err))
+		case <-timer.C:
+			if !pending {
+				continue
+			}
+			report(run(changedLocals))
+			changedLocals = map[string]bool{}
+			pending = false
+		}
+	}
+}
+
+// addWatchDirs watches dir and its sub directories, fsnotify is not recursive.
+func addWatchDirs(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == "node_modules" {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// localOf returns the local package directory containing path.
+func localOf(locals []string, path string) (string, bool) {
+	for _, dir := range locals {
+		rel, err := filepath.Rel(filepath.Clean(dir), path)
+		if err == nil && filepath.IsLocal(rel) {
+			return dir, !slices.Contains(strings.Split(filepath.ToSlash(rel), "/"), "node_modules")
+		}
+	}
+	return "", false
+}
+
+// readCopied reads the files of dir the copy result lists as added, updated or unchanged.
+func readCopied(fs afero.Fs, dir string, result models.CopyResult) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, name := range slices.Concat(result.Added, result.Updated, result.Unchanged) {
+		content, err := afero.ReadFile(fs, filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+// copyChanges returns the files added, modified or removed by a run, by path.
+//
+// before holds the files copied by the previous run and after those copied by
+// this one, the updated files without a previous content have no line counts.
+// A file of the previous run no longer copied is removed, even if a merge copy
+// left it in the output directory.
+func copyChanges(result models.CopyResult, before, after map[string][]byte) []fileChange {
+	var changes []fileChange
+	paths := slices.Concat(result.Added, result.Updated)
+	slices.Sort(paths)
+	for _, path := range paths {
+		content := after[path]
+		old, ok := before[path]
+		switch {
+		case ok && bytes.Equal(old, content):
+		case ok:
+			added, removed := diffLines(old, content)
+			changes = append(changes, fileChange{Path: path, Change: "modified", Added: added, Removed: removed})
+		case slices.Contains(result.Added, path):
+			changes = append(changes, fileChange{Path: path, Change: "added", Added: countLines(content)})
+		default:
+			changes = append(changes, fileChange{Path: path, Change: "modified"})
+		}
+	}
+	deleted := slices.Clone(result.Deleted)
+	for path := range before {
+		if _, ok := after[path]; !ok && !slices.Contains(deleted, path) {
+			deleted = append(deleted, path)
+		}
+	}
+	slices.Sort(deleted)
+	for _, path := range deleted {
+		changes = append(changes, fileChange{Path: path, Change: "removed", Removed: countLines(before[path])})
+	}
+	return changes
+}
+
+// diffLines counts the lines only in after and only in before, ignoring their order.
+func diffLines(before, after []byte) (added, removed int) {
+	counts := map[string]int{}
+	for _, line := range strings.Split(string(before), "\n") {
+		counts[line]++
+	}
+	for _, line := range strings.Split(string(after), "\n") {
+		counts[line]--
+	}
+	for _, n := range counts {
+		if n < 0 {
+			added -= n
+		} else {
+			removed += n
+		}
+	}
+	return added, removed
+}
+
+func countLines(content []byte) int {
+	if len(content) == 0 {
+		return 0
+	}
+	n := bytes.Count(content, []byte("\n"))
+	if !bytes.HasSuffix(content, []byte("\n")) {
+		n++
+	}
+	return n
+}
+
+func (c fileChange) String() string {
+	marker := map[string]string{"added": "+", "modified": "~", "removed": "-"}[c.Change]
+	return fmt.Sprintf("%s %s (+%d -%d)", marker, c.Path, c.Added, c.Removed)
+}
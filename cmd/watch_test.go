@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_copyChanges(t *testing.T) {
+	before := map[string][]byte{
+		"stacks/a/cdk.tf.json": []byte("{\n  \"a\": 1\n}\n"),
+		"stacks/b/cdk.tf.json": []byte("{\n}\n"),
+		"manifest.json":        []byte("{}"),
+	}
+	after := map[string][]byte{
+		"stacks/a/cdk.tf.json": []byte("{\n  \"a\": 2,\n  \"b\": 3\n}\n"),
+		"stacks/c/cdk.tf.json": []byte("{\n}"),
+		"stacks/d/cdk.tf.json": []byte("{\n}"),
+		"manifest.json":        []byte("{}"),
+	}
+	result := models.CopyResult{
+		Added:   []string{"stacks/c/cdk.tf.json"},
+		Updated: []string{"stacks/d/cdk.tf.json", "stacks/a/cdk.tf.json", "manifest.json"},
+		Deleted: []string{"stacks/b/cdk.tf.json"},
+	}
+	require.Equal(t, []fileChange{
+		{Path: "stacks/a/cdk.tf.json", Change: "modified", Added: 2, Removed: 1},
+		{Path: "stacks/c/cdk.tf.json", Change: "added", Added: 2},
+		{Path: "stacks/d/cdk.tf.json", Change: "modified"},
+		{Path: "stacks/b/cdk.tf.json", Change: "removed", Removed: 2},
+	}, copyChanges(result, before, after))
+	require.Empty(t, copyChanges(models.CopyResult{Updated: []string{"manifest.json"}}, after, after))
+
+	// a merge copy does not delete the removed stacks
+	merged := models.CopyResult{Unchanged: []string{"manifest.json", "stacks/a/cdk.tf.json", "stacks/d/cdk.tf.json"}}
+	current := map[string][]byte{
+		"stacks/a/cdk.tf.json": after["stacks/a/cdk.tf.json"],
+		"stacks/d/cdk.tf.json": after["stacks/d/cdk.tf.json"],
+		"manifest.json":        after["manifest.json"],
+	}
+	require.Equal(t, []fileChange{
+		{Path: "stacks/c/cdk.tf.json", Change: "removed", Removed: 2},
+	}, copyChanges(merged, after, current))
+	require.Equal(t, "~ stacks/a/cdk.tf.json (+2 -1)", fileChange{Path: "stacks/a/cdk.tf.json", Change: "modified", Added: 2, Removed: 1}.String())
+}
+
+func Test_readCopied(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"out/a.json", "out/b/c.json", "out/other.txt"} {
+		require.NoError(t, afero.WriteFile(fs, name, []byte(name), 0644))
+	}
+	files, err := readCopied(fs, "out", models.CopyResult{Added: []string{"a.json"}, Unchanged: []string{"b/c.json"}, Deleted: []string{"d.json"}})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"a.json": []byte("out/a.json"), "b/c.json": []byte("out/b/c.json")}, files)
+}
+
+func Test_localOf(t *testing.T) {
+	locals := []string{"fixtures/cdktf-lib", "./lib"}
+	testCases := []struct {
+		path    string
+		wantDir string
+		wantOk  bool
+	}{
+		{path: filepath.Join("fixtures", "cdktf-lib", "index.ts"), wantDir: "fixtures/cdktf-lib", wantOk: true},
+		{path: filepath.Join("lib", "src", "index.ts"), wantDir: "./lib", wantOk: true},
+		{path: filepath.Join("lib", "node_modules", "cdktf"), wantDir: "./lib", wantOk: false},
+		{path: filepath.Join("fixtures", "other", "index.ts")},
+		{path: "main.ts"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			dir, ok := localOf(locals, tc.path)
+			require.Equal(t, tc.wantOk, ok)
+			if ok {
+				require.Equal(t, tc.wantDir, dir)
+			}
+		})
+	}
+}
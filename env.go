@@ -0,0 +1,65 @@
+package synth
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/environment-toolkit/go-synth/executors"
+	"github.com/environment-toolkit/go-synth/models"
+)
+
+// baseEnv returns the environment shared by the install and exec phases.
+func baseEnv(config models.AppConfig, environ []string) (map[string]string, error) {
+	mode := config.Env.Mode
+	if mode == "" {
+		mode = models.EnvInherit
+		if config.EnvVars != nil {
+			mode = models.EnvExplicit
+		}
+	}
+
+	env := map[string]string{}
+	switch mode {
+	case models.EnvInherit:
+		env = executors.EnvMap(environ)
+	case models.EnvAllowlist:
+		allow := config.Env.Allow
+		if len(allow) == 0 {
+			allow = models.DefaultEnvAllowlist
+		}
+		for k, v := range executors.EnvMap(environ) {
+			if isAllowed(k, allow) {
+				env[k] = v
+			}
+		}
+	case models.EnvExplicit:
+	default:
+		return nil, fmt.Errorf("unknown env mode: %q", mode)
+	}
+	maps.Copy(env, config.EnvVars)
+	return env, nil
+}
+
+// isAllowed reports whether name matches one of the allowlist entries.
+func isAllowed(name string, allow []string) bool {
+	for _, entry := range allow {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if name == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// withEnv returns a copy of env with overrides applied.
+func withEnv(env, overrides map[string]string) map[string]string {
+	merged := maps.Clone(env)
+	maps.Copy(merged, overrides)
+	return merged
+}
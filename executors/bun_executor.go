@@ -3,7 +3,10 @@ package executors
 import (
 	"context"
 	"fmt"
+	"io"
 	"maps"
+	"os"
+	"path/filepath"
 
 	"github.com/environment-toolkit/go-synth/models"
 	"github.com/spf13/afero"
@@ -16,11 +19,37 @@ type bunExecutor struct {
 	workingDir string
 	templates  *templateStore
 	logger     *zap.Logger
+	options    BunOptions
+	output     io.Writer
+	entrypoint string
+	// installed is the merged config of the last Setup.
+	installed *models.AppConfig
+	// worker runs the scripts when BunOptions.Worker is set.
+	worker *bunWorker
+}
+
+// bunTemplateData is passed to the resources/bun templates.
+type bunTemplateData struct {
+	models.AppConfig
+	Options BunOptions
 }
 
 // NewBunExecutor creates a new instance of BunExecutor.
-func NewBunExecutor(logger *zap.Logger) (models.Executor, error) {
-	fs, workingDir, e := newTempFs("go-synth-bun")
+func NewBunExecutor(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+	return newBunExecutor(logger, BunOptions{}, models.NewExecutorSettings(opts...))
+}
+
+// NewBunExecutorWithOptions returns a NewExecutorFn creating Bun executors with opts.
+//
+// AppConfig.ExecutorOptions keys still take precedence over opts.
+func NewBunExecutorWithOptions(opts BunOptions) models.NewExecutorFn {
+	return func(logger *zap.Logger, settings ...models.ExecutorOption) (models.Executor, error) {
+		return newBunExecutor(logger, opts, models.NewExecutorSettings(settings...))
+	}
+}
+
+func newBunExecutor(logger *zap.Logger, opts BunOptions, settings models.ExecutorSettings) (models.Executor, error) {
+	fs, workingDir, e := newTempFs(settings.TempDir, "go-synth-bun")
 	if e != nil {
 		return nil, fmt.Errorf("error creating Bun Exector temp fs: %w", e)
 	}
@@ -29,10 +58,35 @@ func NewBunExecutor(logger *zap.Logger) (models.Executor, error) {
 		templates:  initializeTemplates(logger, "resources/bun"),
 		fs:         fs,
 		workingDir: workingDir,
+		options:    opts,
+		output:     settings.Output,
+		entrypoint: resolveBunEntrypoint(opts),
 	}, nil
 }
 
+// resolveBunEntrypoint returns the bun binary used before Setup resolved the options.
+func resolveBunEntrypoint(opts BunOptions) string {
+	if opts.Entrypoint != "" {
+		return opts.Entrypoint
+	}
+	return DefaultBunOptions().Entrypoint
+}
+
+// resolveOptions returns the defaults overridden by the constructor options and the ExecutorOptions.
+func (be *bunExecutor) resolveOptions(conf models.AppConfig) (BunOptions, error) {
+	opts := DefaultBunOptions()
+	mergeOptions(opts.fields(), be.options.fields(), be.options.explicit)
+	if err := decodeOptions(conf.ExecutorOptions, opts.fields()); err != nil {
+		return opts, err
+	}
+	return opts, opts.Validate()
+}
+
 func (be *bunExecutor) Setup(ctx context.Context, conf models.AppConfig, envVars map[string]string) error {
+	opts, err := be.resolveOptions(conf)
+	if err != nil {
+		return err
+	}
 	merged := models.AppConfig{
 		Dependencies: map[string]string{
 			"cdktf": "^0.20.7",
@@ -42,50 +96,116 @@ func (be *bunExecutor) Setup(ctx context.Context, conf models.AppConfig, envVars
 	}
 	maps.Copy(merged.Dependencies, conf.Dependencies)
 	maps.Copy(merged.DevDependencies, conf.DevDependencies)
+	be.installed = nil
+	be.entrypoint = opts.Entrypoint
+	workerOpts := opts.worker()
+	// a worker started before would keep the previous dependencies loaded
+	be.stopWorker(false)
 
-	if err := be.templates.setupFs(ctx, be.fs, merged); err != nil {
+	data := bunTemplateData{
+		AppConfig: merged,
+		Options:   opts,
+	}
+	if err := be.templates.setupFs(ctx, be.fs, data); err != nil {
 		return err
 	}
 	options := &runCommandOptions{
 		workingDir: be.workingDir,
-		entrypoint: "bun",
+		entrypoint: be.entrypoint,
 		envVars:    envVars,
 		logger:     be.logger,
+		output:     be.output,
 	}
 	if err := runCommand(ctx, options, "install"); err != nil {
 		return fmt.Errorf("error running bun install: %w", err)
 	}
+	be.installed = &merged
+	if workerOpts.enabled {
+		if err := writeWorkerScript(be.fs); err != nil {
+			return fmt.Errorf("error writing bun worker script: %w", err)
+		}
+		be.worker = &bunWorker{
+			logger:     be.logger,
+			workingDir: be.workingDir,
+			entrypoint: be.entrypoint,
+			output:     be.output,
+			maxJobs:    workerOpts.maxJobs,
+			maxRSS:     workerOpts.maxRSS,
+		}
+	}
 	return nil
 }
 
+// stopWorker stops the worker started by Setup, if any.
+func (be *bunExecutor) stopWorker(kill bool) {
+	if be.worker != nil {
+		be.worker.stop(kill)
+		be.worker = nil
+	}
+}
+
 // Exec runs the main.ts script using bun.sh
 func (be *bunExecutor) Exec(ctx context.Context, mainTS string, envVars map[string]string) error {
-	if err := afero.WriteFile(be.fs, "main.ts", []byte(mainTS), 0775); err != nil {
+	return be.ExecIn(ctx, ".", mainTS, envVars)
+}
+
+// ExecIn runs the main.ts script in dir using bun.sh, bun resolves the
+// dependencies from the parent node_modules.
+func (be *bunExecutor) ExecIn(ctx context.Context, dir, mainTS string, envVars map[string]string) error {
+	if err := be.fs.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+	if err := afero.WriteFile(be.fs, filepath.Join(dir, "main.ts"), []byte(mainTS), 0775); err != nil {
 		return err
 	}
+	if be.worker != nil {
+		return be.worker.run(ctx, filepath.Join(be.workingDir, dir), envVars)
+	}
 	options := &runCommandOptions{
-		workingDir: be.workingDir,
-		entrypoint: "bun",
+		workingDir: filepath.Join(be.workingDir, dir),
+		entrypoint: be.entrypoint,
 		envVars:    envVars,
 		logger:     be.logger,
+		output:     be.output,
 	}
 	if err := runCommand(ctx, options, "run", "main.ts"); err != nil {
-		return fmt.Errorf("error running bun install: %w", err)
+		return fmt.Errorf("error running main.ts: %w", err)
 	}
 	return nil
 }
 
-func (be *bunExecutor) CopyTo(ctx context.Context, srcDir string, dstFs afero.Fs, dstDir string, opts models.CopyOptions) error {
+func (be *bunExecutor) RemoveDir(ctx context.Context, dir string) error {
+	return removeDir(be.fs, dir)
+}
+
+func (be *bunExecutor) CopyTo(ctx context.Context, srcDir string, dstFs afero.Fs, dstDir string, opts models.CopyOptions) (models.CopyResult, error) {
 	return copyDir(be.logger, srcDir, dstDir, be.fs, dstFs, opts)
 }
 
-func (be *bunExecutor) CopyFrom(ctx context.Context, srcFs afero.Fs, srcDir, dstDir string, opts models.CopyOptions) error {
+func (be *bunExecutor) CopyFrom(ctx context.Context, srcFs afero.Fs, srcDir, dstDir string, opts models.CopyOptions) (models.CopyResult, error) {
 	return copyDir(be.logger, srcDir, dstDir, srcFs, be.fs, opts)
 }
 
+func (be *bunExecutor) ArchiveTo(ctx context.Context, srcDir string, w io.Writer, format models.ArchiveFormat, opts models.CopyOptions) (models.CopyResult, error) {
+	return archiveDir(be.logger, srcDir, be.fs, w, format, opts)
+}
+
+func (be *bunExecutor) Name() string {
+	return "bun"
+}
+
+func (be *bunExecutor) OptionKeys() []string {
+	return BunOptionKeys
+}
+
+func (be *bunExecutor) InstalledDependencies(ctx context.Context) (map[string]string, error) {
+	return installedVersions(be.fs, be.installed)
+}
+
 func (be *bunExecutor) Cleanup(ctx context.Context) error {
 	be.logger.Debug("Cleaning up Bun Executor")
-	if err := be.fs.RemoveAll(be.workingDir); err != nil {
+	be.stopWorker(true)
+	if err := os.RemoveAll(be.workingDir); err != nil {
 		return err
 	}
 	return nil
@@ -54,7 +54,7 @@ func Test_bunExecutor_Fixtures(t *testing.T) {
 	envVars := EnvMap(os.Environ())
 
 	fixtureFs := afero.NewBasePathFs(afero.NewOsFs(), "../fixtures")
-	if err := be.CopyFrom(ctx, fixtureFs, "cdktf-lib", "./fixtures/cdktf-lib", models.CopyOptions{
+	if _, err := be.CopyFrom(ctx, fixtureFs, "cdktf-lib", "./fixtures/cdktf-lib", models.CopyOptions{
 		SkipDirs: []string{"node_modules"},
 	}); err != nil {
 		t.Fatalf("CopyFrom failed: %v", err)
@@ -79,6 +79,18 @@ func Test_bunExecutor_Fixtures(t *testing.T) {
 	snapshotFs(t, "bun_fixtures", "cdktf.out", be.fs)
 }
 
+func Test_bunExecutor_Cleanup(t *testing.T) {
+	tempDir := t.TempDir()
+	e, err := NewBunExecutor(getPrettyLogger(), models.WithTempDir(tempDir))
+	require.NoError(t, err)
+	be := e.(*bunExecutor)
+	require.Equal(t, tempDir, filepath.Dir(be.workingDir))
+
+	require.NoError(t, be.Cleanup(context.Background()))
+	_, err = os.Stat(be.workingDir)
+	require.True(t, os.IsNotExist(err), "working dir should be removed")
+}
+
 // takeSnapshot reads the directory contents and returns a map of paths and file contents
 func snapshotFs(t *testing.T, name, root string, fs afero.Fs) error {
 	snapsConf := snaps.WithConfig(snaps.Filename(name))
@@ -0,0 +1,228 @@
+package executors
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+)
+
+// workerScript is where Setup writes the worker script, relative to the working directory.
+const workerScript = ".go-synth/worker.ts"
+
+// errWorkerExited is returned for the job running when the worker process exits.
+var errWorkerExited = errors.New("bun worker exited")
+
+// workerJob is a synth job sent to the worker stdin.
+type workerJob struct {
+	ID  uint64 `json:"id"`
+	Dir string `json:"dir"`
+	// Env is always sent, an empty map runs the job without environment variables.
+	Env map[string]string `json:"env"`
+}
+
+// workerResponse is written by the worker to fd 3 once a job is done.
+type workerResponse struct {
+	ID    uint64 `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// RSS is the resident set size of the worker in bytes.
+	RSS int64 `json:"rss"`
+}
+
+// bunWorker is a resident bun process running the jobs of a bunExecutor one at a time.
+//
+// The process is started by the first job and restarted after it crashed, ran
+// maxJobs jobs or grew over maxRSS bytes.
+type bunWorker struct {
+	logger     *zap.Logger
+	workingDir string
+	entrypoint string
+	output     io.Writer
+	maxJobs    int
+	maxRSS     int64
+
+	mu     sync.Mutex
+	proc   *workerProcess
+	nextID uint64
+	// running is proc, readable without waiting for the running job.
+	running atomic.Pointer[workerProcess]
+}
+
+// workerProcess is a running worker.
+type workerProcess struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	respR     *os.File
+	responses *bufio.Scanner
+	streams   sync.WaitGroup
+	jobs      int
+}
+
+// writeWorkerScript writes the embedded worker script to the working directory.
+func writeWorkerScript(fs afero.Fs) error {
+	return copyFile(afero.FromIOFS{FS: embeddedFiles}, fs, "resources/worker/worker.ts", workerScript)
+}
+
+// run runs the main.ts in dir, an absolute path, and waits for the result.
+func (w *bunWorker) run(ctx context.Context, dir string, envVars map[string]string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.proc == nil {
+		proc, err := w.start(envVars)
+		if err != nil {
+			return err
+		}
+		w.proc = proc
+		w.running.Store(proc)
+	}
+	w.nextID++
+	if envVars == nil {
+		envVars = map[string]string{}
+	}
+	job := workerJob{ID: w.nextID, Dir: dir, Env: envVars}
+	resp, err := w.send(ctx, job)
+	if err != nil {
+		// the worker state is unknown, the next job starts a new one
+		w.stopLocked()
+		return err
+	}
+	w.proc.jobs++
+	if w.maxJobs > 0 && w.proc.jobs >= w.maxJobs {
+		w.logger.Debug("restarting bun worker", zap.Int("jobs", w.proc.jobs))
+		w.stopLocked()
+	} else if w.maxRSS > 0 && resp.RSS > w.maxRSS {
+		w.logger.Debug("restarting bun worker", zap.Int64("rss", resp.RSS))
+		w.stopLocked()
+	}
+	if !resp.OK {
+		return fmt.Errorf("error running main.ts in bun worker: %s", resp.Error)
+	}
+	return nil
+}
+
+// send writes job to the worker and waits for its response.
+func (w *bunWorker) send(ctx context.Context, job workerJob) (workerResponse, error) {
+	line, err := json.Marshal(job)
+	if err != nil {
+		return workerResponse{}, err
+	}
+	if _, err := w.proc.stdin.Write(append(line, '\n')); err != nil {
+		return workerResponse{}, fmt.Errorf("error sending job to bun worker: %w", err)
+	}
+
+	done := make(chan error, 1)
+	var resp workerResponse
+	go func() {
+		if !w.proc.responses.Scan() {
+			done <- errors.Join(errWorkerExited, w.proc.responses.Err())
+			return
+		}
+		done <- json.Unmarshal(w.proc.responses.Bytes(), &resp)
+	}()
+	select {
+	case <-ctx.Done():
+		// a running import can not be interrupted, kill the worker
+		w.proc.kill()
+		<-done
+		return resp, ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return resp, err
+		}
+	}
+	if resp.ID != job.ID {
+		return resp, fmt.Errorf("unexpected bun worker response for job %d, expected %d", resp.ID, job.ID)
+	}
+	return resp, nil
+}
+
+// start starts a worker process with envVars.
+func (w *bunWorker) start(envVars map[string]string) (*workerProcess, error) {
+	respR, respW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating bun worker pipe: %w", err)
+	}
+	// the worker is not bound to the context of the job starting it
+	cmd := exec.Command(w.entrypoint, "run", workerScript)
+	cmd.Dir = w.workingDir
+	cmd.Env = formatEnvVars(envVars)
+	cmd.ExtraFiles = []*os.File{respW}
+
+	// bound the wait for the output of processes spawned by the worker
+	cmd.WaitDelay = time.Second
+
+	proc := &workerProcess{cmd: cmd, respR: respR, responses: bufio.NewScanner(respR)}
+	proc.responses.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if proc.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, errors.Join(fmt.Errorf("error creating stdin pipe: %w", err), respR.Close(), respW.Close())
+	}
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error creating stdout pipe: %w", err), respR.Close(), respW.Close())
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error creating stderr pipe: %w", err), respR.Close(), respW.Close())
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Join(fmt.Errorf("error starting bun worker: %w", err), respR.Close(), respW.Close())
+	}
+	// the child holds its own copy, closing ours lets reads end when it exits
+	respW.Close()
+	w.logger.Debug("started bun worker", zap.Int("pid", cmd.Process.Pid))
+
+	output := newLineWriter(w.output)
+	proc.streams.Add(2)
+	go streamOutput(w.logger, output, &proc.streams, stdoutPipe, zap.InfoLevel)
+	go streamOutput(w.logger, output, &proc.streams, stderrPipe, zap.WarnLevel)
+	go func() {
+		proc.streams.Wait()
+		if err := cmd.Wait(); err != nil {
+			w.logger.Debug("bun worker exited", zap.Error(err))
+		}
+		respR.Close()
+	}()
+	return proc, nil
+}
+
+// kill kills the process and stops reading its responses.
+func (p *workerProcess) kill() {
+	_ = p.cmd.Process.Kill()
+	// processes spawned by the worker may hold the response pipe open
+	p.respR.Close()
+}
+
+// stop stops the worker process if it is running, kill does not wait for the running job.
+func (w *bunWorker) stop(kill bool) {
+	if proc := w.running.Load(); kill && proc != nil {
+		proc.kill()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopLocked()
+}
+
+// stopLocked closes the worker stdin, which ends its job loop, and waits for it to exit.
+func (w *bunWorker) stopLocked() {
+	if w.proc == nil {
+		return
+	}
+	proc := w.proc
+	w.proc = nil
+	w.running.Store(nil)
+	proc.stdin.Close()
+	// drain the responses until the process exited
+	for proc.responses.Scan() {
+	}
+}
@@ -0,0 +1,131 @@
+package executors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWorker emulates the worker protocol, the main.ts of a job selects the outcome.
+const fakeWorker = `#!/bin/sh
+while read -r line; do
+	id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+	dir=$(echo "$line" | sed 's/.*"dir":"\([^"]*\)".*/\1/')
+	case "$(cat "$dir/main.ts")" in
+	crash) exit 1 ;;
+	sleep) sleep 10 ;;
+	fail) echo "{\"id\":$id,\"ok\":false,\"error\":\"synth failed\",\"rss\":100}" >&3 ;;
+	*)
+		echo $$ > "$dir/pid"
+		echo "{\"id\":$id,\"ok\":true,\"rss\":100}" >&3
+		;;
+	esac
+done
+`
+
+func newTestWorker(t *testing.T, maxJobs int, maxRSS int64) *bunWorker {
+	dir := t.TempDir()
+	entrypoint := filepath.Join(dir, "bun")
+	require.NoError(t, os.WriteFile(entrypoint, []byte(fakeWorker), 0755))
+	w := &bunWorker{
+		logger:     getPrettyLogger(),
+		workingDir: dir,
+		entrypoint: entrypoint,
+		maxJobs:    maxJobs,
+		maxRSS:     maxRSS,
+	}
+	t.Cleanup(func() { w.stop(true) })
+	return w
+}
+
+// runJob runs mainTS in a new directory of the worker and returns the worker pid.
+func runJob(t *testing.T, ctx context.Context, w *bunWorker, mainTS string) (string, error) {
+	dir, err := os.MkdirTemp(w.workingDir, "run")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.ts"), []byte(mainTS), 0644))
+	if err := w.run(ctx, dir, map[string]string{"PATH": os.Getenv("PATH")}); err != nil {
+		return "", err
+	}
+	pid, err := os.ReadFile(filepath.Join(dir, "pid"))
+	require.NoError(t, err)
+	return string(pid), nil
+}
+
+func Test_bunWorker_restart(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name    string
+		maxJobs int
+		maxRSS  int64
+		// scripts are run in order, a new pid is expected after each index of restarts
+		scripts  []string
+		restarts []int
+		errs     map[int]string
+	}{
+		{
+			name:     "reuse",
+			scripts:  []string{"a", "b", "c"},
+			restarts: nil,
+		},
+		{
+			name:     "max jobs",
+			maxJobs:  2,
+			scripts:  []string{"a", "b", "c"},
+			restarts: []int{2},
+		},
+		{
+			name:     "max rss",
+			maxRSS:   10,
+			scripts:  []string{"a", "b"},
+			restarts: []int{1},
+		},
+		{
+			name:     "crash",
+			scripts:  []string{"a", "crash", "b"},
+			restarts: []int{2},
+			errs:     map[int]string{1: errWorkerExited.Error()},
+		},
+		{
+			name:     "script error keeps the worker",
+			scripts:  []string{"a", "fail", "b"},
+			restarts: nil,
+			errs:     map[int]string{1: "synth failed"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newTestWorker(t, tc.maxJobs, tc.maxRSS)
+			var pids []string
+			for i, script := range tc.scripts {
+				pid, err := runJob(t, ctx, w, script)
+				if msg, ok := tc.errs[i]; ok {
+					require.ErrorContains(t, err, msg)
+					continue
+				}
+				require.NoError(t, err)
+				pids = append(pids, pid)
+			}
+			distinct := map[string]bool{}
+			for _, pid := range pids {
+				distinct[pid] = true
+			}
+			require.Len(t, distinct, len(tc.restarts)+1, fmt.Sprintf("pids %v", pids))
+		})
+	}
+}
+
+func Test_bunWorker_cancel(t *testing.T) {
+	w := newTestWorker(t, 0, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := runJob(t, ctx, w, "sleep")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = runJob(t, context.Background(), w, "a")
+	require.NoError(t, err)
+}
@@ -2,8 +2,12 @@ package executors
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"maps"
+	"os"
+	"path/filepath"
 
 	"github.com/environment-toolkit/go-synth/models"
 	"github.com/spf13/afero"
@@ -16,12 +20,37 @@ type nodeExecutor struct {
 	workingDir string
 	templates  *templateStore
 	logger     *zap.Logger
+	options    NodeOptions
+	output     io.Writer
 	entrypoint string
+	// installed is the merged config of the last Setup.
+	installed *models.AppConfig
+	// synthScript is resolved by Setup and reused by ExecIn.
+	synthScript string
+}
+
+// nodeTemplateData is passed to the resources/node templates.
+type nodeTemplateData struct {
+	models.AppConfig
+	Options NodeOptions
 }
 
 // NewNodeExecutor creates a new instance of nodeExecutor.
-func NewNodeExecutor(logger *zap.Logger) (models.Executor, error) {
-	fs, workingDir, e := newTempFs("go-synth-node")
+func NewNodeExecutor(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+	return newNodeExecutor(logger, NodeOptions{}, models.NewExecutorSettings(opts...))
+}
+
+// NewNodeExecutorWithOptions returns a NewExecutorFn creating Node executors with opts.
+//
+// AppConfig.ExecutorOptions keys still take precedence over opts.
+func NewNodeExecutorWithOptions(opts NodeOptions) models.NewExecutorFn {
+	return func(logger *zap.Logger, settings ...models.ExecutorOption) (models.Executor, error) {
+		return newNodeExecutor(logger, opts, models.NewExecutorSettings(settings...))
+	}
+}
+
+func newNodeExecutor(logger *zap.Logger, opts NodeOptions, settings models.ExecutorSettings) (models.Executor, error) {
+	fs, workingDir, e := newTempFs(settings.TempDir, "go-synth-node")
 	if e != nil {
 		return nil, fmt.Errorf("error creating Node Exector temp fs: %w", e)
 	}
@@ -30,10 +59,35 @@ func NewNodeExecutor(logger *zap.Logger) (models.Executor, error) {
 		templates:  initializeTemplates(logger, "resources/node"),
 		fs:         fs,
 		workingDir: workingDir,
+		options:    opts,
+		output:     settings.Output,
+		entrypoint: resolveNodeEntrypoint(opts),
 	}, nil
 }
 
+// resolveNodeEntrypoint returns the package manager used before Setup resolved the options.
+func resolveNodeEntrypoint(opts NodeOptions) string {
+	if opts.Entrypoint != "" {
+		return opts.Entrypoint
+	}
+	return DefaultNodeOptions().Entrypoint
+}
+
+// resolveOptions returns the defaults overridden by the constructor options and the ExecutorOptions.
+func (be *nodeExecutor) resolveOptions(conf models.AppConfig) (NodeOptions, error) {
+	opts := DefaultNodeOptions()
+	mergeOptions(opts.fields(), be.options.fields(), be.options.explicit)
+	if err := decodeOptions(conf.ExecutorOptions, opts.fields()); err != nil {
+		return opts, err
+	}
+	return opts, opts.Validate()
+}
+
 func (be *nodeExecutor) Setup(ctx context.Context, conf models.AppConfig, envVars map[string]string) error {
+	opts, err := be.resolveOptions(conf)
+	if err != nil {
+		return err
+	}
 	merged := models.AppConfig{
 		Dependencies: map[string]string{
 			"cdktf": "^0.20.7",
@@ -43,20 +97,19 @@ func (be *nodeExecutor) Setup(ctx context.Context, conf models.AppConfig, envVar
 			"ts-node":    "^10.9.2",
 			"@swc/core":  "^1.7.6",
 		},
-		ExecutorOptions: map[string]string{
-			"nodeVersion":    ">=18.0.0",
-			"packageManager": "pnpm@9.0.2",
-			"entrypoint":     "pnpm",
-			"synthScript":    "ts-node --swc -P ./tsconfig.json main.ts",
-		},
 		Scopes: []models.ScopedPackageOptions{},
 	}
 	maps.Copy(merged.Dependencies, conf.Dependencies)
 	maps.Copy(merged.DevDependencies, conf.DevDependencies)
-	maps.Copy(merged.ExecutorOptions, conf.ExecutorOptions)
-	be.entrypoint = merged.ExecutorOptions["entrypoint"]
+	be.installed = nil
+	be.entrypoint = opts.Entrypoint
+	be.synthScript = opts.SynthScript
 
-	if err := be.templates.setupFs(ctx, be.fs, merged); err != nil {
+	data := nodeTemplateData{
+		AppConfig: merged,
+		Options:   opts,
+	}
+	if err := be.templates.setupFs(ctx, be.fs, data); err != nil {
 		return err
 	}
 
@@ -65,23 +118,52 @@ func (be *nodeExecutor) Setup(ctx context.Context, conf models.AppConfig, envVar
 		entrypoint: be.entrypoint,
 		envVars:    envVars,
 		logger:     be.logger,
+		output:     be.output,
 	}
 	if err := runCommand(ctx, options, "install"); err != nil {
 		return fmt.Errorf("error running %s install: %w", be.entrypoint, err)
 	}
+	be.installed = &merged
 	return nil
 }
 
 // Exec runs the main.ts script using ts-node.
 func (be *nodeExecutor) Exec(ctx context.Context, mainTS string, envVars map[string]string) error {
-	if err := afero.WriteFile(be.fs, "main.ts", []byte(mainTS), 0775); err != nil {
+	return be.ExecIn(ctx, ".", mainTS, envVars)
+}
+
+// ExecIn runs the main.ts script in dir using ts-node.
+//
+// Sub directories get their own package.json and tsconfig.json, the binaries
+// installed by Setup are added to the PATH.
+func (be *nodeExecutor) ExecIn(ctx context.Context, dir, mainTS string, envVars map[string]string) error {
+	if err := be.fs.MkdirAll(dir, 0775); err != nil {
 		return err
 	}
+	if err := afero.WriteFile(be.fs, filepath.Join(dir, "main.ts"), []byte(mainTS), 0775); err != nil {
+		return err
+	}
+	if filepath.Clean(dir) != "." {
+		if err := be.prepareRunDir(dir); err != nil {
+			return err
+		}
+		envVars = maps.Clone(envVars)
+		if envVars == nil {
+			envVars = map[string]string{}
+		}
+		bin := filepath.Join(be.workingDir, "node_modules", ".bin")
+		if path, ok := envVars["PATH"]; ok && path != "" {
+			envVars["PATH"] = bin + string(os.PathListSeparator) + path
+		} else {
+			envVars["PATH"] = bin
+		}
+	}
 	options := &runCommandOptions{
-		workingDir: be.workingDir,
+		workingDir: filepath.Join(be.workingDir, dir),
 		entrypoint: be.entrypoint,
 		envVars:    envVars,
 		logger:     be.logger,
+		output:     be.output,
 	}
 	if err := runCommand(ctx, options, "run", "synth"); err != nil {
 		return fmt.Errorf("error running synthScript: %w", err)
@@ -89,17 +171,53 @@ func (be *nodeExecutor) Exec(ctx context.Context, mainTS string, envVars map[str
 	return nil
 }
 
-func (be *nodeExecutor) CopyTo(ctx context.Context, srcDir string, dstFs afero.Fs, dstDir string, opts models.CopyOptions) error {
+// prepareRunDir writes the package.json and tsconfig.json needed to run the synth script in dir.
+func (be *nodeExecutor) prepareRunDir(dir string) error {
+	pkg, err := json.MarshalIndent(map[string]any{
+		"name":    "go-synth-run",
+		"private": true,
+		"scripts": map[string]string{"synth": be.synthScript},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := afero.WriteFile(be.fs, filepath.Join(dir, "package.json"), pkg, 0664); err != nil {
+		return err
+	}
+	return copyFile(be.fs, be.fs, "tsconfig.json", filepath.Join(dir, "tsconfig.json"))
+}
+
+func (be *nodeExecutor) RemoveDir(ctx context.Context, dir string) error {
+	return removeDir(be.fs, dir)
+}
+
+func (be *nodeExecutor) CopyTo(ctx context.Context, srcDir string, dstFs afero.Fs, dstDir string, opts models.CopyOptions) (models.CopyResult, error) {
 	return copyDir(be.logger, srcDir, dstDir, be.fs, dstFs, opts)
 }
 
-func (be *nodeExecutor) CopyFrom(ctx context.Context, srcFs afero.Fs, srcDir, dstDir string, opts models.CopyOptions) error {
+func (be *nodeExecutor) CopyFrom(ctx context.Context, srcFs afero.Fs, srcDir, dstDir string, opts models.CopyOptions) (models.CopyResult, error) {
 	return copyDir(be.logger, srcDir, dstDir, srcFs, be.fs, opts)
 }
 
+func (be *nodeExecutor) ArchiveTo(ctx context.Context, srcDir string, w io.Writer, format models.ArchiveFormat, opts models.CopyOptions) (models.CopyResult, error) {
+	return archiveDir(be.logger, srcDir, be.fs, w, format, opts)
+}
+
+func (be *nodeExecutor) Name() string {
+	return "node"
+}
+
+func (be *nodeExecutor) OptionKeys() []string {
+	return NodeOptionKeys
+}
+
+func (be *nodeExecutor) InstalledDependencies(ctx context.Context) (map[string]string, error) {
+	return installedVersions(be.fs, be.installed)
+}
+
 func (be *nodeExecutor) Cleanup(ctx context.Context) error {
 	be.logger.Debug("Cleaning up Node Executor")
-	if err := be.fs.RemoveAll(be.workingDir); err != nil {
+	if err := os.RemoveAll(be.workingDir); err != nil {
 		return err
 	}
 	return nil
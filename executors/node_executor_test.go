@@ -30,7 +30,7 @@ func Test_nodeExecutor_Fixtures(t *testing.T) {
 
 	fixtureFs := afero.NewBasePathFs(afero.NewOsFs(), "../fixtures")
 	// copy in local package
-	if err := be.CopyFrom(ctx, fixtureFs, "cdktf-lib", "./fixtures/cdktf-lib", models.CopyOptions{
+	if _, err := be.CopyFrom(ctx, fixtureFs, "cdktf-lib", "./fixtures/cdktf-lib", models.CopyOptions{
 		SkipDirs: []string{"node_modules"},
 	}); err != nil {
 		t.Fatalf("CopyFrom failed: %v", err)
@@ -0,0 +1,266 @@
+package executors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// NodeOptions configures the Node executor.
+//
+// The options returned by DefaultNodeOptions and DecodeNodeOptions are used
+// as is, zero values included. In a NodeOptions literal the zero value of a
+// field keeps the default from DefaultNodeOptions.
+type NodeOptions struct {
+	// Entrypoint is the package manager binary running install and the synth script.
+	Entrypoint string
+	// SynthScript is the package.json script ran to synth main.ts.
+	SynthScript string
+	// NodeVersion is the package.json engines.node range.
+	NodeVersion string
+	// PackageManager is the package.json packageManager field.
+	PackageManager string
+	// PnpmWorkspace is the content of pnpm-workspace.yaml, e.g. to install local packages.
+	PnpmWorkspace string
+
+	// explicit is set by DefaultNodeOptions, the zero values are not defaults.
+	explicit bool
+}
+
+// DefaultNodeOptions returns the defaults of the Node executor.
+func DefaultNodeOptions() NodeOptions {
+	return NodeOptions{
+		Entrypoint:     "pnpm",
+		SynthScript:    "ts-node --swc -P ./tsconfig.json main.ts",
+		NodeVersion:    ">=18.0.0",
+		PackageManager: "pnpm@9.0.2",
+		explicit:       true,
+	}
+}
+
+// NodeOptionKeys are the AppConfig.ExecutorOptions keys supported by the Node executor.
+var NodeOptionKeys = optionKeys((&NodeOptions{}).fields())
+
+// DecodeNodeOptions decodes AppConfig.ExecutorOptions on top of the defaults.
+func DecodeNodeOptions(options map[string]string) (NodeOptions, error) {
+	opts := DefaultNodeOptions()
+	err := decodeOptions(options, opts.fields())
+	return opts, err
+}
+
+// Validate checks the options required to install and synth are set.
+func (o NodeOptions) Validate() error {
+	var errs []error
+	if o.Entrypoint == "" {
+		errs = append(errs, errors.New("node options: entrypoint is required"))
+	}
+	if o.SynthScript == "" {
+		errs = append(errs, errors.New("node options: synthScript is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// fields maps the ExecutorOptions keys to the option fields.
+func (o *NodeOptions) fields() map[string]optionField {
+	return map[string]optionField{
+		"entrypoint":     stringField(&o.Entrypoint),
+		"synthScript":    stringField(&o.SynthScript),
+		"nodeVersion":    stringField(&o.NodeVersion),
+		"packageManager": stringField(&o.PackageManager),
+		"pnpmWorkspace":  stringField(&o.PnpmWorkspace),
+	}
+}
+
+// BunOptions configures the Bun executor.
+//
+// The options returned by DefaultBunOptions and DecodeBunOptions are used as
+// is, zero values included, e.g. workerMaxJobs 0 to never restart the worker.
+// In a BunOptions literal the zero value of a field keeps the default from
+// DefaultBunOptions.
+type BunOptions struct {
+	// Entrypoint is the bun binary, e.g. an absolute path when bun is not on PATH.
+	Entrypoint string
+	// Worker runs the scripts in a resident bun process loading the dependencies once.
+	Worker bool
+	// WorkerMaxJobs is the number of scripts a worker runs before it is restarted, 0 never restarts.
+	WorkerMaxJobs int
+	// WorkerMaxRSS is the resident memory in MiB above which a worker is restarted, 0 never restarts.
+	WorkerMaxRSS int64
+
+	// explicit is set by DefaultBunOptions, the zero values are not defaults.
+	explicit bool
+}
+
+// DefaultBunOptions returns the defaults of the Bun executor.
+func DefaultBunOptions() BunOptions {
+	return BunOptions{
+		Entrypoint:    "bun",
+		WorkerMaxJobs: 100,
+		WorkerMaxRSS:  1024,
+		explicit:      true,
+	}
+}
+
+// BunOptionKeys are the AppConfig.ExecutorOptions keys supported by the Bun executor.
+var BunOptionKeys = optionKeys((&BunOptions{}).fields())
+
+// DecodeBunOptions decodes AppConfig.ExecutorOptions on top of the defaults.
+func DecodeBunOptions(options map[string]string) (BunOptions, error) {
+	opts := DefaultBunOptions()
+	err := decodeOptions(options, opts.fields())
+	return opts, err
+}
+
+// Validate checks the options required to install and synth are set.
+func (o BunOptions) Validate() error {
+	var errs []error
+	if o.Entrypoint == "" {
+		errs = append(errs, errors.New("bun options: entrypoint is required"))
+	}
+	if o.WorkerMaxJobs < 0 {
+		errs = append(errs, fmt.Errorf("bun options: workerMaxJobs must not be negative, got %d", o.WorkerMaxJobs))
+	}
+	if o.WorkerMaxRSS < 0 {
+		errs = append(errs, fmt.Errorf("bun options: workerMaxRSS must not be negative, got %d", o.WorkerMaxRSS))
+	}
+	return errors.Join(errs...)
+}
+
+// bunWorkerOptions are the worker options in the units of bunWorker.
+type bunWorkerOptions struct {
+	enabled bool
+	maxJobs int
+	maxRSS  int64
+}
+
+// worker returns the worker options, with the resident memory in bytes.
+func (o BunOptions) worker() bunWorkerOptions {
+	return bunWorkerOptions{
+		enabled: o.Worker,
+		maxJobs: o.WorkerMaxJobs,
+		maxRSS:  o.WorkerMaxRSS << 20,
+	}
+}
+
+// fields maps the ExecutorOptions keys to the option fields.
+func (o *BunOptions) fields() map[string]optionField {
+	return map[string]optionField{
+		"entrypoint":    stringField(&o.Entrypoint),
+		"worker":        boolField(&o.Worker),
+		"workerMaxJobs": intField(&o.WorkerMaxJobs),
+		"workerMaxRSS":  int64Field(&o.WorkerMaxRSS),
+	}
+}
+
+// optionField is an option field, decoded from its ExecutorOptions value.
+type optionField interface {
+	// decode sets the field from an ExecutorOptions value.
+	decode(value string) error
+	// isZero reports whether the field keeps the default.
+	isZero() bool
+	// setFrom sets the field to the value of src, a field of the same type.
+	setFrom(src optionField)
+}
+
+// field is an optionField of type T.
+type field[T comparable] struct {
+	value *T
+	parse func(string) (T, error)
+}
+
+func (f field[T]) decode(value string) error {
+	v, err := f.parse(value)
+	if err != nil {
+		return err
+	}
+	*f.value = v
+	return nil
+}
+
+func (f field[T]) isZero() bool {
+	var zero T
+	return *f.value == zero
+}
+
+func (f field[T]) setFrom(src optionField) {
+	*f.value = *src.(field[T]).value
+}
+
+func stringField(value *string) optionField {
+	return field[string]{value: value, parse: func(s string) (string, error) { return s, nil }}
+}
+
+func boolField(value *bool) optionField {
+	return field[bool]{value: value, parse: func(s string) (bool, error) {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, fmt.Errorf("must be a boolean, got %q", s)
+		}
+		return v, nil
+	}}
+}
+
+func intField(value *int) optionField {
+	return field[int]{value: value, parse: func(s string) (int, error) {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("must be an integer, got %q", s)
+		}
+		return v, nil
+	}}
+}
+
+func int64Field(value *int64) optionField {
+	return field[int64]{value: value, parse: func(s string) (int64, error) {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("must be an integer, got %q", s)
+		}
+		return v, nil
+	}}
+}
+
+// decodeOptions sets the fields from options, reporting all unknown keys and invalid values.
+func decodeOptions(options map[string]string, fields map[string]optionField) error {
+	var errs []error
+	for _, key := range sortedKeys(options) {
+		field, ok := fields[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown executor option %q, expected one of %v", key, optionKeys(fields)))
+			continue
+		}
+		if err := field.decode(options[key]); err != nil {
+			errs = append(errs, fmt.Errorf("executor option %q: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mergeOptions sets the fields of src on dst, all of them if explicit and
+// only the non-zero ones otherwise.
+func mergeOptions(dst, src map[string]optionField, explicit bool) {
+	for key, value := range src {
+		if explicit || !value.isZero() {
+			dst[key].setFrom(value)
+		}
+	}
+}
+
+func optionKeys(fields map[string]optionField) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
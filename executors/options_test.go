@@ -0,0 +1,121 @@
+package executors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeNodeOptions(t *testing.T) {
+	opts, err := DecodeNodeOptions(map[string]string{
+		"entrypoint":    "npm",
+		"pnpmWorkspace": "packages:\n- \"./fixtures/cdktf-lib\"",
+	})
+	require.NoError(t, err)
+	want := DefaultNodeOptions()
+	want.Entrypoint = "npm"
+	want.PnpmWorkspace = "packages:\n- \"./fixtures/cdktf-lib\""
+	require.Equal(t, want, opts)
+
+	_, err = DecodeNodeOptions(map[string]string{
+		"entrypiont":  "npm",
+		"synthScirpt": "tsx main.ts",
+	})
+	require.ErrorContains(t, err, `unknown executor option "entrypiont"`)
+	require.ErrorContains(t, err, `unknown executor option "synthScirpt"`)
+
+	require.Equal(t, []string{"entrypoint", "nodeVersion", "packageManager", "pnpmWorkspace", "synthScript"}, NodeOptionKeys)
+}
+
+func TestNodeOptions_precedence(t *testing.T) {
+	e, err := NewNodeExecutorWithOptions(NodeOptions{
+		Entrypoint:  "npm",
+		SynthScript: "tsx main.ts",
+	})(getPrettyLogger())
+	require.NoError(t, err)
+	ne := e.(*nodeExecutor)
+	defer ne.Cleanup(context.Background())
+	require.Equal(t, "npm", ne.entrypoint)
+
+	opts, err := ne.resolveOptions(models.AppConfig{
+		ExecutorOptions: map[string]string{
+			"synthScript": "ts-node main.ts",
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "npm", opts.Entrypoint)
+	require.Equal(t, "ts-node main.ts", opts.SynthScript)
+	require.Equal(t, DefaultNodeOptions().NodeVersion, opts.NodeVersion)
+
+	// the zero values of decoded options are kept
+	decoded, err := DecodeNodeOptions(map[string]string{"nodeVersion": ""})
+	require.NoError(t, err)
+	e, err = NewNodeExecutorWithOptions(decoded)(getPrettyLogger())
+	require.NoError(t, err)
+	defer e.Cleanup(context.Background())
+	opts, err = e.(*nodeExecutor).resolveOptions(models.AppConfig{})
+	require.NoError(t, err)
+	require.Empty(t, opts.NodeVersion)
+
+	_, err = ne.resolveOptions(models.AppConfig{
+		ExecutorOptions: map[string]string{
+			"entrypoint": "",
+		},
+	})
+	require.ErrorContains(t, err, "entrypoint is required")
+}
+
+func TestDecodeBunOptions(t *testing.T) {
+	opts, err := DecodeBunOptions(nil)
+	require.NoError(t, err)
+	require.Equal(t, DefaultBunOptions(), opts)
+
+	_, err = DecodeBunOptions(map[string]string{"synthScript": "main.ts"})
+	require.ErrorContains(t, err, `unknown executor option "synthScript"`)
+
+	opts, err = DecodeBunOptions(map[string]string{"worker": "true", "workerMaxJobs": "10", "workerMaxRSS": "512"})
+	require.NoError(t, err)
+	want := DefaultBunOptions()
+	want.Worker, want.WorkerMaxJobs, want.WorkerMaxRSS = true, 10, 512
+	require.Equal(t, want, opts)
+	require.Equal(t, bunWorkerOptions{enabled: true, maxJobs: 10, maxRSS: 512 << 20}, opts.worker())
+
+	_, err = DecodeBunOptions(map[string]string{"worker": "yes", "workerMaxJobs": "ten", "workerMaxRSS": "1G"})
+	require.ErrorContains(t, err, `executor option "worker": must be a boolean, got "yes"`)
+	require.ErrorContains(t, err, `executor option "workerMaxJobs": must be an integer, got "ten"`)
+	require.ErrorContains(t, err, `executor option "workerMaxRSS": must be an integer, got "1G"`)
+
+	// the decoded zero values disable the restarts once passed to the executor
+	opts, err = DecodeBunOptions(map[string]string{"worker": "true", "workerMaxJobs": "0", "workerMaxRSS": "0"})
+	require.NoError(t, err)
+	e, err := NewBunExecutorWithOptions(opts)(getPrettyLogger())
+	require.NoError(t, err)
+	defer e.Cleanup(context.Background())
+	resolved, err := e.(*bunExecutor).resolveOptions(models.AppConfig{})
+	require.NoError(t, err)
+	require.Equal(t, bunWorkerOptions{enabled: true}, resolved.worker())
+
+	// so does a default turned off
+	opts = DefaultBunOptions()
+	opts.WorkerMaxJobs = 0
+	e, err = NewBunExecutorWithOptions(opts)(getPrettyLogger())
+	require.NoError(t, err)
+	defer e.Cleanup(context.Background())
+	resolved, err = e.(*bunExecutor).resolveOptions(models.AppConfig{})
+	require.NoError(t, err)
+	require.Zero(t, resolved.WorkerMaxJobs)
+
+	// in a literal a zero value keeps the default
+	e, err = NewBunExecutorWithOptions(BunOptions{Worker: true})(getPrettyLogger())
+	require.NoError(t, err)
+	defer e.Cleanup(context.Background())
+	resolved, err = e.(*bunExecutor).resolveOptions(models.AppConfig{ExecutorOptions: map[string]string{"worker": "false"}})
+	require.NoError(t, err)
+	require.Equal(t, bunWorkerOptions{maxJobs: 100, maxRSS: 1024 << 20}, resolved.worker(), "worker false overrides the constructor option")
+
+	opts, err = DecodeBunOptions(map[string]string{"workerMaxJobs": "-1"})
+	require.NoError(t, err)
+	require.ErrorContains(t, opts.Validate(), "workerMaxJobs must not be negative, got -1")
+}
@@ -0,0 +1,106 @@
+// go-synth worker: runs synth jobs in a resident process so the bun runtime is
+// started once and the dependencies are loaded ahead of each job.
+//
+// Jobs are read as JSON lines from stdin: {"id": 1, "dir": "/abs/run/dir", "env": {...}}
+// Responses are written as JSON lines to fd 3: {"id": 1, "ok": true, "rss": 123}
+//
+// Jobs run one at a time, each in a fresh Worker thread with its own globals,
+// module cache and environment, so nothing leaks from one job into the next.
+// The thread of the next job is started as soon as the previous job is done
+// and imports the package.json dependencies while waiting for its job.
+import { readFileSync, writeSync } from "node:fs";
+import { join } from "node:path";
+import { createInterface } from "node:readline";
+import { isMainThread, parentPort, Worker, workerData } from "node:worker_threads";
+
+type Job = { id: number; dir: string; env?: Record<string, string> };
+type Result = { ok: boolean; error?: string };
+
+const responses = 3;
+
+function errorMessage(err: unknown): string {
+  return err instanceof Error ? err.stack ?? err.message : String(err);
+}
+
+// thread runs a single job in a Worker thread.
+async function thread() {
+  await Promise.allSettled((workerData.preload as string[]).map((name) => import(name)));
+  parentPort!.once("message", async (job: { script: string; env: Record<string, string> }) => {
+    for (const key of Object.keys(process.env)) {
+      delete process.env[key];
+    }
+    Object.assign(process.env, job.env);
+    try {
+      await import(job.script);
+      parentPort!.postMessage({ ok: true });
+    } catch (err) {
+      parentPort!.postMessage({ ok: false, error: errorMessage(err) });
+    }
+  });
+}
+
+function dependencies(): string[] {
+  try {
+    const pkg = JSON.parse(readFileSync(join(process.cwd(), "package.json"), "utf8"));
+    return Object.keys(pkg.dependencies ?? {});
+  } catch {
+    return [];
+  }
+}
+
+// spawn starts the thread of the next job, done resolves with its first message,
+// error or exit.
+function spawn(preload: string[]) {
+  const worker = new Worker(new URL(import.meta.url), { workerData: { preload } });
+  const done = new Promise<Result>((resolve) => {
+    worker.once("message", resolve);
+    worker.once("error", (err) => resolve({ ok: false, error: errorMessage(err) }));
+    worker.once("exit", (code) => resolve({ ok: false, error: `script exited with code ${code}` }));
+  });
+  return { worker, done };
+}
+
+async function main() {
+  const baseDir = process.cwd();
+  const preload = dependencies();
+  let next = spawn(preload);
+
+  const respond = (response: Record<string, unknown>) => {
+    writeSync(responses, JSON.stringify({ ...response, rss: process.memoryUsage().rss }) + "\n");
+  };
+
+  const run = async (job: Job): Promise<Result> => {
+    const { worker, done } = next;
+    // threads share the process working directory, only one job runs at a time.
+    process.chdir(job.dir);
+    try {
+      worker.postMessage({ script: join(job.dir, "main.ts"), env: job.env ?? {} });
+      return await done;
+    } finally {
+      process.chdir(baseDir);
+      await worker.terminate();
+      next = spawn(preload);
+    }
+  };
+
+  for await (const line of createInterface({ input: process.stdin })) {
+    if (!line.trim()) {
+      continue;
+    }
+    let id = 0;
+    try {
+      const job: Job = JSON.parse(line);
+      id = job.id;
+      respond({ id, ...(await run(job)) });
+    } catch (err) {
+      respond({ id, ok: false, error: errorMessage(err) });
+    }
+  }
+  await next.worker.terminate();
+}
+
+if (isMainThread) {
+  await main();
+} else {
+  await thread();
+}
@@ -10,7 +10,6 @@ import (
 
 	"text/template"
 
-	"github.com/environment-toolkit/go-synth/models"
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
 )
@@ -62,7 +61,7 @@ func initializeTemplates(logger *zap.Logger, basePath string) *templateStore {
 	}
 }
 
-func (t *templateStore) setupFs(ctx context.Context, dest afero.Fs, config models.AppConfig) error {
+func (t *templateStore) setupFs(ctx context.Context, dest afero.Fs, data any) error {
 	err := fs.WalkDir(embeddedFiles, t.basePath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("unable to setup fs: %w", err)
@@ -92,7 +91,7 @@ func (t *templateStore) setupFs(ctx context.Context, dest afero.Fs, config model
 			if !ok {
 				t.logger.Error("template not found", zap.String("path", path))
 			}
-			if err := tpl.Execute(writer, config); err != nil {
+			if err := tpl.Execute(writer, data); err != nil {
 				return fmt.Errorf("unable to execute template %s, %w", path, err)
 			}
 
@@ -2,16 +2,27 @@ package executors
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/environment-toolkit/go-synth/ignore"
 	"github.com/environment-toolkit/go-synth/models"
+	"github.com/environment-toolkit/go-synth/tfjson"
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -22,77 +33,848 @@ func removeExtension(path string) string {
 	return strings.TrimSuffix(path, filepath.Ext(path))
 }
 
+// maxSymlinkHops bounds the symlinks followed to resolve a path, like ELOOP.
+const maxSymlinkHops = 40
+
 // copyDir copies a directory from the source filesystem to the destination filesystem.
-func copyDir(logger *zap.Logger, srcDir, destDir string, src, dest afero.Fs, options models.CopyOptions) error {
-	srcDirInfo, err := src.Stat(srcDir)
+//
+// In CopySync mode the unchanged files are skipped and the stale destination files deleted.
+// Symlinks pointing outside of srcDir are rejected.
+func copyDir(logger *zap.Logger, srcDir, destDir string, src, dest afero.Fs, options models.CopyOptions) (models.CopyResult, error) {
+	c, err := newCopier(logger, srcDir, destDir, src, dest, options)
+	if err != nil {
+		return models.CopyResult{}, err
+	}
+	if c.mirror {
+		if err := checkSyncDir(dest, destDir); err != nil {
+			return models.CopyResult{}, err
+		}
+	}
+	if linker, ok := dest.(afero.Linker); ok && options.Symlinks == models.SymlinksCopy {
+		c.linker = linker
+	}
+	if err := c.copyRoot(); err != nil {
+		return c.result, err
+	}
+	if c.mirror {
+		if c.result.Deleted, err = c.matcher.deleteStale(logger, dest, destDir, c.copied); err != nil {
+			return c.result, err
+		}
+	}
+	// writing the files changes the directory times, so they are set last
+	for _, relPath := range sortedDirs(c.dirs) {
+		destPath := filepath.Join(destDir, relPath)
+		if exists, err := afero.DirExists(dest, destPath); err != nil || !exists {
+			continue
+		}
+		if err := c.applyMetadata(destPath, c.dirs[relPath]); err != nil {
+			return c.result, err
+		}
+	}
+	return c.result, nil
+}
+
+// checkSyncDir refuses to sync into destDir when deleting its stale files would
+// delete unrelated files: the root of dest, a filesystem root, or the working
+// directory of the process or one of its parents.
+func checkSyncDir(dest afero.Fs, destDir string) error {
+	dir := filepath.Clean(destDir)
+	if dir == "." || dir == filepath.VolumeName(dir)+string(filepath.Separator) {
+		return fmt.Errorf("refusing to sync into %q, sync mode needs a dedicated output directory", destDir)
+	}
+	if _, ok := dest.(*afero.OsFs); !ok {
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
 	if err != nil {
 		return err
 	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(abs, wd); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to sync into %q, it holds the working directory, sync mode needs a dedicated output directory", destDir)
+	}
+	return nil
+}
+
+// archiveDir streams the files of srcDir selected by options to w as a format archive.
+//
+// The entries are written in path order, as archive.Write does, and the
+// symlinks are followed, so the same files give the same archive.
+func archiveDir(logger *zap.Logger, srcDir string, src afero.Fs, w io.Writer, format models.ArchiveFormat, options models.CopyOptions) (models.CopyResult, error) {
+	options.Mode = models.CopyMerge
+	options.Symlinks = models.SymlinksFollow
+	c, err := newCopier(logger, srcDir, "", src, nil, options)
+	if err != nil {
+		return models.CopyResult{}, err
+	}
+	if c.archive, err = archive.NewWriter(w, format); err != nil {
+		return models.CopyResult{}, err
+	}
+	if err := c.copyRoot(); err != nil {
+		return c.result, err
+	}
+	return c.result, c.archive.Close()
+}
+
+// newCopier validates the options and returns a copier of srcDir.
+func newCopier(logger *zap.Logger, srcDir, destDir string, src, dest afero.Fs, options models.CopyOptions) (*copier, error) {
+	switch options.Mode {
+	case "", models.CopyMerge, models.CopySync:
+	default:
+		return nil, fmt.Errorf("unknown copy mode %q", options.Mode)
+	}
+	switch options.Symlinks {
+	case "", models.SymlinksFollow, models.SymlinksCopy:
+	default:
+		return nil, fmt.Errorf("unknown symlinks mode %q", options.Symlinks)
+	}
+	srcDirInfo, err := src.Stat(srcDir)
+	if err != nil {
+		return nil, err
+	}
 	if !srcDirInfo.IsDir() {
-		return fmt.Errorf("source path is not a directory: %s", srcDir)
+		return nil, fmt.Errorf("source path is not a directory: %s", srcDir)
 	}
+	m, err := newCopyMatcher(options)
+	if err != nil {
+		return nil, err
+	}
+	n, err := newJSONNormalizer(src, srcDir, options.Normalize)
+	if err != nil {
+		return nil, err
+	}
+	hcl, err := newHCLOptions(options.HCL)
+	if err != nil {
+		return nil, err
+	}
+	return &copier{
+		logger:     logger,
+		src:        src,
+		dest:       dest,
+		srcDir:     srcDir,
+		destDir:    destDir,
+		options:    options,
+		matcher:    m,
+		normalizer: n,
+		hcl:        hcl,
+		mirror:     options.Mode == models.CopySync,
+		copied:     map[string]bool{},
+		dirs:       map[string]os.FileInfo{},
+	}, nil
+}
+
+// copier holds the state of a copyDir call.
+type copier struct {
+	logger  *zap.Logger
+	src     afero.Fs
+	dest    afero.Fs
+	srcDir  string
+	destDir string
+	options models.CopyOptions
+	matcher *copyMatcher
+	// normalizer canonicalizes the JSON files, if set.
+	normalizer *jsonNormalizer
+	// hcl converts the Terraform JSON files, if set.
+	hcl    *tfjson.HCLOptions
+	mirror bool
+	// linker recreates the symlinks, nil to follow them.
+	linker afero.Linker
+	// archive receives the files instead of dest, if set.
+	archive *archive.Writer
+	// depth is the number of symlinked directories being followed.
+	depth int
+
+	result models.CopyResult
+	copied map[string]bool
+	// dirs are the copied directories, by destination relative path.
+	dirs map[string]os.FileInfo
+}
+
+// copyRoot copies the source directory, reading its ignore file first.
+func (c *copier) copyRoot() error {
+	if err := c.matcher.readIgnoreFile(c.src, c.srcDir, "."); err != nil {
+		return err
+	}
+	return c.copyTree(c.srcDir, ".")
+}
+
+// copyTree copies the entries of dir to relDir, relative to the destination directory.
+func (c *copier) copyTree(dir, relDir string) error {
+	entries, err := afero.ReadDir(c.src, dir)
+	if err != nil {
+		return err
+	}
+	if c.archive != nil {
+		c.sortByPath(dir, entries)
+	}
+	for _, info := range entries {
+		path := filepath.Join(dir, info.Name())
+		relPath := filepath.Join(relDir, info.Name())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			err = c.copySymlink(path, relPath)
+		case info.IsDir():
+			err = c.copySubdir(path, relPath, info)
+		case info.Mode().IsRegular():
+			err = c.copyRegular(path, relPath, info)
+		default:
+			c.logger.Debug("skipping irregular file", zap.String("path", path))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortByPath sorts the entries of dir so a depth first walk visits the files
+// in the order of their full path, as archive.Write does: a directory sorts as
+// its name followed by a slash, e.g. "a.txt" before the files of "a".
+//
+// Symlinks are followed in archives, so a symlink to a directory is one too.
+func (c *copier) sortByPath(dir string, entries []os.FileInfo) {
+	keys := make(map[string]string, len(entries))
+	for _, info := range entries {
+		isDir := info.IsDir()
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, err := c.src.Stat(filepath.Join(dir, info.Name())); err == nil {
+				isDir = target.IsDir()
+			}
+		}
+		keys[info.Name()] = info.Name()
+		if isDir {
+			keys[info.Name()] += "/"
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return keys[entries[i].Name()] < keys[entries[j].Name()]
+	})
+}
+
+func (c *copier) copySubdir(path, relPath string, info os.FileInfo) error {
+	if c.matcher.skip.Match(relPath, true) {
+		c.logger.Debug("skipping directory", zap.String("path", relPath))
+		return nil
+	}
+	if err := c.matcher.readIgnoreFile(c.src, path, relPath); err != nil {
+		return err
+	}
+	c.dirs[relPath] = info
+	return c.copyTree(path, relPath)
+}
 
-	err = afero.Walk(src, srcDir, func(path string, info os.FileInfo, err error) error {
+func (c *copier) copyRegular(path, relPath string, info os.FileInfo) error {
+	if c.matcher.shouldIgnore(relPath) {
+		c.logger.Debug("ignoring file", zap.String("path", path))
+		return nil
+	}
+	var content []byte
+	if c.normalizer.match(relPath) {
+		var err error
+		if content, err = c.normalizer.normalize(c.src, path); err != nil {
+			return err
+		}
+	}
+	if c.hcl != nil && strings.HasSuffix(relPath, tfJSONSuffix) {
+		converted, err := c.convertHCL(path, content)
 		if err != nil {
 			return err
 		}
-		relPath, err := filepath.Rel(srcDir, path)
+		return c.copyContent(path, strings.TrimSuffix(relPath, ".json"), info, converted)
+	}
+	return c.copyContent(path, relPath, info, content)
+}
+
+// tfJSONSuffix is the suffix of the Terraform JSON files converted to HCL.
+const tfJSONSuffix = ".tf.json"
+
+// newHCLOptions returns the tfjson options of options, nil if unset. The
+// schema file is read from the OS filesystem.
+func newHCLOptions(options *models.HCLOptions) (*tfjson.HCLOptions, error) {
+	if options == nil {
+		return nil, nil
+	}
+	hcl := &tfjson.HCLOptions{Blocks: options.Blocks, Attributes: options.Attributes}
+	if options.SchemaFile != "" {
+		data, err := os.ReadFile(options.SchemaFile)
 		if err != nil {
+			return nil, fmt.Errorf("failed to read the HCL schema file: %w", err)
+		}
+		if hcl.Schema, err = tfjson.ParseSchema(data); err != nil {
+			return nil, fmt.Errorf("failed to parse the HCL schema file %s: %w", options.SchemaFile, err)
+		}
+	}
+	return hcl, nil
+}
+
+// convertHCL returns the HCL of the Terraform JSON file at path, or of its
+// normalized content if set.
+func (c *copier) convertHCL(path string, content []byte) ([]byte, error) {
+	if content == nil {
+		var err error
+		if content, err = afero.ReadFile(c.src, path); err != nil {
+			return nil, err
+		}
+	}
+	converted, err := tfjson.ToHCL(content, *c.hcl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to HCL: %w", path, err)
+	}
+	return converted, nil
+}
+
+// copyContent copies the file at path, or content if set, to relPath.
+func (c *copier) copyContent(path, relPath string, info os.FileInfo, content []byte) error {
+	name := filepath.ToSlash(relPath)
+	if c.archive != nil {
+		return c.archiveFile(path, name, info, content)
+	}
+	c.copied[name] = true
+	destPath := filepath.Join(c.destDir, relPath)
+	destInfo, err := lstat(c.dest, destPath)
+	exists := err == nil
+	if exists && destInfo.Mode()&os.ModeSymlink != 0 {
+		// never write through a symlink
+		if err := c.dest.Remove(destPath); err != nil {
 			return err
 		}
-		if info.IsDir() {
-			for _, skipDir := range options.SkipDirs {
-				if relPath == skipDir {
-					logger.Debug("skipping directory", zap.String("path", relPath))
-					return filepath.SkipDir
-				}
-			}
-			return nil
+	} else if exists && c.mirror {
+		var same bool
+		if content != nil {
+			same, err = sameBytes(c.dest, destPath, content)
+		} else {
+			same, err = sameContent(c.src, c.dest, path, destPath)
 		}
-		shouldIgnore, err := shouldIgnore(relPath, options.AllowPatterns, options.IgnorePatterns)
 		if err != nil {
 			return err
 		}
-		if shouldIgnore {
-			logger.Debug("ignoring file", zap.String("path", path))
+		if same && !c.metadataChanged(info, destInfo) {
+			c.logger.Debug("skipping unchanged file", zap.String("path", path))
+			c.result.Unchanged = append(c.result.Unchanged, name)
 			return nil
 		}
-		destPath := filepath.Join(destDir, relPath)
-		logger.Debug("copying file", zap.String("src", path), zap.String("dest", destPath))
-		if err := copyFile(src, dest, path, destPath); err != nil {
+		if same {
+			c.result.Updated = append(c.result.Updated, name)
+			return c.applyMetadata(destPath, info)
+		}
+	}
+	c.logger.Debug("copying file", zap.String("src", path), zap.String("dest", destPath))
+	if content != nil {
+		err = writeFile(c.dest, destPath, content)
+	} else {
+		err = copyFile(c.src, c.dest, path, destPath)
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.applyMetadata(destPath, info); err != nil {
+		return err
+	}
+	if exists {
+		c.result.Updated = append(c.result.Updated, name)
+	} else {
+		c.result.Added = append(c.result.Added, name)
+	}
+	return nil
+}
+
+// archiveFile writes the file at path, or its normalized content if set, to the archive as name.
+func (c *copier) archiveFile(path, name string, info os.FileInfo, content []byte) error {
+	if content != nil {
+		if err := c.archive.WriteFile(name, info.Mode(), int64(len(content)), bytes.NewReader(content)); err != nil {
 			return err
 		}
+		c.result.Added = append(c.result.Added, name)
 		return nil
-	})
+	}
+	f, err := c.src.Open(path)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	c.logger.Debug("archiving file", zap.String("src", path))
+	if err := c.archive.WriteFile(name, info.Mode(), info.Size(), f); err != nil {
+		return err
+	}
+	c.result.Added = append(c.result.Added, name)
 	return nil
 }
 
-// shouldIgnore checks if the provided path should be ignored based on the allow and ignore patterns.
-func shouldIgnore(path string, allowPatterns []string, ignorePatterns []string) (bool, error) {
-	for _, pattern := range allowPatterns {
-		match, err := filepath.Match(pattern, path)
-		if err != nil {
+// copySymlink recreates the symlink if possible, and copies its target otherwise.
+func (c *copier) copySymlink(path, relPath string) error {
+	// like git, a symlink is matched as a file
+	if c.matcher.shouldIgnore(relPath) {
+		c.logger.Debug("ignoring symlink", zap.String("path", path))
+		return nil
+	}
+	target, err := c.readSymlink(path)
+	if err != nil {
+		return err
+	}
+	if c.linker != nil {
+		copied, err := c.copyLink(relPath, target)
+		if err != nil || copied {
+			return err
+		}
+	}
+	targetPath := filepath.Join(c.srcDir, target)
+	info, err := c.src.Stat(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to follow symlink %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return c.copyRegular(targetPath, relPath, info)
+	}
+	realRel, err := filepath.Rel(c.srcDir, path)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(target, realRel); target == "." || err == nil && filepath.IsLocal(rel) {
+		return fmt.Errorf("symlink %s points to its parent directory", path)
+	}
+	if c.depth >= maxSymlinkHops {
+		return fmt.Errorf("too many levels of symlinks at %s", path)
+	}
+	c.depth++
+	defer func() { c.depth-- }()
+	return c.copySubdir(targetPath, relPath, info)
+}
+
+// copyLink creates a symlink to target, both relative to the destination
+// directory, and returns false when the destination does not support it.
+func (c *copier) copyLink(relPath, target string) (bool, error) {
+	name := filepath.ToSlash(relPath)
+	destPath := filepath.Join(c.destDir, relPath)
+	// the link is relative to its directory, except on a BasePathFs which
+	// resolves the target from its root
+	oldname, err := filepath.Rel(filepath.Dir(relPath), target)
+	if err != nil {
+		return false, err
+	}
+	want := oldname
+	if bp, ok := c.dest.(*afero.BasePathFs); ok {
+		oldname = filepath.Join(c.destDir, target)
+		if want, err = bp.RealPath(oldname); err != nil {
+			return false, err
+		}
+	}
+
+	info, err := lstat(c.dest, destPath)
+	exists := err == nil
+	if exists {
+		if info.IsDir() {
+			return false, fmt.Errorf("can not replace directory %s with a symlink", destPath)
+		}
+		if c.mirror && info.Mode()&os.ModeSymlink != 0 {
+			if reader, ok := c.dest.(afero.LinkReader); ok {
+				if current, err := reader.ReadlinkIfPossible(destPath); err == nil && current == want {
+					c.copied[name] = true
+					c.result.Unchanged = append(c.result.Unchanged, name)
+					return true, nil
+				}
+			}
+		}
+		if err := c.dest.Remove(destPath); err != nil {
 			return false, err
 		}
-		if match {
+	}
+	if err := ensurePath(c.dest, destPath); err != nil {
+		return false, err
+	}
+	if err := c.linker.SymlinkIfPossible(oldname, destPath); err != nil {
+		if errors.Is(err, afero.ErrNoSymlink) {
+			c.logger.Debug("symlinks not supported, following", zap.String("path", relPath))
 			return false, nil
 		}
+		return false, err
+	}
+	c.copied[name] = true
+	if exists {
+		c.result.Updated = append(c.result.Updated, name)
+	} else {
+		c.result.Added = append(c.result.Added, name)
+	}
+	return true, nil
+}
+
+// readSymlink returns the target of the symlink at path relative to the
+// source directory, with every symlink along the way resolved.
+func (c *copier) readSymlink(path string) (string, error) {
+	hops := 0
+	return c.resolveLink(path, &hops)
+}
+
+func (c *copier) resolveLink(path string, hops *int) (string, error) {
+	*hops++
+	if *hops > maxSymlinkHops {
+		return "", fmt.Errorf("too many levels of symlinks at %s", path)
+	}
+	reader, ok := c.src.(afero.LinkReader)
+	if !ok {
+		return "", fmt.Errorf("failed to read symlink %s: %w", path, afero.ErrNoReadlink)
+	}
+	target, err := reader.ReadlinkIfPossible(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read symlink %s: %w", path, err)
+	}
+	var rel string
+	if filepath.IsAbs(target) {
+		rel, err = c.sourceRel(target)
+	} else {
+		var linkRel string
+		if linkRel, err = filepath.Rel(c.srcDir, path); err == nil {
+			rel = filepath.Join(filepath.Dir(linkRel), target)
+		}
+	}
+	if err != nil || rel != "." && !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("symlink %s escapes the source directory %s", path, c.srcDir)
 	}
 
-	for _, pattern := range ignorePatterns {
-		match, err := filepath.Match(pattern, path)
+	// the components of the target may be symlinks too
+	resolved := "."
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		if part == "." {
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		info, err := lstat(c.src, filepath.Join(c.srcDir, next))
 		if err != nil {
-			return false, err
+			// a dangling symlink fails when it is followed
+			return filepath.Join(append([]string{next}, parts[i+1:]...)...), nil
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if resolved, err = c.resolveLink(filepath.Join(c.srcDir, next), hops); err != nil {
+			return "", err
+		}
+	}
+	return resolved, nil
+}
+
+// sourceRel returns the absolute OS path relative to the source directory.
+func (c *copier) sourceRel(target string) (string, error) {
+	root := c.srcDir
+	var err error
+	if bp, ok := c.src.(*afero.BasePathFs); ok {
+		root, err = bp.RealPath(c.srcDir)
+	} else {
+		root, err = filepath.Abs(c.srcDir)
+	}
+	if err != nil {
+		return "", err
+	}
+	roots := []string{root}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil && resolved != root {
+		roots = append(roots, resolved)
+	}
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, target); err == nil && (rel == "." || filepath.IsLocal(rel)) {
+			return rel, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside of %s", target, root)
+}
+
+// metadataChanged reports whether the preserved mode or time of the destination differ.
+func (c *copier) metadataChanged(info, destInfo os.FileInfo) bool {
+	if c.options.PreserveMode && info.Mode().Perm() != destInfo.Mode().Perm() {
+		return true
+	}
+	return c.options.PreserveTimes && !info.ModTime().Truncate(time.Second).Equal(destInfo.ModTime().Truncate(time.Second))
+}
+
+// applyMetadata sets the preserved mode and time of info on destPath.
+func (c *copier) applyMetadata(destPath string, info os.FileInfo) error {
+	if c.options.PreserveMode {
+		if err := c.dest.Chmod(destPath, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if c.options.PreserveTimes {
+		if err := c.dest.Chtimes(destPath, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lstat returns the FileInfo of the symlink at path rather than its target, if the Fs supports it.
+func lstat(fs afero.Fs, path string) (os.FileInfo, error) {
+	if lstater, ok := fs.(afero.Lstater); ok {
+		info, _, err := lstater.LstatIfPossible(path)
+		return info, err
+	}
+	return fs.Stat(path)
+}
+
+// sortedDirs returns the directories deepest first.
+func sortedDirs(dirs map[string]os.FileInfo) []string {
+	paths := make([]string, 0, len(dirs))
+	for path := range dirs {
+		paths = append(paths, path)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths
+}
+
+// sameContent reports whether the files have the same size and checksum.
+func sameContent(src, dest afero.Fs, srcPath, destPath string) (bool, error) {
+	srcInfo, err := src.Stat(srcPath)
+	if err != nil {
+		return false, err
+	}
+	destInfo, err := dest.Stat(destPath)
+	if err != nil {
+		return false, err
+	}
+	if destInfo.IsDir() || srcInfo.Size() != destInfo.Size() {
+		return false, nil
+	}
+	srcSum, err := checksum(src, srcPath)
+	if err != nil {
+		return false, err
+	}
+	destSum, err := checksum(dest, destPath)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcSum, destSum), nil
+}
+
+// sameBytes reports whether the file holds content.
+func sameBytes(fs afero.Fs, path string, content []byte) (bool, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() || info.Size() != int64(len(content)) {
+		return false, nil
+	}
+	current, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, content), nil
+}
+
+// checksum returns the SHA-256 of the file.
+func checksum(fs afero.Fs, path string) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// jsonNormalizer canonicalizes the JSON files selected by NormalizeOptions.
+type jsonNormalizer struct {
+	patterns *ignore.Matcher
+	options  tfjson.Options
+}
+
+// newJSONNormalizer returns the normalizer of options, nil if options is nil.
+//
+// The absolute path of the source filesystem root, the executor working
+// directory, or of srcDir are replaced with tfjson.WorkDirPlaceholder.
+func newJSONNormalizer(src afero.Fs, srcDir string, options *models.NormalizeOptions) (*jsonNormalizer, error) {
+	if options == nil {
+		return nil, nil
+	}
+	patterns := options.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"*.json"}
+	}
+	m, err := ignore.New(patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid normalize patterns: %w", err)
+	}
+	root, err := filepath.Abs(srcDir)
+	if bp, ok := src.(*afero.BasePathFs); ok {
+		root, err = bp.RealPath(string(filepath.Separator))
+	}
+	if err != nil {
+		return nil, err
+	}
+	replace := maps.Clone(options.Replace)
+	if replace == nil {
+		replace = map[string]string{}
+	}
+	roots := []string{root}
+	if run := runDir(srcDir); run != "" {
+		roots = append(roots, filepath.Join(root, run))
+	}
+	for _, root := range roots {
+		replace[root] = tfjson.WorkDirPlaceholder
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			replace[resolved] = tfjson.WorkDirPlaceholder
+		}
+	}
+	return &jsonNormalizer{
+		patterns: m,
+		options:  tfjson.Options{StripMetadata: options.StripMetadata, Replace: replace},
+	}, nil
+}
+
+// runDir returns the models.RunsDir directory of srcDir, e.g. runs/3 for
+// runs/3/cdktf.out, empty if srcDir is not in a run directory.
+func runDir(srcDir string) string {
+	parts := strings.SplitN(filepath.ToSlash(filepath.Clean(srcDir)), "/", 3)
+	if len(parts) < 2 || parts[0] != models.RunsDir {
+		return ""
+	}
+	if _, err := strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return ""
+	}
+	return filepath.Join(parts[0], parts[1])
+}
+
+// match reports whether the file at relPath is normalized.
+func (n *jsonNormalizer) match(relPath string) bool {
+	return n != nil && n.patterns.Match(relPath, false)
+}
+
+// normalize returns the normalized content of the file at path.
+func (n *jsonNormalizer) normalize(src afero.Fs, path string) ([]byte, error) {
+	data, err := afero.ReadFile(src, path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := tfjson.Normalize(data, n.options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// copyMatcher holds the compiled CopyOptions patterns.
+type copyMatcher struct {
+	skip       *ignore.Matcher
+	allow      *ignore.Matcher
+	ignore     *ignore.Matcher
+	ignoreFile string
+	// manifest is the name of the manifest in the destination directory.
+	manifest string
+}
+
+func newCopyMatcher(options models.CopyOptions) (*copyMatcher, error) {
+	skip, err := ignore.New(options.SkipDirs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid skipDirs: %w", err)
+	}
+	allow, err := ignore.New(options.AllowPatterns...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowPatterns: %w", err)
+	}
+	ignorePatterns, err := ignore.New(options.IgnorePatterns...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignorePatterns: %w", err)
+	}
+	return &copyMatcher{skip: skip, allow: allow, ignore: ignorePatterns, ignoreFile: options.IgnoreFile, manifest: options.Manifest}, nil
+}
+
+// readIgnoreFile adds the patterns of the ignore file in dir, if any.
+func (m *copyMatcher) readIgnoreFile(src afero.Fs, dir, relDir string) error {
+	if m.ignoreFile == "" {
+		return nil
+	}
+	f, err := src.Open(filepath.Join(dir, m.ignoreFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	patterns, err := ignore.ReadPatterns(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Join(relDir, m.ignoreFile), err)
+	}
+	if err := m.ignore.Add(relDir, patterns...); err != nil {
+		return fmt.Errorf("invalid %s: %w", filepath.Join(relDir, m.ignoreFile), err)
+	}
+	return nil
+}
+
+// deleteStale deletes the files of destDir which were not copied, along with
+// the directories left empty. Skipped and ignored files are kept.
+func (m *copyMatcher) deleteStale(logger *zap.Logger, dest afero.Fs, destDir string, copied map[string]bool) ([]string, error) {
+	exists, err := afero.DirExists(dest, destDir)
+	if err != nil || !exists {
+		return nil, err
+	}
+	var stale []string
+	err = afero.Walk(dest, destDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
-		if match {
-			return true, nil
+		relPath, err := filepath.Rel(destDir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if relPath != "." && m.skip.Match(relPath, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !copied[filepath.ToSlash(relPath)] && !m.shouldIgnore(relPath) {
+			stale = append(stale, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleted := make([]string, 0, len(stale))
+	dirs := map[string]bool{}
+	for _, relPath := range stale {
+		logger.Debug("deleting stale file", zap.String("path", relPath))
+		if err := dest.Remove(filepath.Join(destDir, relPath)); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, filepath.ToSlash(relPath))
+		for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	// the deepest directories first
+	emptied := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		emptied = append(emptied, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(emptied)))
+	for _, dir := range emptied {
+		path := filepath.Join(destDir, dir)
+		if empty, err := afero.IsEmpty(dest, path); err != nil || !empty {
+			continue
+		}
+		if err := dest.Remove(path); err != nil {
+			return deleted, err
 		}
 	}
+	return deleted, nil
+}
 
-	return false, nil
+// shouldIgnore checks if the provided path should be ignored based on the allow and ignore patterns.
+func (m *copyMatcher) shouldIgnore(relPath string) bool {
+	if m.manifest != "" && filepath.Clean(relPath) == m.manifest {
+		return true
+	}
+	if m.allow.Match(relPath, false) {
+		return false
+	}
+	return m.ignore.Match(relPath, false)
 }
 
 // copyFile copies a file from the source filesystem to the destination filesystem.
@@ -118,6 +900,14 @@ func copyFile(src, dest afero.Fs, srcPath, destPath string) error {
 	return nil
 }
 
+// writeFile writes content to destPath, creating its directory.
+func writeFile(dest afero.Fs, destPath string, content []byte) error {
+	if err := ensurePath(dest, destPath); err != nil {
+		return err
+	}
+	return afero.WriteFile(dest, destPath, content, 0666)
+}
+
 // ensurePath creates the directory structure for the provided path.
 func ensurePath(dest afero.Fs, path string) error {
 	dir, _ := filepath.Split(path)
@@ -129,9 +919,45 @@ func ensurePath(dest afero.Fs, path string) error {
 	return nil
 }
 
-// newTempFs creates a new temporary filesystem with the provided pattern.
-func newTempFs(pattern string) (afero.Fs, string, error) {
-	d, err := os.MkdirTemp("", pattern)
+// installedVersions returns the version installed in node_modules of each dependency and dev dependency of config.
+func installedVersions(fs afero.Fs, config *models.AppConfig) (map[string]string, error) {
+	if config == nil {
+		return nil, fmt.Errorf("no dependencies installed, Setup has not run")
+	}
+	versions := map[string]string{}
+	for _, deps := range []map[string]string{config.Dependencies, config.DevDependencies} {
+		for name := range deps {
+			path := filepath.Join("node_modules", filepath.FromSlash(name), "package.json")
+			data, err := afero.ReadFile(fs, path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the installed version of %s: %w", name, err)
+			}
+			var pkg struct {
+				Version string `json:"version"`
+			}
+			if err := json.Unmarshal(data, &pkg); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+			}
+			versions[name] = pkg.Version
+		}
+	}
+	return versions, nil
+}
+
+// removeDir removes dir from fs, refusing to remove the root of fs.
+func removeDir(fs afero.Fs, dir string) error {
+	clean := filepath.Clean(dir)
+	if clean == "." || clean == string(filepath.Separator) || strings.HasPrefix(clean, "..") {
+		return fmt.Errorf("refusing to remove %s", dir)
+	}
+	return fs.RemoveAll(clean)
+}
+
+// newTempFs creates a new temporary filesystem in dir with the provided pattern.
+//
+// If dir is empty, the default directory for temporary files is used.
+func newTempFs(dir, pattern string) (afero.Fs, string, error) {
+	d, err := os.MkdirTemp(dir, pattern)
 	if err != nil {
 		return nil, "", err
 	}
@@ -144,6 +970,8 @@ type runCommandOptions struct {
 	entrypoint string
 	envVars    map[string]string
 	logger     *zap.Logger
+	// output receives each line of stdout and stderr if set.
+	output io.Writer
 }
 
 // runCommand runs the specified entrypoint with the provided environment variables.
@@ -173,21 +1001,18 @@ func runCommand(ctx context.Context, options *runCommandOptions, args ...string)
 		return fmt.Errorf("error starting command: %w", err)
 	}
 
+	output := newLineWriter(options.output)
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go streamOutput(options.logger, &wg, stdoutPipe, zap.InfoLevel)
+	go streamOutput(options.logger, output, &wg, stdoutPipe, zap.InfoLevel)
 	wg.Add(1)
-	go streamOutput(options.logger, &wg, stderrPipe, zap.WarnLevel)
+	go streamOutput(options.logger, output, &wg, stderrPipe, zap.WarnLevel)
 
 	// Reads from pipes must be completed before calling
 	// cmd.Wait() to prevent race condition
 	wg.Wait()
 
 	if err := cmd.Wait(); err != nil {
-		// // dump env for debug
-		// for k, v := range envVars {
-		// 	options.logger.Debug("environment", zap.String(k, v))
-		// }
 		return fmt.Errorf("error running %s %s: %w", options.entrypoint, args, err)
 	}
 
@@ -195,17 +1020,41 @@ func runCommand(ctx context.Context, options *runCommandOptions, args ...string)
 }
 
 // streamOutput reads from the provided pipe and logs the output using the provided logger.
-func streamOutput(logger *zap.Logger, wg *sync.WaitGroup, pipe io.ReadCloser, level zapcore.Level) {
+//
+// Each line is also written to output.
+func streamOutput(logger *zap.Logger, output *lineWriter, wg *sync.WaitGroup, pipe io.ReadCloser, level zapcore.Level) {
 	defer wg.Done()
 	scanner := bufio.NewScanner(pipe)
 	for scanner.Scan() {
 		logger.Check(level, scanner.Text()).Write()
+		output.writeLine(scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
 		logger.Error("error reading from pipe", zap.Error(err))
 	}
 }
 
+// lineWriter serializes the lines written by concurrent streams.
+type lineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newLineWriter(w io.Writer) *lineWriter {
+	return &lineWriter{w: w}
+}
+
+// writeLine writes line followed by a newline, if the writer is set.
+func (l *lineWriter) writeLine(line string) {
+	if l.w == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// output is best effort, the line is logged regardless
+	_, _ = io.WriteString(l.w, line+"\n")
+}
+
 // Format environment variables for command execution.
 func formatEnvVars(envVars map[string]string) []string {
 	formatted := make([]string, 0, len(envVars))
@@ -1,8 +1,16 @@
 package executors
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/environment-toolkit/go-synth/archive"
 	"github.com/environment-toolkit/go-synth/models"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
@@ -17,12 +25,15 @@ func Test_copyDir(t *testing.T) {
 		"foo/test.txt",
 		"foo/subdir1/test.txt",
 		"foo/subdir2/test.txt",
+		"foo/subdir2/nested/test.json",
 	}
 	fs := afero.NewMemMapFs()
 	for _, path := range files {
 		err := afero.WriteFile(fs, path, []byte("Hello, World!"), 0644)
 		require.NoError(t, err)
 	}
+	require.NoError(t, afero.WriteFile(fs, "foo/.synthignore", []byte("# text files\ntest.txt\n"), 0644))
+	require.NoError(t, afero.WriteFile(fs, "foo/subdir2/.synthignore", []byte("!/test.txt\n*.json\n"), 0644))
 
 	testCases := []struct {
 		name          string
@@ -40,9 +51,14 @@ func Test_copyDir(t *testing.T) {
 				"bar/test.txt":         true,
 				"bar/subdir1/test.txt": true,
 				"bar/subdir2/test.txt": true,
+
+				"bar/subdir2/nested/test.json": true,
 			},
 		},
 		{
+			// a pattern without a slash matches at any depth since the
+			// gitignore semantics, subdir1/test.txt and subdir2/test.txt
+			// used to be ignored
 			name:    "ignore all files except test.txt",
 			fromDir: "foo",
 			toDir:   "bar",
@@ -50,6 +66,22 @@ func Test_copyDir(t *testing.T) {
 				IgnorePatterns: []string{"*/*"},
 				AllowPatterns:  []string{"test.txt"},
 			},
+			expectedFiles: map[string]bool{
+				"bar/test.txt":         true,
+				"bar/subdir1/test.txt": true,
+				"bar/subdir2/test.txt": true,
+
+				"bar/subdir2/nested/test.json": false,
+			},
+		},
+		{
+			name:    "ignore all files except the root test.txt",
+			fromDir: "foo",
+			toDir:   "bar",
+			options: models.CopyOptions{
+				IgnorePatterns: []string{"*/*"},
+				AllowPatterns:  []string{"/test.txt"},
+			},
 			expectedFiles: map[string]bool{
 				"bar/test.txt":         true,
 				"bar/subdir1/test.txt": false,
@@ -69,11 +101,67 @@ func Test_copyDir(t *testing.T) {
 				"bar/subdir2/test.txt": true,
 			},
 		},
+		{
+			name:    "skip directory at any depth",
+			fromDir: "foo",
+			toDir:   "bar",
+			options: models.CopyOptions{
+				SkipDirs: []string{"nested"},
+			},
+			expectedFiles: map[string]bool{
+				"bar/subdir2/test.txt":         true,
+				"bar/subdir2/nested/test.json": false,
+			},
+		},
+		{
+			name:    "doublestar and negation",
+			fromDir: "foo",
+			toDir:   "bar",
+			options: models.CopyOptions{
+				IgnorePatterns: []string{"**/*.txt", "!subdir2/**/*.txt"},
+			},
+			expectedFiles: map[string]bool{
+				"bar/test.txt":                 false,
+				"bar/subdir1/test.txt":         false,
+				"bar/subdir2/test.txt":         true,
+				"bar/subdir2/nested/test.json": true,
+			},
+		},
+		{
+			name:    "ignore directory",
+			fromDir: "foo",
+			toDir:   "bar",
+			options: models.CopyOptions{
+				IgnorePatterns: []string{"subdir2/"},
+				AllowPatterns:  []string{"*.json"},
+			},
+			expectedFiles: map[string]bool{
+				"bar/test.txt":                 true,
+				"bar/subdir2/test.txt":         false,
+				"bar/subdir2/nested/test.json": true,
+			},
+		},
+		{
+			name:    "ignore file",
+			fromDir: "foo",
+			toDir:   "bar",
+			options: models.CopyOptions{
+				IgnoreFile: ".synthignore",
+			},
+			expectedFiles: map[string]bool{
+				"bar/.synthignore":             true,
+				"bar/test.txt":                 false,
+				"bar/subdir1/test.txt":         false,
+				"bar/subdir2/test.txt":         true,
+				"bar/subdir2/.synthignore":     true,
+				"bar/subdir2/nested/test.json": false,
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			destFs := afero.NewMemMapFs()
-			err := copyDir(logger, tc.fromDir, tc.toDir, fs, destFs, tc.options)
+			_, err := copyDir(logger, tc.fromDir, tc.toDir, fs, destFs, tc.options)
 			require.NoError(t, err)
 			failed := false
 			for path, shouldExist := range tc.expectedFiles {
@@ -92,6 +180,494 @@ func Test_copyDir(t *testing.T) {
 	}
 }
 
+func Test_copyDir_sync(t *testing.T) {
+	logger := getPrettyLogger()
+	src := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"out/manifest.json":          "{}",
+		"out/stacks/a/cdk.tf.json":   "a2",
+		"out/stacks/b/cdk.tf.json":   "b",
+		"out/stacks/c/cdk.tf.json":   "c",
+		"out/stacks/c/assets/new.js": "new",
+	} {
+		require.NoError(t, afero.WriteFile(src, path, []byte(content), 0644))
+	}
+	dest := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"result/manifest.json":             "{}",
+		"result/stacks/a/cdk.tf.json":      "a1",
+		"result/stacks/b/cdk.tf.json":      "b",
+		"result/stacks/old/cdk.tf.json":    "old",
+		"result/stacks/c/assets/stale.js":  "stale",
+		"result/stacks/c/local.tfstate":    "state",
+		"result/.terraform/providers.lock": "lock",
+		"other/file.txt":                   "outside",
+	} {
+		require.NoError(t, afero.WriteFile(dest, path, []byte(content), 0644))
+	}
+
+	result, err := copyDir(logger, "out", "result", src, dest, models.CopyOptions{
+		Mode:           models.CopySync,
+		SkipDirs:       []string{".terraform"},
+		IgnorePatterns: []string{"*.tfstate"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.CopyResult{
+		Added:     []string{"stacks/c/assets/new.js", "stacks/c/cdk.tf.json"},
+		Updated:   []string{"stacks/a/cdk.tf.json"},
+		Deleted:   []string{"stacks/c/assets/stale.js", "stacks/old/cdk.tf.json"},
+		Unchanged: []string{"manifest.json", "stacks/b/cdk.tf.json"},
+	}, result)
+
+	content, err := afero.ReadFile(dest, "result/stacks/a/cdk.tf.json")
+	require.NoError(t, err)
+	require.Equal(t, "a2", string(content))
+	for path, shouldExist := range map[string]bool{
+		"result/stacks/old":                false,
+		"result/stacks/c/assets/new.js":    true,
+		"result/stacks/c/local.tfstate":    true,
+		"result/.terraform/providers.lock": true,
+		"other/file.txt":                   true,
+	} {
+		exists, err := afero.Exists(dest, path)
+		require.NoError(t, err)
+		require.Equal(t, shouldExist, exists, path)
+	}
+
+	// a second sync changes nothing
+	result, err = copyDir(logger, "out", "result", src, dest, models.CopyOptions{Mode: models.CopySync, IgnorePatterns: []string{"*.tfstate"}, SkipDirs: []string{".terraform"}})
+	require.NoError(t, err)
+	require.Empty(t, result.Added)
+	require.Empty(t, result.Updated)
+	require.Empty(t, result.Deleted)
+	require.Len(t, result.Unchanged, 5)
+
+	// the manifest of the destination is neither copied nor deleted
+	require.NoError(t, afero.WriteFile(dest, "result/manifest.json", []byte("signed"), 0644))
+	result, err = copyDir(logger, "out", "result", src, dest, models.CopyOptions{Mode: models.CopySync, IgnorePatterns: []string{"*.tfstate"}, SkipDirs: []string{".terraform"}, Manifest: "manifest.json"})
+	require.NoError(t, err)
+	require.Empty(t, result.Deleted)
+	require.Len(t, result.Unchanged, 4)
+	content, err = afero.ReadFile(dest, "result/manifest.json")
+	require.NoError(t, err)
+	require.Equal(t, "signed", string(content))
+
+	_, err = copyDir(logger, "out", "result", src, dest, models.CopyOptions{Mode: "mirror"})
+	require.ErrorContains(t, err, `unknown copy mode "mirror"`)
+
+	// sync refuses to delete the files of a shared directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	for _, dir := range []string{".", "", "/", "result/.."} {
+		_, err = copyDir(logger, "out", dir, src, dest, models.CopyOptions{Mode: models.CopySync})
+		require.ErrorContains(t, err, "refusing to sync", dir)
+	}
+	for _, dir := range []string{wd, filepath.Dir(wd)} {
+		_, err = copyDir(logger, "out", dir, src, afero.NewOsFs(), models.CopyOptions{Mode: models.CopySync})
+		require.ErrorContains(t, err, "refusing to sync", dir)
+	}
+	exists, err := afero.Exists(dest, "other/file.txt")
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func Test_copyDir_normalize(t *testing.T) {
+	logger := getPrettyLogger()
+	root := t.TempDir()
+	src := afero.NewBasePathFs(afero.NewOsFs(), root)
+	stack := `{"terraform":{},"//":{"metadata":{"stackName":"dev","stackTrace":["at ` + root + `/main.ts:3"]}},` +
+		`"resource":{"null_resource":{"r":{"triggers":{"dir":"` + root + `/cdktf.out","env":"dev-123"}}}}}`
+	require.NoError(t, src.MkdirAll("cdktf.out/stacks/dev", 0755))
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/stacks/dev/cdk.tf.json", []byte(stack), 0644))
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/notes.txt", []byte(root), 0644))
+	dest := afero.NewMemMapFs()
+	options := models.CopyOptions{
+		Mode: models.CopySync,
+		Normalize: &models.NormalizeOptions{
+			StripMetadata: []string{"stackTrace"},
+			Replace:       map[string]string{"dev-123": "dev"},
+		},
+	}
+
+	result, err := copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"notes.txt", "stacks/dev/cdk.tf.json"}, result.Added)
+	content, err := afero.ReadFile(dest, "out/stacks/dev/cdk.tf.json")
+	require.NoError(t, err)
+	require.Equal(t, `{
+  "//": {
+    "metadata": {
+      "stackName": "dev"
+    }
+  },
+  "resource": {
+    "null_resource": {
+      "r": {
+        "triggers": {
+          "dir": "<workdir>/cdktf.out",
+          "env": "dev"
+        }
+      }
+    }
+  },
+  "terraform": {}
+}
+`, string(content))
+	content, err = afero.ReadFile(dest, "out/notes.txt")
+	require.NoError(t, err)
+	require.Equal(t, root, string(content), "only the JSON files are normalized")
+
+	// the normalized content is compared in sync mode
+	result, err = copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"notes.txt", "stacks/dev/cdk.tf.json"}, result.Unchanged)
+
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/broken.json", []byte("{"), 0644))
+	_, err = copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.ErrorContains(t, err, "failed to normalize cdktf.out/broken.json")
+}
+
+func Test_copyDir_normalizeRunDir(t *testing.T) {
+	logger := getPrettyLogger()
+	root := t.TempDir()
+	src := afero.NewBasePathFs(afero.NewOsFs(), root)
+	stack := func(dir string) string {
+		return `{"resource":{"null_resource":{"r":{"triggers":{"dir":"` + dir + `/cdktf.out","root":"` + root + `"}}}}}`
+	}
+	for _, dir := range []string{"cdktf.out", "runs/3/cdktf.out", "runs/x/cdktf.out"} {
+		require.NoError(t, src.MkdirAll(dir+"/stacks/dev", 0755))
+	}
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/stacks/dev/cdk.tf.json", []byte(stack(root)), 0644))
+	require.NoError(t, afero.WriteFile(src, "runs/3/cdktf.out/stacks/dev/cdk.tf.json", []byte(stack(root+"/runs/3")), 0644))
+	require.NoError(t, afero.WriteFile(src, "runs/x/cdktf.out/stacks/dev/cdk.tf.json", []byte(stack(root+"/runs/x")), 0644))
+	dest := afero.NewMemMapFs()
+	options := models.CopyOptions{Normalize: &models.NormalizeOptions{}}
+
+	for srcDir, destDir := range map[string]string{"cdktf.out": "eval", "runs/3/cdktf.out": "session", "runs/x/cdktf.out": "other"} {
+		_, err := copyDir(logger, srcDir, destDir, src, dest, options)
+		require.NoError(t, err)
+	}
+	eval, err := afero.ReadFile(dest, "eval/stacks/dev/cdk.tf.json")
+	require.NoError(t, err)
+	session, err := afero.ReadFile(dest, "session/stacks/dev/cdk.tf.json")
+	require.NoError(t, err)
+	require.Equal(t, string(eval), string(session), "the run directory is replaced")
+	other, err := afero.ReadFile(dest, "other/stacks/dev/cdk.tf.json")
+	require.NoError(t, err)
+	require.Contains(t, string(other), "<workdir>/runs/x/cdktf.out", "only runs/<N> is a run directory")
+}
+
+func Test_copyDir_hcl(t *testing.T) {
+	logger := getPrettyLogger()
+	src := afero.NewMemMapFs()
+	stack := `{"//":{"metadata":{"stackName":"dev"}},"resource":{"null_resource":{"r":{"triggers":{"id":"${var.id}"}}}}}`
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/stacks/dev/cdk.tf.json", []byte(stack), 0644))
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/manifest.json", []byte("{}"), 0644))
+	dest := afero.NewMemMapFs()
+	options := models.CopyOptions{Mode: models.CopySync, HCL: &models.HCLOptions{}}
+
+	result, err := copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"manifest.json", "stacks/dev/cdk.tf"}, result.Added)
+	content, err := afero.ReadFile(dest, "out/stacks/dev/cdk.tf")
+	require.NoError(t, err)
+	require.Equal(t, `resource "null_resource" "r" {
+  triggers = {
+    id = var.id
+  }
+}
+`, string(content))
+
+	// the HCL is compared in sync mode, the stale JSON is deleted
+	require.NoError(t, afero.WriteFile(dest, "out/stacks/dev/cdk.tf.json", []byte(stack), 0644))
+	result, err = copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"manifest.json", "stacks/dev/cdk.tf"}, result.Unchanged)
+	require.Equal(t, []string{"stacks/dev/cdk.tf.json"}, result.Deleted)
+
+	// an object which may be a nested block fails without the schema
+	sg := `{"resource":{"aws_security_group":{"sg":{"ingress":[{"from_port":80}]}}}}`
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/stacks/dev/cdk.tf.json", []byte(sg), 0644))
+	_, err = copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.ErrorContains(t, err, "resource.aws_security_group.sg: ingress may be a nested block or an attribute")
+
+	schemaFile := filepath.Join(t.TempDir(), "schema.json")
+	schema := `{"provider_schemas":{"registry.terraform.io/hashicorp/aws":{"resource_schemas":{"aws_security_group":{"block":{"block_types":{"ingress":{"nesting_mode":"set","block":{}}}}}}}}}`
+	require.NoError(t, os.WriteFile(schemaFile, []byte(schema), 0644))
+	options.HCL.SchemaFile = schemaFile
+	_, err = copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.NoError(t, err)
+	content, err = afero.ReadFile(dest, "out/stacks/dev/cdk.tf")
+	require.NoError(t, err)
+	require.Equal(t, `resource "aws_security_group" "sg" {
+  ingress {
+    from_port = 80
+  }
+}
+`, string(content))
+
+	options.HCL.SchemaFile = filepath.Join(t.TempDir(), "missing.json")
+	_, err = copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.ErrorContains(t, err, "failed to read the HCL schema file")
+	options.HCL.SchemaFile = ""
+
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/stacks/dev/cdk.tf.json", []byte(`{"ephemeral":{}}`), 0644))
+	_, err = copyDir(logger, "cdktf.out", "out", src, dest, options)
+	require.ErrorContains(t, err, `failed to convert cdktf.out/stacks/dev/cdk.tf.json to HCL: unsupported top-level block "ephemeral"`)
+}
+
+func Test_copyDir_preserve(t *testing.T) {
+	logger := getPrettyLogger()
+	root := t.TempDir()
+	src := afero.NewBasePathFs(afero.NewOsFs(), filepath.Join(root, "src"))
+	dest := afero.NewBasePathFs(afero.NewOsFs(), filepath.Join(root, "dest"))
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, src.MkdirAll("bin", 0755))
+	require.NoError(t, afero.WriteFile(src, "bin/run.sh", []byte("#!/bin/sh"), 0755))
+	require.NoError(t, src.Chmod("bin/run.sh", 0755))
+	require.NoError(t, src.Chtimes("bin/run.sh", mtime, mtime))
+	require.NoError(t, src.Chmod("bin", 0750))
+	require.NoError(t, src.Chtimes("bin", mtime, mtime))
+
+	_, err := copyDir(logger, ".", "default", src, dest, models.CopyOptions{})
+	require.NoError(t, err)
+	info, err := dest.Stat("default/bin/run.sh")
+	require.NoError(t, err)
+	require.Zero(t, info.Mode().Perm()&0111, "the executable bit is not kept by default")
+	require.NotEqual(t, mtime, info.ModTime())
+
+	options := models.CopyOptions{Mode: models.CopySync, PreserveMode: true, PreserveTimes: true}
+	result, err := copyDir(logger, ".", "preserved", src, dest, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bin/run.sh"}, result.Added)
+	info, err = dest.Stat("preserved/bin/run.sh")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	require.True(t, mtime.Equal(info.ModTime()))
+	info, err = dest.Stat("preserved/bin")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	require.True(t, mtime.Equal(info.ModTime()))
+
+	// a mode change alone updates the file
+	require.NoError(t, src.Chmod("bin/run.sh", 0700))
+	result, err = copyDir(logger, ".", "preserved", src, dest, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bin/run.sh"}, result.Updated)
+	result, err = copyDir(logger, ".", "preserved", src, dest, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bin/run.sh"}, result.Unchanged)
+}
+
+func Test_copyDir_symlinks(t *testing.T) {
+	logger := getPrettyLogger()
+	root := t.TempDir()
+	srcDir := filepath.Join(root, "src")
+	for path, content := range map[string]string{
+		"a.txt":     "a",
+		"lib/x.txt": "x",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(srcDir, path)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, path), []byte(content), 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(srcDir, "b.txt")))
+	require.NoError(t, os.Symlink("lib", filepath.Join(srcDir, "libLink")))
+	require.NoError(t, os.Symlink("../a.txt", filepath.Join(srcDir, "sub", "up.txt")))
+	require.NoError(t, os.Symlink(filepath.Join(srcDir, "lib", "x.txt"), filepath.Join(srcDir, "sub", "abs.txt")))
+	src := afero.NewBasePathFs(afero.NewOsFs(), srcDir)
+
+	readLink := func(t *testing.T, path string) string {
+		target, err := os.Readlink(path)
+		require.NoError(t, err)
+		return target
+	}
+
+	t.Run("follow", func(t *testing.T) {
+		destDir := filepath.Join(root, "follow")
+		_, err := copyDir(logger, ".", destDir, src, afero.NewOsFs(), models.CopyOptions{})
+		require.NoError(t, err)
+		for path, content := range map[string]string{
+			"b.txt":         "a",
+			"libLink/x.txt": "x",
+			"sub/up.txt":    "a",
+			"sub/abs.txt":   "x",
+		} {
+			info, err := os.Lstat(filepath.Join(destDir, path))
+			require.NoError(t, err)
+			require.True(t, info.Mode().IsRegular(), path)
+			data, err := os.ReadFile(filepath.Join(destDir, path))
+			require.NoError(t, err)
+			require.Equal(t, content, string(data))
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		destDir := filepath.Join(root, "copy")
+		options := models.CopyOptions{Mode: models.CopySync, Symlinks: models.SymlinksCopy}
+		result, err := copyDir(logger, ".", destDir, src, afero.NewOsFs(), options)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a.txt", "b.txt", "lib/x.txt", "libLink", "sub/abs.txt", "sub/up.txt"}, result.Added)
+		require.Equal(t, "a.txt", readLink(t, filepath.Join(destDir, "b.txt")))
+		require.Equal(t, "lib", readLink(t, filepath.Join(destDir, "libLink")))
+		require.Equal(t, "../a.txt", readLink(t, filepath.Join(destDir, "sub", "up.txt")))
+		require.Equal(t, filepath.Join("..", "lib", "x.txt"), readLink(t, filepath.Join(destDir, "sub", "abs.txt")))
+
+		result, err = copyDir(logger, ".", destDir, src, afero.NewOsFs(), options)
+		require.NoError(t, err)
+		require.Empty(t, result.Added)
+		require.Len(t, result.Unchanged, 6)
+	})
+
+	t.Run("copy without symlink support", func(t *testing.T) {
+		dest := afero.NewMemMapFs()
+		_, err := copyDir(logger, ".", "out", src, dest, models.CopyOptions{Symlinks: models.SymlinksCopy})
+		require.NoError(t, err)
+		data, err := afero.ReadFile(dest, "out/libLink/x.txt")
+		require.NoError(t, err)
+		require.Equal(t, "x", string(data))
+	})
+
+	testCases := []struct {
+		name     string
+		target   string
+		symlinks []models.SymlinkMode
+		wantErr  string
+	}{
+		{name: "relative escape", target: "../outside.txt", wantErr: "escapes the source directory"},
+		{name: "absolute escape", target: filepath.Join(root, "outside.txt"), wantErr: "escapes the source directory"},
+		{name: "escape through a symlinked directory", target: "escape/outside.txt", wantErr: "escapes the source directory"},
+		{name: "cycle", target: ".", symlinks: []models.SymlinkMode{models.SymlinksFollow}, wantErr: "points to its parent directory"},
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "outside.txt"), []byte("secret"), 0644))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := filepath.Join(t.TempDir(), "src")
+			require.NoError(t, os.Mkdir(srcDir, 0755))
+			require.NoError(t, os.Symlink(root, filepath.Join(srcDir, "escape")))
+			require.NoError(t, os.Symlink(tc.target, filepath.Join(srcDir, "link")))
+			if tc.symlinks == nil {
+				tc.symlinks = []models.SymlinkMode{models.SymlinksFollow, models.SymlinksCopy}
+			}
+			for _, symlinks := range tc.symlinks {
+				_, err := copyDir(logger, srcDir, filepath.Join(t.TempDir(), "dest"), afero.NewOsFs(), afero.NewOsFs(), models.CopyOptions{
+					Symlinks:       symlinks,
+					IgnorePatterns: []string{"/escape"},
+				})
+				require.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func Test_archiveDir(t *testing.T) {
+	logger := getPrettyLogger()
+	src := afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
+	require.NoError(t, src.MkdirAll("cdktf.out/stacks/a", 0755))
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/stacks/a/cdk.tf.json", []byte("{}"), 0600))
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/run.sh", []byte("#!/bin/sh"), 0700))
+	require.NoError(t, src.Chmod("cdktf.out/run.sh", 0700))
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/manifest.json", []byte("m"), 0644))
+	require.NoError(t, afero.WriteFile(src, "cdktf.out/debug.log", []byte("log"), 0644))
+	require.NoError(t, src.(afero.Linker).SymlinkIfPossible("cdktf.out/manifest.json", "cdktf.out/link.json"))
+	options := models.CopyOptions{Mode: models.CopySync, Symlinks: models.SymlinksCopy, IgnorePatterns: []string{"*.log"}}
+
+	var first bytes.Buffer
+	result, err := archiveDir(logger, "cdktf.out", src, &first, models.ArchiveTarGz, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"link.json", "manifest.json", "run.sh", "stacks/a/cdk.tf.json"}, result.Added)
+
+	// the modification times are not archived
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, src.Chtimes("cdktf.out/manifest.json", mtime, mtime))
+	var second bytes.Buffer
+	_, err = archiveDir(logger, "cdktf.out", src, &second, models.ArchiveTarGz, options)
+	require.NoError(t, err)
+	require.Equal(t, first.Bytes(), second.Bytes())
+
+	gz, err := gzip.NewReader(&first)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	modes := map[string]int64{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, int64(0), header.ModTime.Unix())
+		modes[header.Name] = header.Mode
+	}
+	require.Equal(t, map[string]int64{
+		"link.json":            0644,
+		"manifest.json":        0644,
+		"run.sh":               0755,
+		"stacks/a/cdk.tf.json": 0644,
+	}, modes)
+
+	_, err = archiveDir(logger, "cdktf.out", src, io.Discard, "rar", options)
+	require.EqualError(t, err, `unknown archive format "rar"`)
+
+	// the entries are ordered by full path like archive.Write
+	files := map[string][]byte{"a.txt": []byte("a"), "a/b.json": []byte("b"), "a-c/d.json": []byte("d")}
+	mem := afero.NewMemMapFs()
+	for name, content := range files {
+		require.NoError(t, afero.WriteFile(mem, filepath.Join("out", name), content, 0644))
+	}
+	var got, want bytes.Buffer
+	_, err = archiveDir(logger, "out", mem, &got, models.ArchiveZip, models.CopyOptions{})
+	require.NoError(t, err)
+	require.NoError(t, archive.Write(&want, models.ArchiveZip, files))
+	require.Equal(t, want.Bytes(), got.Bytes())
+}
+
+func Test_installedVersions(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "node_modules/cdktf/package.json", []byte(`{"name":"cdktf","version":"0.20.8"}`), 0644))
+	require.NoError(t, afero.WriteFile(fs, "node_modules/@cdktf/provider-aws/package.json", []byte(`{"version":"19.0.0"}`), 0644))
+	config := &models.AppConfig{
+		Dependencies:    map[string]string{"cdktf": "^0.20.7"},
+		DevDependencies: map[string]string{"@cdktf/provider-aws": "^19"},
+	}
+
+	versions, err := installedVersions(fs, config)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"cdktf": "0.20.8", "@cdktf/provider-aws": "19.0.0"}, versions)
+
+	config.Dependencies["constructs"] = "^10"
+	_, err = installedVersions(fs, config)
+	require.ErrorContains(t, err, "failed to read the installed version of constructs")
+	_, err = installedVersions(fs, nil)
+	require.ErrorContains(t, err, "Setup has not run")
+}
+
+func Test_removeDir(t *testing.T) {
+	testCases := []struct {
+		name    string
+		dir     string
+		wantErr bool
+	}{
+		{name: "run directory", dir: "runs/1"},
+		{name: "working directory", dir: ".", wantErr: true},
+		{name: "root", dir: "/", wantErr: true},
+		{name: "parent directory", dir: "runs/../..", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "runs/1/main.ts", []byte(""), 0644))
+			err := removeDir(fs, tc.dir)
+			if tc.wantErr {
+				require.Error(t, err)
+				require.True(t, fileExists(fs, "runs/1/main.ts"))
+				return
+			}
+			require.NoError(t, err)
+			require.False(t, fileExists(fs, "runs/1"))
+		})
+	}
+}
+
 func fileExists(fs afero.Fs, path string) bool {
 	_, err := fs.Stat(path)
 	return err == nil
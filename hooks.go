@@ -0,0 +1,137 @@
+package synth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/models"
+)
+
+// Phase is a step of Eval.
+type Phase string
+
+const (
+	// PhaseSetup installs the dependencies.
+	PhaseSetup Phase = "setup"
+	// PhaseExec runs main.ts.
+	PhaseExec Phase = "exec"
+	// PhaseCopy copies the result out.
+	PhaseCopy Phase = "copy"
+)
+
+// PhaseInfo describes a phase of Eval.
+type PhaseInfo struct {
+	// Phase is the step of Eval.
+	Phase Phase
+	// Start is when the phase started.
+	Start time.Time
+	// Duration of the phase, only set for after hooks.
+	Duration time.Duration
+	// Err is the outcome of the phase, only set for after hooks and OnError.
+	Err error
+	// Copy lists the files handled by the copy phase, only set for its after hook.
+	Copy *models.CopyResult
+}
+
+// Hooks are called around every Eval phase.
+//
+// An error returned by a before hook aborts Eval before the phase runs, e.g.
+// to veto a copy. An error returned by an after hook fails Eval.
+type Hooks interface {
+	BeforeSetup(ctx context.Context, e models.Executor, info PhaseInfo) error
+	AfterSetup(ctx context.Context, e models.Executor, info PhaseInfo) error
+	BeforeExec(ctx context.Context, e models.Executor, info PhaseInfo) error
+	AfterExec(ctx context.Context, e models.Executor, info PhaseInfo) error
+	BeforeCopy(ctx context.Context, e models.Executor, info PhaseInfo) error
+	AfterCopy(ctx context.Context, e models.Executor, info PhaseInfo) error
+	// OnError is called once with the phase which failed Eval.
+	//
+	// Failures to get the Executor and of AppConfig.PreSetupFn are reported
+	// with PhaseSetup, e is nil when the Executor could not be created.
+	OnError(ctx context.Context, e models.Executor, info PhaseInfo)
+}
+
+// NopHooks does nothing, embed it to implement a subset of Hooks.
+type NopHooks struct{}
+
+func (NopHooks) BeforeSetup(ctx context.Context, e models.Executor, info PhaseInfo) error { return nil }
+func (NopHooks) AfterSetup(ctx context.Context, e models.Executor, info PhaseInfo) error  { return nil }
+func (NopHooks) BeforeExec(ctx context.Context, e models.Executor, info PhaseInfo) error  { return nil }
+func (NopHooks) AfterExec(ctx context.Context, e models.Executor, info PhaseInfo) error   { return nil }
+func (NopHooks) BeforeCopy(ctx context.Context, e models.Executor, info PhaseInfo) error  { return nil }
+func (NopHooks) AfterCopy(ctx context.Context, e models.Executor, info PhaseInfo) error   { return nil }
+func (NopHooks) OnError(ctx context.Context, e models.Executor, info PhaseInfo)           {}
+
+// multiHooks calls each Hooks in order.
+type multiHooks []Hooks
+
+// before calls the before hook of the phase, stopping at the first error.
+func (m multiHooks) before(ctx context.Context, e models.Executor, info PhaseInfo) error {
+	for _, h := range m {
+		var err error
+		switch info.Phase {
+		case PhaseSetup:
+			err = h.BeforeSetup(ctx, e, info)
+		case PhaseExec:
+			err = h.BeforeExec(ctx, e, info)
+		case PhaseCopy:
+			err = h.BeforeCopy(ctx, e, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// after calls the after hook of the phase on all hooks, joining the errors.
+func (m multiHooks) after(ctx context.Context, e models.Executor, info PhaseInfo) error {
+	var errs []error
+	for _, h := range m {
+		switch info.Phase {
+		case PhaseSetup:
+			errs = append(errs, h.AfterSetup(ctx, e, info))
+		case PhaseExec:
+			errs = append(errs, h.AfterExec(ctx, e, info))
+		case PhaseCopy:
+			errs = append(errs, h.AfterCopy(ctx, e, info))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHooks) onError(ctx context.Context, e models.Executor, info PhaseInfo) {
+	for _, h := range m {
+		h.OnError(ctx, e, info)
+	}
+}
+
+// setupFailed calls the OnError hooks for a failure before the setup phase
+// runs, e.g. getting the Executor, and returns err.
+func (a *app) setupFailed(ctx context.Context, e models.Executor, err error) error {
+	a.hooks.onError(ctx, e, PhaseInfo{Phase: PhaseSetup, Start: a.now(), Err: err})
+	return err
+}
+
+// runPhase runs fn between the before and after hooks of phase, fn may fill in the info of the after hooks.
+func (a *app) runPhase(ctx context.Context, e models.Executor, phase Phase, fn func(info *PhaseInfo) error) error {
+	info := PhaseInfo{
+		Phase: phase,
+		Start: a.now(),
+	}
+	err := a.hooks.before(ctx, e, info)
+	if err == nil {
+		err = fn(&info)
+		info.Duration = a.now().Sub(info.Start)
+		info.Err = err
+		if hookErr := a.hooks.after(ctx, e, info); err == nil {
+			err = hookErr
+		}
+	}
+	if err != nil {
+		info.Err = err
+		a.hooks.onError(ctx, e, info)
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+// Package ignore matches paths against gitignore style patterns.
+//
+// The patterns follow https://git-scm.com/docs/gitignore:
+//
+//   - a pattern without a slash, other than a trailing one, matches a name at any depth;
+//   - a leading or middle slash anchors the pattern to the directory it is defined in;
+//   - a trailing slash only matches directories;
+//   - `*`, `?` and `[...]` match within a path segment, `**` matches any number of segments;
+//   - a leading `!` negates the pattern, the last matching pattern wins;
+//   - blank lines and lines starting with `#` are skipped.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pattern is a parsed gitignore line.
+type pattern struct {
+	raw string
+	// base is the slash separated directory the pattern is relative to, "" for the root.
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// Matcher matches paths against an ordered list of patterns.
+//
+// The zero value matches nothing.
+type Matcher struct {
+	patterns []pattern
+}
+
+// New returns a Matcher of the patterns relative to the root.
+func New(patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+	if err := m.Add("", patterns...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add appends patterns relative to the base directory, e.g. the directory of
+// the ignore file they were read from.
+func (m *Matcher) Add(base string, patterns ...string) error {
+	base = strings.Trim(filepath.ToSlash(filepath.Clean(base)), "/")
+	if base == "." {
+		base = ""
+	}
+	for _, line := range patterns {
+		p, ok, err := parse(base, line)
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the Matcher has no patterns.
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.patterns) == 0
+}
+
+// Match reports whether the slash or OS separated relative path matches.
+//
+// Like git, a path inside a matching directory matches as well, it can not be
+// negated by a later pattern.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	if m.Empty() {
+		return false
+	}
+	segments := strings.Split(strings.Trim(filepath.ToSlash(filepath.Clean(relPath)), "/"), "/")
+	if len(segments) == 1 && (segments[0] == "." || segments[0] == "") {
+		return false
+	}
+	for i := 1; i < len(segments); i++ {
+		if m.matchSelf(segments[:i], true) {
+			return true
+		}
+	}
+	return m.matchSelf(segments, isDir)
+}
+
+// matchSelf returns the result of the last pattern matching the path itself.
+func (m *Matcher) matchSelf(segments []string, isDir bool) bool {
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		p := m.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.match(segments) {
+			return !p.negate
+		}
+	}
+	return false
+}
+
+// ReadPatterns returns the lines of an ignore file, the comments and blank
+// lines are skipped by Add.
+func ReadPatterns(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read patterns: %w", err)
+	}
+	return lines, nil
+}
+
+// parse returns the pattern of line, false for blank lines and comments.
+func parse(base, line string) (pattern, bool, error) {
+	p := pattern{raw: line, base: base}
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false, nil
+	}
+	// a pattern without a slash matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	p.segments = strings.Split(line, "/")
+	if !anchored && p.segments[0] != "**" {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	for _, segment := range p.segments {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return p, false, fmt.Errorf("invalid pattern %q: %w", p.raw, err)
+		}
+	}
+	return p, true, nil
+}
+
+// trimTrailingSpaces removes the trailing spaces not escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// match reports whether the pattern matches the path segments relative to the root.
+func (p pattern) match(segments []string) bool {
+	if p.base != "" {
+		baseSegments := strings.Split(p.base, "/")
+		if len(segments) <= len(baseSegments) {
+			return false
+		}
+		for i, s := range baseSegments {
+			if segments[i] != s {
+				return false
+			}
+		}
+		segments = segments[len(baseSegments):]
+	}
+	return matchSegments(p.segments, segments)
+}
+
+// matchSegments matches the pattern segments, where ** matches zero or more
+// segments and a trailing ** one or more.
+func matchSegments(patterns, segments []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			if len(patterns) == 1 {
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(patterns[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(patterns[0], segments[0]); !ok {
+			return false
+		}
+		patterns, segments = patterns[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
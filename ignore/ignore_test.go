@@ -0,0 +1,81 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatcher_Match(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{name: "unanchored name at the root", patterns: []string{"test.txt"}, path: "test.txt", want: true},
+		{name: "unanchored name at any depth", patterns: []string{"test.txt"}, path: "a/b/test.txt", want: true},
+		{name: "unanchored glob", patterns: []string{"*.log"}, path: "a/debug.log", want: true},
+		{name: "anchored with leading slash", patterns: []string{"/test.txt"}, path: "a/test.txt", want: false},
+		{name: "anchored with leading slash at the root", patterns: []string{"/test.txt"}, path: "test.txt", want: true},
+		{name: "anchored with middle slash", patterns: []string{"a/*.txt"}, path: "b/a/test.txt", want: false},
+		{name: "star does not cross segments", patterns: []string{"a/*"}, path: "a/b/c.txt", want: true},
+		{name: "star does not cross segments for files", patterns: []string{"*/*.txt"}, path: "a/b/c.txt", want: false},
+		{name: "leading doublestar", patterns: []string{"**/cdk.tf.json"}, path: "stacks/a/cdk.tf.json", want: true},
+		{name: "middle doublestar matches no segment", patterns: []string{"a/**/b.txt"}, path: "a/b.txt", want: true},
+		{name: "middle doublestar matches many segments", patterns: []string{"a/**/b.txt"}, path: "a/x/y/b.txt", want: true},
+		{name: "trailing doublestar matches the contents", patterns: []string{"a/**"}, path: "a/x/y.txt", want: true},
+		{name: "trailing doublestar does not match the directory", patterns: []string{"a/**"}, path: "a", isDir: true, want: false},
+		{name: "directory only pattern skips files", patterns: []string{"build/"}, path: "build", want: false},
+		{name: "directory only pattern matches directories", patterns: []string{"build/"}, path: "x/build", isDir: true, want: true},
+		{name: "directory only pattern matches the contents", patterns: []string{"build/"}, path: "build/out.js", want: true},
+		{name: "negation", patterns: []string{"*.txt", "!keep.txt"}, path: "a/keep.txt", want: false},
+		{name: "last pattern wins", patterns: []string{"!keep.txt", "*.txt"}, path: "keep.txt", want: true},
+		{name: "negation can not re-include from a matching directory", patterns: []string{"a/", "!a/keep.txt"}, path: "a/keep.txt", want: true},
+		{name: "negation re-includes from a matching glob", patterns: []string{"a/*", "!a/keep.txt"}, path: "a/keep.txt", want: false},
+		{name: "comments and blank lines", patterns: []string{"# test.txt", "", "   "}, path: "test.txt", want: false},
+		{name: "escaped hash", patterns: []string{`\#test.txt`}, path: "#test.txt", want: true},
+		{name: "escaped bang", patterns: []string{`\!test.txt`}, path: "!test.txt", want: true},
+		{name: "trailing spaces are trimmed", patterns: []string{"test.txt  "}, path: "test.txt", want: true},
+		{name: "OS separators", patterns: []string{"a/b"}, path: "a/b/", isDir: true, want: true},
+		{name: "root never matches", patterns: []string{"**"}, path: ".", isDir: true, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := New(tc.patterns...)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, m.Match(tc.path, tc.isDir))
+		})
+	}
+}
+
+func TestMatcher_Add(t *testing.T) {
+	m, err := New("*.log")
+	require.NoError(t, err)
+	// patterns of a nested ignore file are relative to its directory
+	require.NoError(t, m.Add("sub", "/local.txt", "!keep.log"))
+
+	require.True(t, m.Match("debug.log", false))
+	require.True(t, m.Match("other/keep.log", false))
+	require.False(t, m.Match("sub/keep.log", false))
+	require.True(t, m.Match("sub/local.txt", false))
+	require.False(t, m.Match("local.txt", false))
+	require.False(t, m.Match("sub/x/local.txt", false))
+
+	_, err = New("[a-")
+	require.ErrorContains(t, err, `invalid pattern "[a-"`)
+	require.True(t, (*Matcher)(nil).Empty())
+	require.False(t, (*Matcher)(nil).Match("a", false))
+}
+
+func TestReadPatterns(t *testing.T) {
+	lines, err := ReadPatterns(strings.NewReader("# comment\n*.log\r\n\n!keep.log\n"))
+	require.NoError(t, err)
+	m, err := New(lines...)
+	require.NoError(t, err)
+	require.True(t, m.Match("debug.log", false))
+	require.False(t, m.Match("keep.log", false))
+	require.False(t, m.Match("# comment", false))
+}
@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/archive"
+)
+
+// followInterval is how often followed logs are polled.
+const followInterval = 250 * time.Millisecond
+
+// Handler returns the HTTP API of the Manager, bodies over maxRequestBytes are rejected:
+//
+//	POST /v1/jobs                  Request body, queues a Job
+//	GET  /v1/jobs                  lists the jobs
+//	GET  /v1/jobs/{id}             returns the Job
+//	POST /v1/jobs/{id}/cancel      cancels the Job
+//	GET  /v1/jobs/{id}/logs        returns the log lines from ?offset=, ?follow=true streams them until the job is done
+//	GET  /v1/jobs/{id}/artifact    returns the result as ?format=tar.gz (default), zip or files
+func (m *Manager) Handler(maxRequestBytes int64) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeError(w, status, err)
+			return
+		}
+		job, err := m.Submit(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	})
+	mux.HandleFunc("GET /v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		jobs, err := m.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string][]*Job{"jobs": jobs})
+	})
+	mux.HandleFunc("GET /v1/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Get(r.PathValue("id"))
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("POST /v1/jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Cancel(r.PathValue("id"))
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	})
+	mux.HandleFunc("GET /v1/jobs/{id}/logs", m.handleLogs)
+	mux.HandleFunc("GET /v1/jobs/{id}/artifact", m.handleArtifact)
+	return mux
+}
+
+func (m *Manager) handleLogs(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		var err error
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid offset %q", v))
+			return
+		}
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+	flusher, _ := w.(http.Flusher)
+	started := false
+	for {
+		// read the state first so the lines written before the job is done are sent
+		job, err := m.Get(id)
+		if err != nil {
+			if !started {
+				writeStoreError(w, err)
+			}
+			return
+		}
+		lines, err := m.Logs(id, offset)
+		if err != nil {
+			if !started {
+				writeError(w, http.StatusInternalServerError, err)
+			}
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return
+			}
+		}
+		offset += len(lines)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !follow || job.State.Done() {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(followInterval):
+		}
+	}
+}
+
+func (m *Manager) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	job, err := m.Get(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if job.State != StateSucceeded {
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s is %s", id, job.State))
+		return
+	}
+	files, err := m.Artifact(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "tar.gz":
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".tar.gz"))
+		_ = archive.TarGz(w, files)
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".zip"))
+		_ = archive.Zip(w, files)
+	case "files":
+		contents := make(map[string]string, len(files))
+		for name, content := range files {
+			contents[name] = string(content)
+		}
+		writeJSON(w, http.StatusOK, map[string]map[string]string{"files": contents})
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown format %q, expected one of tar.gz, zip, files", format))
+	}
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// the client went away if the body can not be written
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestManager_Handler(t *testing.T) {
+	store, _ := newTestStore(t)
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(store, fakeRunner, zap.NewNop())
+	require.NoError(t, m.Start(ctx))
+	ts := httptest.NewServer(m.Handler(1024))
+	defer ts.Close()
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, body
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/jobs", "application/json", strings.NewReader(`{"mainTs": "// stack"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var job Job
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	resp.Body.Close()
+
+	// following the logs returns once the job is done
+	status, body := get("/v1/jobs/" + job.ID + "/logs?follow=true")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "synthesizing\n", string(body))
+	status, body = get("/v1/jobs/" + job.ID + "/logs?offset=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Empty(t, body)
+
+	status, body = get("/v1/jobs/" + job.ID)
+	require.Equal(t, http.StatusOK, status)
+	require.NoError(t, json.Unmarshal(body, &job))
+	require.Equal(t, StateSucceeded, job.State)
+
+	status, body = get("/v1/jobs/" + job.ID + "/artifact?format=zip")
+	require.Equal(t, http.StatusOK, status)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	require.Equal(t, "main.tf.json", zr.File[0].Name)
+
+	status, body = get("/v1/jobs/" + job.ID + "/artifact?format=files")
+	require.Equal(t, http.StatusOK, status)
+	require.JSONEq(t, `{"files": {"main.tf.json": "// stack"}}`, string(body))
+
+	status, body = get("/v1/jobs")
+	require.Equal(t, http.StatusOK, status)
+	var list struct{ Jobs []Job }
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list.Jobs, 1)
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "unknown job", method: http.MethodGet, path: "/v1/jobs/missing", wantStatus: http.StatusNotFound},
+		{name: "cancel unknown job", method: http.MethodPost, path: "/v1/jobs/missing/cancel", wantStatus: http.StatusNotFound},
+		{name: "missing script", method: http.MethodPost, path: "/v1/jobs", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "too large", method: http.MethodPost, path: "/v1/jobs", body: `{"mainTs": "` + strings.Repeat("a", 2048) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "unknown format", method: http.MethodGet, path: "/v1/jobs/" + job.ID + "/artifact?format=rar", wantStatus: http.StatusBadRequest},
+		{name: "invalid offset", method: http.MethodGet, path: "/v1/jobs/" + job.ID + "/logs?offset=-1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tc.wantStatus, resp.StatusCode)
+		})
+	}
+
+	// the artifact of a failed job is a conflict
+	resp, err = http.Post(ts.URL+"/v1/jobs", "application/json", strings.NewReader(`{"mainTs": "// fail"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	resp.Body.Close()
+	waitState(t, m, job.ID, StateFailed)
+	status, _ = get("/v1/jobs/" + job.ID + "/artifact")
+	require.Equal(t, http.StatusConflict, status)
+}
@@ -0,0 +1,64 @@
+// Package jobs runs synth requests asynchronously, persisting their status, logs and artifacts.
+package jobs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/models"
+)
+
+// State is the lifecycle state of a Job.
+type State string
+
+const (
+	// StateQueued jobs wait for a worker.
+	StateQueued State = "queued"
+	// StateRunning jobs are run by a worker.
+	StateRunning State = "running"
+	// StateSucceeded jobs have an artifact.
+	StateSucceeded State = "succeeded"
+	// StateFailed jobs have an Error.
+	StateFailed State = "failed"
+	// StateCanceled jobs were canceled before they completed.
+	StateCanceled State = "canceled"
+)
+
+// Done reports whether the state is final.
+func (s State) Done() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCanceled
+}
+
+// ErrNotFound is returned for unknown job IDs.
+var ErrNotFound = errors.New("job not found")
+
+// errSecretsLost fails the Redacted jobs whose secret values were not kept by the process.
+var errSecretsLost = errors.New("the secret env vars of the job are not stored, submit it again")
+
+// Request is the synth request of a Job.
+type Request struct {
+	// MainTs is the main.ts script to run.
+	MainTs string `json:"mainTs"`
+	// Src is the directory stored as the artifact once the script has run, defaults to cdktf.out.
+	Src string `json:"src,omitempty"`
+	// Config is used instead of the default config of the Runner.
+	Config *models.AppConfig `json:"config,omitempty"`
+}
+
+// Job is a persisted synth request.
+type Job struct {
+	ID      string  `json:"id"`
+	State   State   `json:"state"`
+	Request Request `json:"request"`
+	// Error is set for failed and canceled jobs.
+	Error string `json:"error,omitempty"`
+	// Redacted is set when the values of the SecretEnvVars of the request config
+	// were blanked before the job was stored, they are only kept in memory and
+	// the job fails if it is resumed by another process.
+	Redacted bool `json:"redacted,omitempty"`
+	// Attempts is the number of times a worker started the job.
+	Attempts   int        `json:"attempts"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
@@ -0,0 +1,405 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/environment-toolkit/go-synth"
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/environment-toolkit/go-synth/auth"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+)
+
+// Runner runs req, writing each line of the executor output to logs and the result to dest in dstFs.
+type Runner func(ctx context.Context, req Request, logs io.Writer, dstFs afero.Fs, dest string) error
+
+// AppRunner returns a Runner evaluating each job in a new App.
+//
+// config is used for the requests without a config.
+func AppRunner(newFn models.NewExecutorFn, logger *zap.Logger, config models.AppConfig, opts ...synth.Option) Runner {
+	// authenticators are cached across the App of each job
+	opts = append([]synth.Option{synth.WithAuthProvider(auth.NewAuthProvider())}, opts...)
+	return func(ctx context.Context, req Request, logs io.Writer, dstFs afero.Fs, dest string) error {
+		app := synth.NewApp(newFn, logger, append(opts[:len(opts):len(opts)], synth.WithOutputSink(logs))...)
+		conf := config
+		if req.Config != nil {
+			conf = *req.Config
+		}
+		if err := app.Configure(ctx, conf); err != nil {
+			return err
+		}
+		src := req.Src
+		if src == "" {
+			src = "cdktf.out"
+		}
+		return app.Eval(ctx, dstFs, req.MainTs, src, dest)
+	}
+}
+
+// Manager queues the jobs and runs them with a pool of workers.
+type Manager struct {
+	store       Store
+	run         Runner
+	logger      *zap.Logger
+	workers     int
+	resume      bool
+	maxAttempts int
+	now         func() time.Time
+	filter      func(Request) (Request, error)
+
+	mu      sync.Mutex
+	pending []string
+	running map[string]*runningJob
+	// secrets holds the config of the Redacted jobs with the secret values.
+	secrets map[string]*models.AppConfig
+	notify  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// runningJob can be canceled by Cancel.
+type runningJob struct {
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// Option configures a Manager created by NewManager.
+type Option func(*Manager)
+
+// WithWorkers sets the number of jobs running at once, defaults to 1.
+func WithWorkers(n int) Option {
+	return func(m *Manager) {
+		m.workers = max(n, 1)
+	}
+}
+
+// WithResume re-queues the jobs left running by a previous process instead of failing them.
+//
+// A job is failed once it was started maxAttempts times, e.g. when it crashes the process.
+func WithResume(maxAttempts int) Option {
+	return func(m *Manager) {
+		m.resume = true
+		m.maxAttempts = max(maxAttempts, 1)
+	}
+}
+
+// WithRequestFilter checks and rewrites the submitted requests, e.g. to restrict
+// their config, an error rejects the request.
+func WithRequestFilter(fn func(Request) (Request, error)) Option {
+	return func(m *Manager) {
+		m.filter = fn
+	}
+}
+
+// WithClock sets the clock of the job timestamps, defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(m *Manager) {
+		m.now = now
+	}
+}
+
+// NewManager returns a Manager running the jobs of store with run.
+func NewManager(store Store, run Runner, logger *zap.Logger, opts ...Option) *Manager {
+	m := &Manager{
+		store:   store,
+		run:     run,
+		logger:  logger,
+		workers: 1,
+		now:     time.Now,
+		running: map[string]*runningJob{},
+		secrets: map[string]*models.AppConfig{},
+		notify:  make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Start recovers the jobs of a previous process and starts the workers until ctx is done.
+//
+// Queued jobs are run again. Jobs left running are failed, or re-queued with
+// WithResume. Jobs interrupted because ctx is done are queued again.
+func (m *Manager) Start(ctx context.Context) error {
+	jobs, err := m.store.List()
+	if err != nil {
+		return fmt.Errorf("error listing jobs: %w", err)
+	}
+	m.mu.Lock()
+	for _, job := range jobs {
+		switch job.State {
+		case StateQueued:
+			m.pending = append(m.pending, job.ID)
+		case StateRunning:
+			if m.resume && job.Attempts < m.maxAttempts {
+				job.State = StateQueued
+				m.pending = append(m.pending, job.ID)
+			} else {
+				m.finish(job, StateFailed, errors.New("interrupted by a restart"))
+			}
+			if err := m.store.Put(job); err != nil {
+				m.mu.Unlock()
+				return fmt.Errorf("error recovering job %s: %w", job.ID, err)
+			}
+		}
+	}
+	m.mu.Unlock()
+	m.signal()
+
+	for i := 0; i < m.workers; i++ {
+		m.wg.Add(1)
+		go m.work(ctx)
+	}
+	return nil
+}
+
+// Wait waits for the workers to stop once the context passed to Start is done.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Submit queues req and returns its Job.
+//
+// The values of the SecretEnvVars of the request config are blanked in the
+// store and the returned Job, see Job.Redacted.
+func (m *Manager) Submit(req Request) (*Job, error) {
+	if req.MainTs == "" {
+		return nil, errors.New("mainTs is required")
+	}
+	if m.filter != nil {
+		var err error
+		if req, err = m.filter(req); err != nil {
+			return nil, err
+		}
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{ID: id, State: StateQueued, Request: req, CreatedAt: m.now()}
+	var config *models.AppConfig
+	if req.Config != nil {
+		redacted, ok := req.Config.RedactSecrets()
+		if ok {
+			config = req.Config
+			job.Request.Config = &redacted
+			job.Redacted = true
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.store.Put(job); err != nil {
+		return nil, fmt.Errorf("error storing job: %w", err)
+	}
+	if config != nil {
+		m.secrets[id] = config
+	}
+	m.pending = append(m.pending, id)
+	m.signal()
+	return job, nil
+}
+
+// Get returns the job with id.
+func (m *Manager) Get(id string) (*Job, error) {
+	return m.store.Get(id)
+}
+
+// List returns all jobs, oldest first.
+func (m *Manager) List() ([]*Job, error) {
+	return m.store.List()
+}
+
+// Logs returns the log lines of the job from offset.
+func (m *Manager) Logs(id string, offset int) ([]string, error) {
+	if _, err := m.store.Get(id); err != nil {
+		return nil, err
+	}
+	return m.store.Logs(id, offset)
+}
+
+// Artifact returns the result files of a succeeded job.
+func (m *Manager) Artifact(id string) (map[string][]byte, error) {
+	return m.store.Artifact(id)
+}
+
+// Cancel cancels a queued or running job, a done job is returned as is.
+//
+// A running job is canceled once its Runner returns.
+func (m *Manager) Cancel(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	switch job.State {
+	case StateQueued:
+		m.finish(job, StateCanceled, context.Canceled)
+		if err := m.store.Put(job); err != nil {
+			return nil, err
+		}
+	case StateRunning:
+		if r, ok := m.running[id]; ok {
+			r.canceled = true
+			r.cancel()
+		}
+	}
+	return job, nil
+}
+
+// signal wakes up a worker, the pending jobs must be locked.
+func (m *Manager) signal() {
+	if len(m.pending) == 0 {
+		return
+	}
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) work(ctx context.Context) {
+	defer m.wg.Done()
+	for {
+		m.mu.Lock()
+		if len(m.pending) == 0 {
+			m.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.notify:
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			m.mu.Unlock()
+			return
+		}
+		id := m.pending[0]
+		m.pending = m.pending[1:]
+		// wake up another worker for the remaining jobs
+		m.signal()
+		m.mu.Unlock()
+		m.runJob(ctx, id)
+	}
+}
+
+// runJob runs the job with id if it is still queued.
+func (m *Manager) runJob(ctx context.Context, id string) {
+	m.mu.Lock()
+	job, err := m.store.Get(id)
+	if err != nil || job.State != StateQueued {
+		m.mu.Unlock()
+		return
+	}
+	req := job.Request
+	if job.Redacted {
+		if req.Config = m.secrets[id]; req.Config == nil {
+			m.finish(job, StateFailed, errSecretsLost)
+			if err := m.store.Put(job); err != nil {
+				m.logger.Error("error storing job", zap.String("job", id), zap.Error(err))
+			}
+			m.mu.Unlock()
+			return
+		}
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r := &runningJob{cancel: cancel}
+	m.running[id] = r
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, id)
+		m.mu.Unlock()
+	}()
+	started := m.now()
+	job.State = StateRunning
+	job.Attempts++
+	job.StartedAt = &started
+	err = m.store.Put(job)
+	m.mu.Unlock()
+	if err != nil {
+		m.logger.Error("error storing job", zap.String("job", id), zap.Error(err))
+		return
+	}
+
+	m.logger.Debug("running job", zap.String("job", id), zap.Int("attempt", job.Attempts))
+	err = m.runAndStore(jobCtx, job.ID, req)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case r.canceled:
+		m.finish(job, StateCanceled, context.Canceled)
+	case ctx.Err() != nil:
+		// interrupted by a shutdown, the next Start runs it again
+		job.State = StateQueued
+	case err != nil:
+		m.finish(job, StateFailed, err)
+	default:
+		m.finish(job, StateSucceeded, nil)
+	}
+	if err := m.store.Put(job); err != nil {
+		m.logger.Error("error storing job", zap.String("job", id), zap.Error(err))
+	}
+}
+
+// runAndStore runs req and stores its result files as the artifact of the job with id.
+func (m *Manager) runAndStore(ctx context.Context, id string, req Request) error {
+	dstFs := afero.NewMemMapFs()
+	logs := &logWriter{store: m.store, id: id, logger: m.logger}
+	if err := m.run(ctx, req, logs, dstFs, "out"); err != nil {
+		return err
+	}
+	files, err := archive.ReadFiles(dstFs, "out")
+	if err != nil {
+		return err
+	}
+	if err := m.store.PutArtifact(id, files); err != nil {
+		return fmt.Errorf("error storing artifact: %w", err)
+	}
+	return nil
+}
+
+// finish sets the final state of job.
+func (m *Manager) finish(job *Job, state State, err error) {
+	finished := m.now()
+	delete(m.secrets, job.ID)
+	job.State = state
+	job.FinishedAt = &finished
+	if err != nil {
+		job.Error = err.Error()
+	}
+}
+
+// logWriter stores each written line in the logs of a job.
+type logWriter struct {
+	store  Store
+	id     string
+	logger *zap.Logger
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	lines := strings.Split(strings.TrimSuffix(string(p), "\n"), "\n")
+	if err := w.store.AppendLog(w.id, lines...); err != nil {
+		// the output is logged regardless, do not fail the job
+		w.logger.Warn("error storing job logs", zap.String("job", w.id), zap.Error(err))
+	}
+	return len(p), nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
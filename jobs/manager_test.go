@@ -0,0 +1,271 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWait  = 5 * time.Second
+	pollInterval = 10 * time.Millisecond
+)
+
+// fakeRunner logs and synthesizes MainTs as main.tf.json.
+//
+// A script containing "fail" fails, one containing "block" waits for ctx, one
+// containing "token" synthesizes the TOKEN env var of the config.
+func fakeRunner(ctx context.Context, req Request, logs io.Writer, dstFs afero.Fs, dest string) error {
+	io.WriteString(logs, "synthesizing\n")
+	if strings.Contains(req.MainTs, "token") {
+		return afero.WriteFile(dstFs, filepath.Join(dest, "main.tf.json"), []byte(req.Config.EnvVars["TOKEN"]), 0644)
+	}
+	if strings.Contains(req.MainTs, "block") {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if strings.Contains(req.MainTs, "fail") {
+		return errors.New("synth failed")
+	}
+	return afero.WriteFile(dstFs, filepath.Join(dest, "main.tf.json"), []byte(req.MainTs), 0644)
+}
+
+func newTestStore(t *testing.T) (Store, string) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := OpenBoltStore(path)
+	require.NoError(t, err)
+	return store, path
+}
+
+func waitState(t *testing.T, m *Manager, id string, state State) *Job {
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Get(id)
+		require.NoError(t, err)
+		return job.State == state
+	}, defaultWait, pollInterval, "job %s should be %s", id, state)
+	return job
+}
+
+func TestManager(t *testing.T) {
+	store, _ := newTestStore(t)
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(store, fakeRunner, zap.NewNop(), WithWorkers(2))
+	require.NoError(t, m.Start(ctx))
+
+	_, err := m.Submit(Request{})
+	require.ErrorContains(t, err, "mainTs is required")
+
+	ok, err := m.Submit(Request{MainTs: "// stack"})
+	require.NoError(t, err)
+	require.Equal(t, StateQueued, ok.State)
+	failed, err := m.Submit(Request{MainTs: "// fail"})
+	require.NoError(t, err)
+
+	job := waitState(t, m, ok.ID, StateSucceeded)
+	require.Equal(t, 1, job.Attempts)
+	require.NotNil(t, job.FinishedAt)
+	files, err := m.Artifact(ok.ID)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"main.tf.json": []byte("// stack")}, files)
+	lines, err := m.Logs(ok.ID, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"synthesizing"}, lines)
+
+	job = waitState(t, m, failed.ID, StateFailed)
+	require.Equal(t, "synth failed", job.Error)
+
+	_, err = m.Logs("missing", 0)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManager_RequestFilter(t *testing.T) {
+	store, _ := newTestStore(t)
+	defer store.Close()
+	filter := func(req Request) (Request, error) {
+		if strings.Contains(req.MainTs, "reject") {
+			return req, errors.New("rejected")
+		}
+		req.Src = "out"
+		return req, nil
+	}
+	m := NewManager(store, fakeRunner, zap.NewNop(), WithRequestFilter(filter))
+
+	_, err := m.Submit(Request{MainTs: "// reject"})
+	require.EqualError(t, err, "rejected")
+	job, err := m.Submit(Request{MainTs: "// stack"})
+	require.NoError(t, err)
+	require.Equal(t, "out", job.Request.Src)
+}
+
+func TestManager_Secrets(t *testing.T) {
+	store, path := newTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager(store, fakeRunner, zap.NewNop())
+	require.NoError(t, m.Start(ctx))
+
+	config := &models.AppConfig{EnvVars: map[string]string{"TOKEN": "s3cret"}, SecretEnvVars: []string{"TOKEN"}}
+	job, err := m.Submit(Request{MainTs: "// token", Config: config})
+	require.NoError(t, err)
+	require.True(t, job.Redacted)
+	require.Equal(t, "", job.Request.Config.EnvVars["TOKEN"])
+	require.Equal(t, "s3cret", config.EnvVars["TOKEN"])
+
+	stored := waitState(t, m, job.ID, StateSucceeded)
+	data, err := json.Marshal(stored)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "s3cret")
+	files, err := m.Artifact(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"main.tf.json": []byte("s3cret")}, files)
+
+	// the secret values are not stored, a queued job can not run in the next process
+	cancel()
+	m.Wait()
+	require.NoError(t, store.Put(&Job{ID: "queued", State: StateQueued, Redacted: true, Request: Request{MainTs: "// token", Config: job.Request.Config}}))
+	require.NoError(t, store.Close())
+	store, err = OpenBoltStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	m = NewManager(store, fakeRunner, zap.NewNop())
+	require.NoError(t, m.Start(ctx))
+	failed := waitState(t, m, "queued", StateFailed)
+	require.Equal(t, errSecretsLost.Error(), failed.Error)
+}
+
+func TestManager_Cancel(t *testing.T) {
+	store, _ := newTestStore(t)
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(store, fakeRunner, zap.NewNop())
+	require.NoError(t, m.Start(ctx))
+
+	running, err := m.Submit(Request{MainTs: "// block"})
+	require.NoError(t, err)
+	waitState(t, m, running.ID, StateRunning)
+	// the only worker is busy
+	queued, err := m.Submit(Request{MainTs: "// stack"})
+	require.NoError(t, err)
+
+	job, err := m.Cancel(queued.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateCanceled, job.State)
+	_, err = m.Cancel(running.ID)
+	require.NoError(t, err)
+	job = waitState(t, m, running.ID, StateCanceled)
+	require.Equal(t, context.Canceled.Error(), job.Error)
+
+	// canceling a done job does nothing
+	job, err = m.Cancel(running.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateCanceled, job.State)
+	_, err = m.Cancel("missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+// failingStore fails to store the running jobs.
+type failingStore struct {
+	Store
+	failed atomic.Bool
+}
+
+func (s *failingStore) Put(job *Job) error {
+	if job.State == StateRunning {
+		s.failed.Store(true)
+		return errors.New("disk full")
+	}
+	return s.Store.Put(job)
+}
+
+func TestManager_StoreError(t *testing.T) {
+	base, _ := newTestStore(t)
+	defer base.Close()
+	store := &failingStore{Store: base}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(store, fakeRunner, zap.NewNop())
+	require.NoError(t, m.Start(ctx))
+
+	job, err := m.Submit(Request{MainTs: "// stack"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return store.failed.Load() && len(m.running) == 0
+	}, defaultWait, pollInterval, "a job failing to start should not be left running")
+	job, err = m.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateQueued, job.State)
+}
+
+func TestManager_Restart(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      []Option
+		attempts  int
+		wantState State
+	}{
+		{name: "fail running jobs", wantState: StateFailed},
+		{name: "resume running jobs", opts: []Option{WithResume(3)}, attempts: 1, wantState: StateSucceeded},
+		{name: "resume up to max attempts", opts: []Option{WithResume(3)}, attempts: 3, wantState: StateFailed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, path := newTestStore(t)
+			// a previous process crashed while running a job and before starting another
+			require.NoError(t, store.Put(&Job{ID: "running", State: StateRunning, Attempts: tc.attempts, Request: Request{MainTs: "// running"}}))
+			require.NoError(t, store.Put(&Job{ID: "queued", State: StateQueued, Request: Request{MainTs: "// queued"}}))
+			require.NoError(t, store.Close())
+
+			store, err := OpenBoltStore(path)
+			require.NoError(t, err)
+			defer store.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := NewManager(store, fakeRunner, zap.NewNop(), tc.opts...)
+			require.NoError(t, m.Start(ctx))
+
+			waitState(t, m, "queued", StateSucceeded)
+			job := waitState(t, m, "running", tc.wantState)
+			if tc.wantState == StateFailed {
+				require.Equal(t, "interrupted by a restart", job.Error)
+			}
+		})
+	}
+}
+
+func TestManager_Shutdown(t *testing.T) {
+	store, _ := newTestStore(t)
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager(store, fakeRunner, zap.NewNop())
+	require.NoError(t, m.Start(ctx))
+
+	job, err := m.Submit(Request{MainTs: "// block"})
+	require.NoError(t, err)
+	waitState(t, m, job.ID, StateRunning)
+	cancel()
+	m.Wait()
+
+	// the interrupted job runs again on the next start
+	job, err = m.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateQueued, job.State)
+}
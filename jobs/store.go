@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists the jobs, their logs and artifacts.
+//
+// A Store must be safe for concurrent use.
+type Store interface {
+	// Put creates or replaces job.
+	Put(job *Job) error
+	// Get returns the job with id or ErrNotFound.
+	Get(id string) (*Job, error)
+	// List returns all jobs, oldest first.
+	List() ([]*Job, error)
+	// AppendLog appends lines to the logs of the job.
+	AppendLog(id string, lines ...string) error
+	// Logs returns the log lines of the job from offset.
+	Logs(id string, offset int) ([]string, error)
+	// PutArtifact stores the result files of the job.
+	PutArtifact(id string, files map[string][]byte) error
+	// Artifact returns the result files of the job or ErrNotFound.
+	Artifact(id string) (map[string][]byte, error)
+	// Close releases the Store.
+	Close() error
+}
+
+var (
+	jobsBucket      = []byte("jobs")
+	logsBucket      = []byte("logs")
+	artifactsBucket = []byte("artifacts")
+)
+
+// boltStore is a Store in a bolt database file.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens or creates the bolt database at path.
+func OpenBoltStore(path string) (Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening job store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, logsBucket, artifactsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initializing job store %s: %w", path, err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Put(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+}
+
+func (s *boltStore) Get(id string) (*Job, error) {
+	var job *Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		job = &Job{}
+		return json.Unmarshal(data, job)
+	})
+	return job, err
+}
+
+func (s *boltStore) List() ([]*Job, error) {
+	var jobs []*Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			job := &Job{}
+			if err := json.Unmarshal(v, job); err != nil {
+				return fmt.Errorf("error decoding job %s: %w", k, err)
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, err
+}
+
+// AppendLog stores each line under its sequence number in the bucket of the job.
+//
+// Concurrent calls are batched into a single transaction.
+func (s *boltStore) AppendLog(id string, lines ...string) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(logsBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := b.Put(seqKey(seq), []byte(line)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Logs(id string, offset int) ([]string, error) {
+	var lines []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(logsBucket).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		// sequences start at 1
+		c := b.Cursor()
+		for k, v := c.Seek(seqKey(uint64(offset) + 1)); k != nil; k, v = c.Next() {
+			lines = append(lines, string(v))
+		}
+		return nil
+	})
+	return lines, err
+}
+
+func (s *boltStore) PutArtifact(id string, files map[string][]byte) error {
+	data, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(artifactsBucket).Put([]byte(id), data)
+	})
+}
+
+func (s *boltStore) Artifact(id string) (map[string][]byte, error) {
+	var files map[string][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(artifactsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &files)
+	})
+	return files, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// seqKey encodes seq so the keys sort in sequence order.
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
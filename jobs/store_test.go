@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := OpenBoltStore(path)
+	require.NoError(t, err)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := &Job{ID: "b", State: StateQueued, Request: Request{MainTs: "// b"}, CreatedAt: created.Add(time.Second)}
+	first := &Job{ID: "a", State: StateRunning, Request: Request{MainTs: "// a"}, CreatedAt: created}
+	require.NoError(t, store.Put(second))
+	require.NoError(t, store.Put(first))
+	require.NoError(t, store.AppendLog("a", "one", "two"))
+	require.NoError(t, store.AppendLog("a", "three"))
+	require.NoError(t, store.PutArtifact("a", map[string][]byte{"manifest.json": []byte("{}")}))
+	require.NoError(t, store.Close())
+
+	// everything survives a restart
+	store, err = OpenBoltStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	jobs, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, "a", jobs[0].ID)
+	require.Equal(t, StateRunning, jobs[0].State)
+	require.Equal(t, "b", jobs[1].ID)
+
+	_, err = store.Get("missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	lines, err := store.Logs("a", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two", "three"}, lines)
+	lines, err = store.Logs("a", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"three"}, lines)
+	lines, err = store.Logs("b", 0)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	files, err := store.Artifact("a")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"manifest.json": []byte("{}")}, files)
+	_, err = store.Artifact("b")
+	require.ErrorIs(t, err, ErrNotFound)
+}
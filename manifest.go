@@ -0,0 +1,69 @@
+package synth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/manifest"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+)
+
+// ErrArchiveManifest is returned for archive requests when CopyOptions.Manifest is set,
+// the manifest is only written next to copied files.
+var ErrArchiveManifest = errors.New("copyOptions.manifest is not supported for archive requests")
+
+// checkRequest returns ErrArchiveManifest for an archive request with CopyOptions.Manifest set.
+func checkRequest(env *environment, req EvalRequest) error {
+	if req.Archive != nil && env.config.CopyOptions.Manifest != "" {
+		return ErrArchiveManifest
+	}
+	return nil
+}
+
+// writeManifest writes the manifest of the copied files to CopyOptions.Manifest in dest.
+func (a *app) writeManifest(ctx context.Context, env *environment, e models.Executor, fs afero.Fs, dest string, result models.CopyResult, start time.Time) error {
+	configHash, err := manifest.ConfigHash(hashedConfig(env.config))
+	if err != nil {
+		return err
+	}
+	// a merge copy keeps the files already in dest
+	metadata := manifest.Metadata{ConfigHash: configHash, StartedAt: start, Partial: env.config.CopyOptions.Mode != models.CopySync}
+	if reporter, ok := e.(models.DependencyReporter); ok {
+		metadata.Executor = reporter.Name()
+		if metadata.Dependencies, err = reporter.InstalledDependencies(ctx); err != nil {
+			return fmt.Errorf("error reading installed dependencies: %w", err)
+		}
+	}
+	metadata.CreatedAt = a.now()
+	m, err := manifest.Build(fs, dest, slices.Concat(result.Added, result.Updated, result.Unchanged), metadata)
+	if err != nil {
+		return fmt.Errorf("error building manifest: %w", err)
+	}
+	return manifest.Write(fs, filepath.Join(dest, env.config.CopyOptions.Manifest), m, a.manifestKey)
+}
+
+// hashedConfig returns the config without the values of its env vars, so the
+// config hash does not reveal them and can not be used to guess them.
+func hashedConfig(config models.AppConfig) models.AppConfig {
+	config.EnvVars = envNames(config.EnvVars)
+	config.Env.Install = envNames(config.Env.Install)
+	config.Env.Exec = envNames(config.Env.Exec)
+	return config
+}
+
+// envNames returns envVars with blank values.
+func envNames(envVars map[string]string) map[string]string {
+	if envVars == nil {
+		return nil
+	}
+	names := make(map[string]string, len(envVars))
+	for name := range envVars {
+		names[name] = ""
+	}
+	return names
+}
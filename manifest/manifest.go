@@ -0,0 +1,265 @@
+// Package manifest records the content hashes of synthesized files in a
+// signed manifest, to prove a deployed tree came from a particular synth.
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Version is the format version of the manifests written by Build.
+const Version = 1
+
+// ErrUnsigned is returned by Verify when the manifest has no signature.
+var ErrUnsigned = errors.New("manifest is not signed")
+
+// ErrNoKey is returned by Read and Verify without a public key, use
+// ReadUnsigned or VerifyUnsigned to skip the signature check.
+var ErrNoKey = errors.New("no public key to check the manifest signature")
+
+// Manifest lists the synthesized files with the metadata of the synth.
+type Manifest struct {
+	Version  int      `json:"version"`
+	Metadata Metadata `json:"metadata"`
+	Files    []File   `json:"files"`
+}
+
+// Metadata describes the synth which produced the files.
+type Metadata struct {
+	// ConfigHash is the SHA-256 of the AppConfig, see ConfigHash.
+	ConfigHash string `json:"configHash,omitempty"`
+	// Executor is the name of the executor, e.g. bun.
+	Executor string `json:"executor,omitempty"`
+	// Dependencies are the installed version of each dependency.
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	// StartedAt is when the synth started.
+	StartedAt time.Time `json:"startedAt"`
+	// CreatedAt is when the manifest was built.
+	CreatedAt time.Time `json:"createdAt"`
+	// Partial is set when the tree may hold files besides the listed ones,
+	// e.g. those a merge copy left in the destination. Verify only rejects
+	// the unlisted files of a tree which is not Partial, e.g. a sync copy.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// File is a file of the manifest.
+type File struct {
+	// Path is slash separated and relative to the root of the tree.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Mode holds the octal permission bits, e.g. 0644.
+	Mode string `json:"mode"`
+}
+
+// Signed is the file format of a manifest.
+//
+// The signature covers the exact bytes of Manifest, so it does not depend on
+// how the JSON is encoded.
+type Signed struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+// ConfigHash returns the hex SHA-256 of the JSON encoding of config.
+func ConfigHash(config any) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Build returns the manifest of the files at the slash separated paths relative to root.
+//
+// The files are sorted by path.
+func Build(fs afero.Fs, root string, paths []string, metadata Metadata) (*Manifest, error) {
+	m := &Manifest{Version: Version, Metadata: metadata, Files: make([]File, 0, len(paths))}
+	for _, p := range paths {
+		f, err := hashFile(fs, filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		f.Path = path.Clean(p)
+		m.Files = append(m.Files, f)
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m, nil
+}
+
+// Sign encodes the manifest signed with key, an unsigned manifest if key is nil.
+func Sign(m *Manifest, key ed25519.PrivateKey) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	signed := Signed{Manifest: data}
+	if key != nil {
+		signed.Signature = ed25519.Sign(key, data)
+	}
+	// indenting would reformat the signed bytes
+	return json.Marshal(signed)
+}
+
+// Write signs the manifest with key and writes it to name in fs.
+func Write(fs afero.Fs, name string, m *Manifest, key ed25519.PrivateKey) error {
+	data, err := Sign(m, key)
+	if err != nil {
+		return err
+	}
+	if err := afero.WriteFile(fs, name, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Read returns the manifest of the signed manifest data, checking its signature with key.
+func Read(data []byte, key ed25519.PublicKey) (*Manifest, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	return read(data, key)
+}
+
+// ReadUnsigned returns the manifest of the manifest data without checking its signature.
+func ReadUnsigned(data []byte) (*Manifest, error) {
+	return read(data, nil)
+}
+
+func read(data []byte, key ed25519.PublicKey) (*Manifest, error) {
+	var signed Signed
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if key != nil {
+		if len(signed.Signature) == 0 {
+			return nil, ErrUnsigned
+		}
+		if !ed25519.Verify(key, signed.Manifest, signed.Signature) {
+			return nil, errors.New("invalid manifest signature")
+		}
+	}
+	var m Manifest
+	if err := json.Unmarshal(signed.Manifest, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// Verify checks the tree at root against the manifest at name, relative to root.
+//
+// The signature is checked with key, then every file of the manifest must
+// have the same hash, size and mode and, unless Metadata.Partial is set, no
+// other file may exist besides the manifest. All mismatches are reported at once.
+func Verify(fs afero.Fs, root, name string, key ed25519.PublicKey) (*Manifest, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	return verify(fs, root, name, key)
+}
+
+// VerifyUnsigned checks the tree at root like Verify without checking the
+// signature of the manifest, it only detects accidental changes.
+func VerifyUnsigned(fs afero.Fs, root, name string) (*Manifest, error) {
+	return verify(fs, root, name, nil)
+}
+
+func verify(fs afero.Fs, root, name string, key ed25519.PublicKey) (*Manifest, error) {
+	data, err := afero.ReadFile(fs, filepath.Join(root, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	m, err := read(data, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	listed := map[string]bool{filepath.ToSlash(filepath.Clean(name)): true}
+	for _, want := range m.Files {
+		listed[want.Path] = true
+		got, err := hashFile(fs, filepath.Join(root, filepath.FromSlash(want.Path)))
+		switch {
+		case os.IsNotExist(err):
+			errs = append(errs, fmt.Errorf("%s: missing", want.Path))
+		case err != nil:
+			errs = append(errs, err)
+		case got.SHA256 != want.SHA256 || got.Size != want.Size:
+			errs = append(errs, fmt.Errorf("%s: content changed", want.Path))
+		case got.Mode != want.Mode:
+			errs = append(errs, fmt.Errorf("%s: mode changed from %s to %s", want.Path, want.Mode, got.Mode))
+		}
+	}
+	if !m.Metadata.Partial {
+		errs = append(errs, unlisted(fs, root, listed)...)
+	}
+	if len(errs) > 0 {
+		return m, fmt.Errorf("tree does not match the manifest: %w", errors.Join(errs...))
+	}
+	return m, nil
+}
+
+// unlisted reports the files of root not in listed.
+func unlisted(fs afero.Fs, root string, listed map[string]bool) []error {
+	var errs []error
+	err := afero.Walk(fs, root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); !listed[rel] {
+			errs = append(errs, fmt.Errorf("%s: not in the manifest", rel))
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to walk %s: %w", root, err))
+	}
+	return errs
+}
+
+// hashFile returns the hash, size and mode of the file, without its path.
+func hashFile(fs afero.Fs, name string) (File, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	if info.IsDir() {
+		return File{}, fmt.Errorf("%s is a directory", name)
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to hash %s: %w", name, err)
+	}
+	return File{
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Size:   size,
+		Mode:   "0" + strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	metadata := Metadata{
+		ConfigHash:   "abc",
+		Executor:     "bun",
+		Dependencies: map[string]string{"cdktf": "0.20.8"},
+		StartedAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		CreatedAt:    time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC),
+	}
+	newTree := func(t *testing.T, sign ed25519.PrivateKey, partial bool) afero.Fs {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "out/stacks/b/cdk.tf.json", []byte("b"), 0644))
+		require.NoError(t, afero.WriteFile(fs, "out/stacks/a/cdk.tf.json", []byte("a"), 0644))
+		metadata := metadata
+		metadata.Partial = partial
+		m, err := Build(fs, "out", []string{"stacks/b/cdk.tf.json", "stacks/a/cdk.tf.json"}, metadata)
+		require.NoError(t, err)
+		require.NoError(t, Write(fs, "out/manifest.json", m, sign))
+		return fs
+	}
+
+	testCases := []struct {
+		name     string
+		sign     ed25519.PrivateKey
+		verify   ed25519.PublicKey
+		unsigned bool
+		partial  bool
+		change   func(t *testing.T, fs afero.Fs)
+		wantErr  []string
+	}{
+		{name: "valid", sign: key, verify: pub},
+		{name: "no key", sign: key, verify: nil, wantErr: []string{"no public key"}},
+		{name: "unsigned without key", unsigned: true},
+		{name: "signed without key", sign: key, unsigned: true},
+		{name: "unsigned", verify: pub, wantErr: []string{"manifest is not signed"}},
+		{name: "other key", sign: key, verify: otherPub, wantErr: []string{"invalid manifest signature"}},
+		{
+			name: "changed tree", sign: key, verify: pub,
+			change: func(t *testing.T, fs afero.Fs) {
+				require.NoError(t, afero.WriteFile(fs, "out/stacks/a/cdk.tf.json", []byte("changed"), 0644))
+				require.NoError(t, fs.Chmod("out/stacks/b/cdk.tf.json", 0755))
+				require.NoError(t, afero.WriteFile(fs, "out/extra.json", []byte("x"), 0644))
+			},
+			wantErr: []string{
+				"stacks/a/cdk.tf.json: content changed",
+				"stacks/b/cdk.tf.json: mode changed from 0644 to 0755",
+				"extra.json: not in the manifest",
+			},
+		},
+		{
+			name: "partial tree", sign: key, verify: pub, partial: true,
+			change: func(t *testing.T, fs afero.Fs) {
+				require.NoError(t, afero.WriteFile(fs, "out/extra.json", []byte("x"), 0644))
+			},
+		},
+		{
+			name: "changed partial tree", sign: key, verify: pub, partial: true,
+			change: func(t *testing.T, fs afero.Fs) {
+				require.NoError(t, afero.WriteFile(fs, "out/stacks/a/cdk.tf.json", []byte("changed"), 0644))
+			},
+			wantErr: []string{"stacks/a/cdk.tf.json: content changed"},
+		},
+		{
+			name: "missing file", sign: key, verify: pub,
+			change: func(t *testing.T, fs afero.Fs) {
+				require.NoError(t, fs.Remove("out/stacks/a/cdk.tf.json"))
+			},
+			wantErr: []string{"stacks/a/cdk.tf.json: missing"},
+		},
+		{
+			name: "tampered manifest", sign: key, verify: pub,
+			change: func(t *testing.T, fs afero.Fs) {
+				data, err := afero.ReadFile(fs, "out/manifest.json")
+				require.NoError(t, err)
+				data = []byte(string(data[:len(data)/2]) + "X" + string(data[len(data)/2+1:]))
+				require.NoError(t, afero.WriteFile(fs, "out/manifest.json", data, 0644))
+			},
+			wantErr: []string{"manifest"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := newTree(t, tc.sign, tc.partial)
+			if tc.change != nil {
+				tc.change(t, fs)
+			}
+			verify := func() (*Manifest, error) { return Verify(fs, "out", "manifest.json", tc.verify) }
+			if tc.unsigned {
+				verify = func() (*Manifest, error) { return VerifyUnsigned(fs, "out", "manifest.json") }
+			}
+			m, err := verify()
+			if len(tc.wantErr) > 0 {
+				require.Error(t, err)
+				for _, want := range tc.wantErr {
+					require.ErrorContains(t, err, want)
+				}
+				return
+			}
+			require.NoError(t, err)
+			want := metadata
+			want.Partial = tc.partial
+			require.Equal(t, want, m.Metadata)
+			require.Equal(t, []File{
+				{Path: "stacks/a/cdk.tf.json", SHA256: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", Size: 1, Mode: "0644"},
+				{Path: "stacks/b/cdk.tf.json", SHA256: "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d", Size: 1, Mode: "0644"},
+			}, m.Files)
+		})
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	a, err := ConfigHash(map[string]string{"cdktf": "0.20.8"})
+	require.NoError(t, err)
+	b, err := ConfigHash(map[string]string{"cdktf": "0.20.9"})
+	require.NoError(t, err)
+	require.Len(t, a, 64)
+	require.NotEqual(t, a, b)
+}
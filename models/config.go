@@ -1,24 +1,130 @@
 package models
 
+import (
+	"maps"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
 type AppConfig struct {
-	DevDependencies map[string]string      // DevDependencies
-	Dependencies    map[string]string      // Dependencies
-	Scopes          []ScopedPackageOptions // Options for package scopes
-	ExecutorOptions map[string]string      // Options for the executor
-	PreSetupFn      func(e Executor) error // Function to run before setup
-	EnvVars         map[string]string      // Environment variables to set
+	DevDependencies map[string]string      `json:"devDependencies,omitempty"` // DevDependencies
+	Dependencies    map[string]string      `json:"dependencies,omitempty"`    // Dependencies
+	Scopes          []ScopedPackageOptions `json:"scopes,omitempty"`          // Options for package scopes
+	ExecutorOptions map[string]string      `json:"executorOptions,omitempty"` // Options for the executor
+	PreSetupFn      func(e Executor) error `json:"-"`                         // Function to run before setup
+	EnvVars         map[string]string      `json:"envVars,omitempty"`         // Environment variables to set
+	SecretEnvVars   []string               `json:"secretEnvVars,omitempty"`   // Names of environment variables redacted from logs and errors
+	Env             EnvPolicy              `json:"env,omitempty"`             // Environment policy for the install and exec phases
+	CopyOptions     CopyOptions            `json:"copy,omitempty"`            // Options to copy the result out in Eval
+}
+
+// RedactSecrets returns c with the values of its SecretEnvVars blanked in
+// EnvVars, Env.Install and Env.Exec, and whether any value was blanked.
+func (c AppConfig) RedactSecrets() (AppConfig, bool) {
+	redacted := false
+	redact := func(envVars map[string]string) map[string]string {
+		var out map[string]string
+		for _, name := range c.SecretEnvVars {
+			if v, ok := envVars[name]; ok && v != "" {
+				if out == nil {
+					out = maps.Clone(envVars)
+				}
+				out[name] = ""
+				redacted = true
+			}
+		}
+		if out == nil {
+			return envVars
+		}
+		return out
+	}
+	c.EnvVars = redact(c.EnvVars)
+	c.Env.Install = redact(c.Env.Install)
+	c.Env.Exec = redact(c.Env.Exec)
+	return c, redacted
+}
+
+// EnvMode selects the base environment passed to the executor subprocesses.
+type EnvMode string
+
+const (
+	// EnvInherit passes the whole host environment, overridden by AppConfig.EnvVars.
+	EnvInherit EnvMode = "inherit"
+	// EnvAllowlist passes the host variables listed in EnvPolicy.Allow, overridden by AppConfig.EnvVars.
+	EnvAllowlist EnvMode = "allowlist"
+	// EnvExplicit passes AppConfig.EnvVars only.
+	EnvExplicit EnvMode = "explicit"
+)
+
+// DefaultEnvAllowlist is used by EnvAllowlist when EnvPolicy.Allow is empty.
+var DefaultEnvAllowlist = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"TMPDIR",
+	"LANG",
+	"LC_*",
+	"TZ",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"SSL_CERT_FILE",
+	"NODE_EXTRA_CA_CERTS",
+}
+
+// EnvPolicy controls the environment of the install (Setup) and Exec phases.
+//
+// Registry tokens are only passed to the install phase.
+type EnvPolicy struct {
+	// Mode defaults to EnvExplicit when AppConfig.EnvVars is set and to EnvInherit otherwise.
+	Mode EnvMode `json:"mode,omitempty"`
+
+	// Allow lists host variable names passed in EnvAllowlist mode, a trailing `*` matches a prefix.
+	Allow []string `json:"allow,omitempty"`
+
+	// Install variables are only passed to the install phase.
+	Install map[string]string `json:"install,omitempty"`
+
+	// Exec variables are only passed to the Exec phase.
+	Exec map[string]string `json:"exec,omitempty"`
 }
 
 type ScopedPackageOptions struct {
 	// Scape of package
-	Scope string
+	Scope string `json:"scope"`
 
 	// URL of the registry for the scoped packages
-	RegistryURL string
+	RegistryURL string `json:"registryURL"`
 
 	// Whether the registry requires authentication
-	RequiresAuth bool
+	RequiresAuth bool `json:"requiresAuth,omitempty"`
 
 	// Env var to pass Auth token to bun install
-	AuthTokenEnvVar *string //TODO validate auth token env var is unique
+	AuthTokenEnvVar *string `json:"authTokenEnvVar,omitempty"`
+
+	// Options for AWS CodeArtifact registries, nil uses the default AWS config
+	CodeArtifact *CodeArtifactOptions `json:"codeArtifact,omitempty"`
+}
+
+// CodeArtifactOptions configures how the CodeArtifact authorization token is obtained.
+type CodeArtifactOptions struct {
+	// AWSConfig is used instead of loading the default config.
+	//
+	// Profile is ignored when AWSConfig is set.
+	AWSConfig *aws.Config `json:"-"`
+
+	// Profile is the shared config profile to load credentials from.
+	Profile string `json:"profile,omitempty"`
+
+	// RoleARN is assumed before requesting the token, e.g. to access a domain in another account.
+	RoleARN string `json:"roleARN,omitempty"`
+
+	// ExternalID is passed when assuming RoleARN.
+	ExternalID string `json:"externalID,omitempty"`
+
+	// DurationSeconds is the validity of the token, 0 uses the CodeArtifact default.
+	DurationSeconds int64 `json:"durationSeconds,omitempty"`
+
+	// Endpoint overrides the CodeArtifact service endpoint, e.g. for a local stand-in.
+	Endpoint string `json:"endpoint,omitempty"`
 }
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/spf13/afero"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultConfigFiles are the project file names looked up by FindConfigFile, in order.
+var DefaultConfigFiles = []string{"synth.yaml", "synth.yml", "synth.json"}
+
+// ErrNoConfigFile is returned by FindConfigFile when dir has none of DefaultConfigFiles.
+var ErrNoConfigFile = errors.New("no config file found")
+
+// ConfigFileExecutors are the executor names accepted in a ConfigFile.
+var ConfigFileExecutors = []string{"bun", "node"}
+
+//go:embed synth.schema.json
+var configFileSchema []byte
+
+// interpolationRegex matches `${VAR}` and `${VAR:-default}`.
+var interpolationRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ConfigFile is the project file format (synth.yaml or synth.json).
+//
+// String values may reference environment variables as `${VAR}` or `${VAR:-default}`.
+type ConfigFile struct {
+	// Executor to synth with, one of ConfigFileExecutors. Defaults to "bun".
+	Executor string `json:"executor,omitempty"`
+
+	AppConfig
+}
+
+// ConfigFileSchema returns the JSON Schema of the ConfigFile format for editor completion.
+func ConfigFileSchema() []byte {
+	return bytes.Clone(configFileSchema)
+}
+
+// FindConfigFile returns the first of DefaultConfigFiles found in dir.
+func FindConfigFile(fs afero.Fs, dir string) (string, error) {
+	for _, name := range DefaultConfigFiles {
+		path := filepath.Join(dir, name)
+		if ok, err := afero.Exists(fs, path); err != nil {
+			return "", err
+		} else if ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w in %s, expected one of %v", ErrNoConfigFile, dir, DefaultConfigFiles)
+}
+
+// LoadConfigFile reads and validates the YAML or JSON project file at path.
+//
+// Environment variables are interpolated from the process environment.
+func LoadConfigFile(fs afero.Fs, path string) (*ConfigFile, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfigFile(data, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfigFile decodes and validates a YAML or JSON project file.
+//
+// Unknown fields are rejected and all problems are reported at once.
+func ParseConfigFile(data []byte, lookupEnv func(string) (string, bool)) (*ConfigFile, error) {
+	// JSON is valid YAML, so both formats are decoded the same way
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var raw any
+	if err := json.Unmarshal(jsonData, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		raw = map[string]any{}
+	}
+	var errs []error
+	raw = interpolate(raw, lookupEnv, &errs)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if jsonData, err = json.Marshal(raw); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	var config ConfigFile
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate checks the executor name and the AppConfig.
+//
+// ExecutorOptions keys are not checked as they depend on the executor implementation.
+func (c *ConfigFile) Validate() error {
+	var errs []error
+	if c.Executor != "" && !slices.Contains(ConfigFileExecutors, c.Executor) {
+		errs = append(errs, fmt.Errorf("executor: unknown executor %q, expected one of %v", c.Executor, ConfigFileExecutors))
+	}
+	if err := c.AppConfig.Validate(nil); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// interpolate replaces environment variable references in all string values of v.
+func interpolate(v any, lookupEnv func(string) (string, bool), errs *[]error) any {
+	switch value := v.(type) {
+	case string:
+		return interpolationRegex.ReplaceAllStringFunc(value, func(ref string) string {
+			match := interpolationRegex.FindStringSubmatch(ref)
+			if env, ok := lookupEnv(match[1]); ok {
+				return env
+			}
+			if match[2] != "" {
+				return match[3]
+			}
+			*errs = append(*errs, fmt.Errorf("environment variable %s is not set", match[1]))
+			return ref
+		})
+	case []any:
+		for i := range value {
+			value[i] = interpolate(value[i], lookupEnv, errs)
+		}
+	case map[string]any:
+		for k := range value {
+			value[k] = interpolate(value[k], lookupEnv, errs)
+		}
+	}
+	return v
+}
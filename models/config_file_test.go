@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigFile = `
+executor: node
+dependencies:
+  cdktf: ^0.20.7
+  "@envtio/base": ${BASE_VERSION:-0.0.0}
+devDependencies:
+  typescript: 5.4.5
+scopes:
+  - scope: "@envtio"
+    registryURL: https://envtio-prod-481471033259.d.codeartifact.us-east-1.amazonaws.com/npm/npm-releases/
+    requiresAuth: true
+    authTokenEnvVar: ENVTIO_TOKEN
+    codeArtifact:
+      roleARN: arn:aws:iam::481471033259:role/codeartifact-read
+      externalID: ${EXTERNAL_ID}
+      durationSeconds: 900
+executorOptions:
+  entrypoint: pnpm
+env:
+  mode: allowlist
+  allow: [PATH, HOME]
+  install:
+    NPM_CONFIG_LOGLEVEL: warn
+copy:
+  skipDirs: [node_modules]
+`
+
+func TestParseConfigFile(t *testing.T) {
+	lookupEnv := func(key string) (string, bool) {
+		env := map[string]string{"EXTERNAL_ID": "external-id"}
+		v, ok := env[key]
+		return v, ok
+	}
+	config, err := ParseConfigFile([]byte(testConfigFile), lookupEnv)
+	require.NoError(t, err)
+
+	require.Equal(t, "node", config.Executor)
+	require.Equal(t, "0.0.0", config.Dependencies["@envtio/base"])
+	require.Equal(t, "5.4.5", config.DevDependencies["typescript"])
+	require.Len(t, config.Scopes, 1)
+	require.Equal(t, "ENVTIO_TOKEN", *config.Scopes[0].AuthTokenEnvVar)
+	require.Equal(t, "external-id", config.Scopes[0].CodeArtifact.ExternalID)
+	require.Equal(t, int64(900), config.Scopes[0].CodeArtifact.DurationSeconds)
+	require.Equal(t, EnvAllowlist, config.Env.Mode)
+	require.Equal(t, "warn", config.Env.Install["NPM_CONFIG_LOGLEVEL"])
+	require.Equal(t, []string{"node_modules"}, config.CopyOptions.SkipDirs)
+
+	// JSON is accepted as well
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	fromJson, err := ParseConfigFile(data, lookupEnv)
+	require.NoError(t, err)
+	require.Equal(t, config, fromJson)
+}
+
+func TestParseConfigFile_Errors(t *testing.T) {
+	noEnv := func(string) (string, bool) { return "", false }
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "Unknown field",
+			data:    "dependencies: {}\nscope: []\n",
+			wantErr: `unknown field "scope"`,
+		},
+		{
+			name:    "Missing env var",
+			data:    "envVars:\n  TOKEN: ${MISSING_TOKEN}\n",
+			wantErr: "environment variable MISSING_TOKEN is not set",
+		},
+		{
+			name:    "Unknown executor",
+			data:    "executor: deno\n",
+			wantErr: `unknown executor "deno"`,
+		},
+		{
+			name:    "Invalid AppConfig",
+			data:    "scopes:\n  - scope: envtio\n    registryURL: https://npm.example.com\n",
+			wantErr: `scopes[0].scope: must be a package scope`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfigFile([]byte(tt.data), noEnv)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "project/synth.json", []byte(`{"executor": "bun"}`), 0644))
+
+	path, err := FindConfigFile(fs, "project")
+	require.NoError(t, err)
+	require.Equal(t, "project/synth.json", path)
+
+	config, err := LoadConfigFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "bun", config.Executor)
+
+	_, err = FindConfigFile(fs, "other")
+	require.ErrorIs(t, err, ErrNoConfigFile)
+}
+
+// TestConfigFileSchema ensures the JSON Schema covers the fields of the Go types.
+func TestConfigFileSchema(t *testing.T) {
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(ConfigFileSchema(), &schema))
+	definitions := schema["definitions"].(map[string]any)
+
+	tests := []struct {
+		name   string
+		schema map[string]any
+		typ    reflect.Type
+	}{
+		{"root", schema, reflect.TypeOf(ConfigFile{})},
+		{"scope", definitions["scope"].(map[string]any), reflect.TypeOf(ScopedPackageOptions{})},
+		{"codeArtifact", definitions["codeArtifact"].(map[string]any), reflect.TypeOf(CodeArtifactOptions{})},
+		{"env", definitions["env"].(map[string]any), reflect.TypeOf(EnvPolicy{})},
+		{"copy", definitions["copy"].(map[string]any), reflect.TypeOf(CopyOptions{})},
+		{"normalize", definitions["normalize"].(map[string]any), reflect.TypeOf(NormalizeOptions{})},
+		{"hcl", definitions["hcl"].(map[string]any), reflect.TypeOf(HCLOptions{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var properties []string
+			for name := range tt.schema["properties"].(map[string]any) {
+				properties = append(properties, name)
+			}
+			sort.Strings(properties)
+			require.Equal(t, jsonFields(tt.typ), properties)
+		})
+	}
+}
+
+// jsonFields returns the sorted JSON field names of typ.
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
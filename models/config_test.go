@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppConfig_RedactSecrets(t *testing.T) {
+	config := AppConfig{
+		EnvVars:       map[string]string{"TOKEN": "t", "REGION": "us-east-1"},
+		SecretEnvVars: []string{"TOKEN", "NPM_TOKEN"},
+		Env:           EnvPolicy{Install: map[string]string{"NPM_TOKEN": "n"}},
+	}
+	redacted, ok := config.RedactSecrets()
+	require.True(t, ok)
+	require.Equal(t, map[string]string{"TOKEN": "", "REGION": "us-east-1"}, redacted.EnvVars)
+	require.Equal(t, map[string]string{"NPM_TOKEN": ""}, redacted.Env.Install)
+	require.Nil(t, redacted.Env.Exec)
+	// the maps of config are not modified
+	require.Equal(t, "t", config.EnvVars["TOKEN"])
+	require.Equal(t, "n", config.Env.Install["NPM_TOKEN"])
+
+	_, ok = AppConfig{EnvVars: map[string]string{"TOKEN": "t"}}.RedactSecrets()
+	require.False(t, ok)
+}
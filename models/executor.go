@@ -2,13 +2,48 @@ package models
 
 import (
 	"context"
+	"io"
 
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
 )
 
 // NewExecutorFn returns an Executor
-type NewExecutorFn func(logger *zap.Logger) (Executor, error)
+type NewExecutorFn func(logger *zap.Logger, opts ...ExecutorOption) (Executor, error)
+
+// ExecutorSettings are the settings provided to a NewExecutorFn by the App.
+type ExecutorSettings struct {
+	// TempDir is the directory the working directory is created in, defaults to os.TempDir().
+	TempDir string
+	// Output receives each line written by the executor subprocesses, in addition to the logger.
+	Output io.Writer
+}
+
+// ExecutorOption configures ExecutorSettings.
+type ExecutorOption func(*ExecutorSettings)
+
+// WithTempDir sets ExecutorSettings.TempDir.
+func WithTempDir(dir string) ExecutorOption {
+	return func(s *ExecutorSettings) {
+		s.TempDir = dir
+	}
+}
+
+// WithOutput sets ExecutorSettings.Output.
+func WithOutput(w io.Writer) ExecutorOption {
+	return func(s *ExecutorSettings) {
+		s.Output = w
+	}
+}
+
+// NewExecutorSettings returns the ExecutorSettings with opts applied.
+func NewExecutorSettings(opts ...ExecutorOption) ExecutorSettings {
+	var settings ExecutorSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	return settings
+}
 
 // Executor defines the interface for executing the synthesis process.
 type Executor interface {
@@ -19,26 +54,168 @@ type Executor interface {
 	Exec(ctx context.Context, mainTS string, envVars map[string]string) error
 
 	// CopyTo retrieves the result from the source path and copies it to the destination within the provided filesystem.
-	CopyTo(ctx context.Context, srcDir string, dstFS afero.Fs, dstDir string, options CopyOptions) error
+	CopyTo(ctx context.Context, srcDir string, dstFS afero.Fs, dstDir string, options CopyOptions) (CopyResult, error)
 
 	// CopyFrom copies the source path to the executor workingDir from the provided filesystem.
-	CopyFrom(ctx context.Context, srcFS afero.Fs, srcDir, dstDir string, options CopyOptions) error
+	CopyFrom(ctx context.Context, srcFS afero.Fs, srcDir, dstDir string, options CopyOptions) (CopyResult, error)
+
+	// ArchiveTo streams the files CopyTo would copy from the source path to w as a format archive.
+	//
+	// The entries are ordered by path with normalized modes and timestamps, so
+	// the same files give a byte-identical archive. Options.Mode is ignored and
+	// symlinks are always followed.
+	ArchiveTo(ctx context.Context, srcDir string, w io.Writer, format ArchiveFormat, options CopyOptions) (CopyResult, error)
 
 	// Cleanup cleans up the environment.
 	Cleanup(ctx context.Context) error
 }
 
+// RunsDir holds the ExecIn directories of a session, runs/<N> for its Nth script.
+//
+// The normalized JSON files of a run replace runs/<N> along with the working
+// directory, so they do not depend on the run.
+const RunsDir = "runs"
+
+// WorkspaceExecutor is implemented by Executors able to run several scripts after a single Setup.
+type WorkspaceExecutor interface {
+	Executor
+
+	// ExecIn runs mainTS in dir, relative to the working directory, so its output stays isolated.
+	//
+	// The dependencies installed by Setup are resolved from the working directory.
+	ExecIn(ctx context.Context, dir, mainTS string, envVars map[string]string) error
+
+	// RemoveDir removes dir, relative to the working directory, once its output has been copied.
+	RemoveDir(ctx context.Context, dir string) error
+}
+
+// DependencyReporter is implemented by Executors able to report what Setup installed.
+type DependencyReporter interface {
+	// Name returns the name of the executor, e.g. bun.
+	Name() string
+	// InstalledDependencies returns the installed version of each dependency and dev dependency.
+	InstalledDependencies(ctx context.Context) (map[string]string, error)
+}
+
+// OptionKeysReporter is implemented by Executors accepting a fixed set of
+// AppConfig.ExecutorOptions keys.
+type OptionKeysReporter interface {
+	// OptionKeys returns the accepted keys, sorted.
+	OptionKeys() []string
+}
+
+// CopyMode selects how CopyTo and CopyFrom treat the destination directory.
+type CopyMode string
+
+const (
+	// CopyMerge adds and overwrites files, the other destination files are left as is.
+	CopyMerge CopyMode = "merge"
+	// CopySync mirrors the source: unchanged files are skipped by checksum and the
+	// destination files missing from the source are deleted, unless they are ignored.
+	CopySync CopyMode = "sync"
+)
+
+// SymlinkMode selects how CopyTo and CopyFrom handle symbolic links.
+type SymlinkMode string
+
+const (
+	// SymlinksFollow copies the files and directories the symlinks point to.
+	SymlinksFollow SymlinkMode = "follow"
+	// SymlinksCopy recreates the symlinks when the destination Fs implements
+	// afero.Linker, and follows them otherwise.
+	SymlinksCopy SymlinkMode = "copy"
+)
+
+// ArchiveFormat selects the archive written by ArchiveTo.
+type ArchiveFormat string
+
+const (
+	// ArchiveTarGz is a gzipped tarball.
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	// ArchiveZip is a zip archive.
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+// CopyResult lists the slash separated paths, relative to the destination directory, handled by a copy.
+type CopyResult struct {
+	Added     []string `json:"added,omitempty"`
+	Updated   []string `json:"updated,omitempty"`
+	Deleted   []string `json:"deleted,omitempty"`
+	Unchanged []string `json:"unchanged,omitempty"`
+}
+
+// CopyOptions select the files copied by CopyTo and CopyFrom.
+//
+// The patterns follow gitignore: `**` matches any number of directories,
+// a leading `!` negates a pattern, a trailing `/` only matches directories
+// and a pattern without a slash matches at any depth, see the ignore package.
+//
+// Migration: the patterns used to match the whole path from the source root,
+// a pattern without a slash such as `test.txt` now also matches
+// subdir/test.txt. Prefix it with `/`, e.g. `/test.txt`, to only match at the
+// root, see CHANGELOG.md.
 type CopyOptions struct {
-	// SkipDirs is a list of directories to skip.
+	// Mode defaults to CopyMerge.
+	Mode CopyMode `json:"mode,omitempty"`
+	// SkipDirs is a list of directory patterns to skip.
 	//
 	// If a directory is skipped, all its contents will be skipped as well including AllowPatterns.
-	SkipDirs []string
+	SkipDirs []string `json:"skipDirs,omitempty"`
 	// AllowPatterns is a list of patterns to allow, SkipDirs will still be respected.
-	AllowPatterns []string
+	AllowPatterns []string `json:"allowPatterns,omitempty"`
 	// IgnorePatterns is a list of patterns to ignore. Unless they were allowed by AllowPatterns.
+	IgnorePatterns []string `json:"ignorePatterns,omitempty"`
+	// PreserveMode keeps the permission bits of the files and directories.
 	//
-	// Note that golang does not support `**` for recursive matching.
+	// By default files are created with 0666 and directories with 0775, before umask.
+	PreserveMode bool `json:"preserveMode,omitempty"`
+	// PreserveTimes keeps the modification times of the files and directories.
+	PreserveTimes bool `json:"preserveTimes,omitempty"`
+	// Symlinks defaults to SymlinksFollow. In both modes, symlinks pointing
+	// outside of the source directory are rejected.
+	Symlinks SymlinkMode `json:"symlinks,omitempty"`
+	// IgnoreFile is the name of the ignore files in the source tree, e.g. ".synthignore".
 	//
-	// See: https://github.com/golang/go/issues/11862
-	IgnorePatterns []string
+	// Their patterns are added to IgnorePatterns, relative to their directory.
+	IgnoreFile string `json:"ignoreFile,omitempty"`
+	// Manifest is the name of the manifest written by the App to the
+	// destination directory once the files are copied, see the manifest package.
+	//
+	// A source file of the same name is not copied.
+	Manifest string `json:"manifest,omitempty"`
+	// Normalize canonicalizes the copied JSON files if set.
+	Normalize *NormalizeOptions `json:"normalize,omitempty"`
+	// HCL converts the copied Terraform JSON files, e.g. cdk.tf.json, to HCL if set.
+	HCL *HCLOptions `json:"hcl,omitempty"`
+}
+
+// HCLOptions convert the *.tf.json files of a copy to *.tf HCL files, see
+// tfjson.ToHCL. The conversion runs after Normalize.
+type HCLOptions struct {
+	// Blocks are the nested block types of the providers, e.g. ingress, written
+	// as blocks instead of attributes when SchemaFile does not cover them.
+	Blocks []string `json:"blocks,omitempty"`
+	// Attributes are the object attributes of the providers, e.g. tags,
+	// written as attributes when SchemaFile does not cover them.
+	//
+	// Without the schema, an object which is neither in Blocks nor in
+	// Attributes fails the conversion rather than give invalid HCL.
+	Attributes []string `json:"attributes,omitempty"`
+	// SchemaFile is the output of `terraform providers schema -json`, used to
+	// tell the nested blocks from the attributes.
+	SchemaFile string `json:"schemaFile,omitempty"`
+}
+
+// NormalizeOptions canonicalize the JSON files of a copy, see the tfjson package.
+//
+// The keys are sorted, the files indented with two spaces and the absolute
+// path of the source directory, the executor working directory for CopyTo,
+// replaced with "<workdir>".
+type NormalizeOptions struct {
+	// Patterns select the files to normalize, defaults to *.json.
+	Patterns []string `json:"patterns,omitempty"`
+	// StripMetadata are the keys removed from the `//` metadata blocks, e.g. stackTrace.
+	StripMetadata []string `json:"stripMetadata,omitempty"`
+	// Replace maps environment specific strings of the values to their replacement.
+	Replace map[string]string `json:"replace,omitempty"`
 }
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+var (
+	// ref: https://github.com/npm/validate-npm-package-name
+	packageNameRegex = regexp.MustCompile(`^(@[a-z0-9-~][a-z0-9-._~]*/)?[a-z0-9-~][a-z0-9-._~]*$`)
+	scopeRegex       = regexp.MustCompile(`^@[a-z0-9-~][a-z0-9-._~]*$`)
+	envVarRegex      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	githubRepoRegex  = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+(#.+)?$`)
+
+	// distTagRegex matches the common dist-tags, optionally suffixed, e.g. next or beta-5.
+	// Any other name is likely a mistyped version.
+	distTagRegex = regexp.MustCompile(`^(latest|next|beta|alpha|canary|rc|nightly|experimental|insiders|dev|stable|lts)([.-][A-Za-z0-9.-]+)?$`)
+)
+
+// versionPrefixes are dependency specifiers which are not semver ranges.
+var versionPrefixes = []string{
+	"file:", "link:", "workspace:", "npm:", "portal:",
+	"git:", "git+", "github:", "gitlab:", "bitbucket:",
+	"http://", "https://",
+	"./", "../", "/", "~/",
+}
+
+// Validate reports all problems found in the AppConfig at once.
+//
+// ExecutorOptions keys are checked against executorOptionKeys unless it is nil.
+func (c AppConfig) Validate(executorOptionKeys []string) error {
+	var errs []error
+	errs = append(errs, validateDependencies("dependencies", c.Dependencies)...)
+	errs = append(errs, validateDependencies("devDependencies", c.DevDependencies)...)
+	errs = append(errs, validateScopes(c.Scopes)...)
+
+	if executorOptionKeys != nil {
+		for _, key := range sortedKeys(c.ExecutorOptions) {
+			if !slices.Contains(executorOptionKeys, key) {
+				errs = append(errs, fmt.Errorf("executorOptions: unknown key %q, expected one of %v", key, executorOptionKeys))
+			}
+		}
+	}
+
+	switch c.Env.Mode {
+	case "", EnvInherit, EnvAllowlist, EnvExplicit:
+	default:
+		errs = append(errs, fmt.Errorf("env.mode: unknown mode %q", c.Env.Mode))
+	}
+	switch c.CopyOptions.Mode {
+	case "", CopyMerge, CopySync:
+	default:
+		errs = append(errs, fmt.Errorf("copy.mode: unknown mode %q", c.CopyOptions.Mode))
+	}
+	switch c.CopyOptions.Symlinks {
+	case "", SymlinksFollow, SymlinksCopy:
+	default:
+		errs = append(errs, fmt.Errorf("copy.symlinks: unknown mode %q", c.CopyOptions.Symlinks))
+	}
+	if name := c.CopyOptions.Manifest; name != "" && (strings.ContainsAny(name, `/\`) || name == "." || name == "..") {
+		errs = append(errs, fmt.Errorf("copy.manifest: must be a file name, got %q", name))
+	}
+	for _, name := range c.SecretEnvVars {
+		if !envVarRegex.MatchString(name) {
+			errs = append(errs, fmt.Errorf("secretEnvVars: invalid env var name %q", name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid AppConfig: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validateDependencies(field string, deps map[string]string) []error {
+	var errs []error
+	for _, name := range sortedKeys(deps) {
+		if !packageNameRegex.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%s: invalid package name %q", field, name))
+		}
+		if err := validateVersion(deps[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%q]: %w", field, name, err))
+		}
+	}
+	return errs
+}
+
+// validateVersion accepts semver ranges, dist-tags and the non-registry specifiers of npm.
+func validateVersion(version string) error {
+	if version == "" {
+		return errors.New("version is required")
+	}
+	for _, prefix := range versionPrefixes {
+		if strings.HasPrefix(version, prefix) {
+			return nil
+		}
+	}
+	if githubRepoRegex.MatchString(version) {
+		return nil
+	}
+	if _, err := semver.NewConstraint(version); err != nil {
+		if distTagRegex.MatchString(version) {
+			return nil
+		}
+		return fmt.Errorf("invalid version range %q: %w", version, err)
+	}
+	return nil
+}
+
+func validateScopes(scopes []ScopedPackageOptions) []error {
+	var errs []error
+	seenScopes := map[string]int{}
+	seenEnvVars := map[string]int{}
+	for i, scope := range scopes {
+		field := fmt.Sprintf("scopes[%d]", i)
+		if !scopeRegex.MatchString(scope.Scope) {
+			errs = append(errs, fmt.Errorf("%s.scope: must be a package scope starting with \"@\", got %q", field, scope.Scope))
+		} else if j, ok := seenScopes[scope.Scope]; ok {
+			errs = append(errs, fmt.Errorf("%s.scope: %q is already configured by scopes[%d]", field, scope.Scope, j))
+		} else {
+			seenScopes[scope.Scope] = i
+		}
+
+		if u, err := url.Parse(scope.RegistryURL); err != nil {
+			errs = append(errs, fmt.Errorf("%s.registryURL: %w", field, err))
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s.registryURL: must be an absolute http(s) URL, got %q", field, scope.RegistryURL))
+		}
+
+		if scope.AuthTokenEnvVar == nil {
+			if scope.RequiresAuth {
+				errs = append(errs, fmt.Errorf("%s.authTokenEnvVar: is required when requiresAuth is set", field))
+			}
+			continue
+		}
+		envVar := *scope.AuthTokenEnvVar
+		if !envVarRegex.MatchString(envVar) {
+			errs = append(errs, fmt.Errorf("%s.authTokenEnvVar: invalid env var name %q", field, envVar))
+		} else if j, ok := seenEnvVars[envVar]; ok {
+			errs = append(errs, fmt.Errorf("%s.authTokenEnvVar: %q is already used by scopes[%d]", field, envVar, j))
+		} else {
+			seenEnvVars[envVar] = i
+		}
+	}
+	return errs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
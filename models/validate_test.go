@@ -0,0 +1,142 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppConfig_Validate(t *testing.T) {
+	tokenA := "TOKEN_A"
+	tokenB := "TOKEN_A"
+	invalidToken := "1TOKEN"
+
+	tests := []struct {
+		name       string
+		config     AppConfig
+		optionKeys []string
+		wantErrs   []string
+	}{
+		{
+			name: "Valid config",
+			config: AppConfig{
+				Dependencies: map[string]string{
+					"cdktf":         "^0.20.7",
+					"@envtio/base":  "0.0.0",
+					"cdktf-lib":     "./fixtures/cdktf-lib",
+					"constructs":    ">=10.0.0 <11.0.0",
+					"my-tagged-pkg": "latest",
+					"my-next-pkg":   "next-14",
+				},
+				DevDependencies: map[string]string{
+					"typescript": "5.4.5",
+				},
+				Scopes: []ScopedPackageOptions{
+					{
+						Scope:           "@envtio",
+						RegistryURL:     "https://envtio-prod-481471033259.d.codeartifact.us-east-1.amazonaws.com/npm/npm-releases/",
+						RequiresAuth:    true,
+						AuthTokenEnvVar: &tokenA,
+					},
+				},
+				ExecutorOptions: map[string]string{
+					"entrypoint": "pnpm",
+				},
+			},
+			optionKeys: []string{"entrypoint"},
+		},
+		{
+			name: "Reports all problems",
+			config: AppConfig{
+				Dependencies: map[string]string{
+					"Invalid Name": "1.0.0",
+					"cdktf":        "not a version!",
+					"constructs":   "lastest",
+				},
+				Scopes: []ScopedPackageOptions{
+					{
+						Scope:           "envtio",
+						RegistryURL:     "npm.example.com",
+						RequiresAuth:    true,
+						AuthTokenEnvVar: &tokenA,
+					},
+					{
+						Scope:           "@other",
+						RegistryURL:     "https://npm.example.com",
+						AuthTokenEnvVar: &tokenB,
+					},
+					{
+						Scope:        "@other",
+						RegistryURL:  "https://npm.example.com",
+						RequiresAuth: true,
+					},
+					{
+						Scope:           "@invalid",
+						RegistryURL:     "https://npm.example.com",
+						AuthTokenEnvVar: &invalidToken,
+					},
+				},
+				ExecutorOptions: map[string]string{
+					"entrypiont": "pnpm",
+				},
+				Env: EnvPolicy{
+					Mode: "all",
+				},
+				CopyOptions: CopyOptions{
+					Mode:     "mirror",
+					Symlinks: "skip",
+					Manifest: "../manifest.json",
+				},
+			},
+			optionKeys: []string{"entrypoint"},
+			wantErrs: []string{
+				`dependencies: invalid package name "Invalid Name"`,
+				`dependencies["cdktf"]: invalid version range "not a version!"`,
+				`dependencies["constructs"]: invalid version range "lastest"`,
+				`scopes[0].scope: must be a package scope starting with "@", got "envtio"`,
+				`scopes[0].registryURL: must be an absolute http(s) URL, got "npm.example.com"`,
+				`scopes[1].authTokenEnvVar: "TOKEN_A" is already used by scopes[0]`,
+				`scopes[2].scope: "@other" is already configured by scopes[1]`,
+				`scopes[2].authTokenEnvVar: is required when requiresAuth is set`,
+				`scopes[3].authTokenEnvVar: invalid env var name "1TOKEN"`,
+				`executorOptions: unknown key "entrypiont"`,
+				`env.mode: unknown mode "all"`,
+				`copy.mode: unknown mode "mirror"`,
+				`copy.symlinks: unknown mode "skip"`,
+				`copy.manifest: must be a file name, got "../manifest.json"`,
+			},
+		},
+		{
+			name: "Executor options are not checked without keys",
+			config: AppConfig{
+				ExecutorOptions: map[string]string{
+					"anything": "goes",
+				},
+			},
+		},
+		{
+			name: "Executor options are checked against empty keys",
+			config: AppConfig{
+				ExecutorOptions: map[string]string{
+					"anything": "goes",
+				},
+			},
+			optionKeys: []string{},
+			wantErrs:   []string{`executorOptions: unknown key "anything"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate(tt.optionKeys)
+			if len(tt.wantErrs) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErrs {
+				require.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
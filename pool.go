@@ -0,0 +1,29 @@
+package synth
+
+import (
+	"context"
+
+	"github.com/environment-toolkit/go-synth/models"
+)
+
+// ExecutorPool provides the Executors used by Eval.
+//
+// Pools may limit or reuse Executors, a reused Executor must not carry over
+// the files of a previous Eval.
+type ExecutorPool interface {
+	// Get returns an Executor, newFn creates a new one with the App logger and settings.
+	Get(ctx context.Context, newFn func() (models.Executor, error)) (models.Executor, error)
+	// Put releases e once Eval is done with it.
+	Put(ctx context.Context, e models.Executor) error
+}
+
+// ephemeralPool creates a new Executor for each Eval and cleans it up afterwards.
+type ephemeralPool struct{}
+
+func (ephemeralPool) Get(ctx context.Context, newFn func() (models.Executor, error)) (models.Executor, error) {
+	return newFn()
+}
+
+func (ephemeralPool) Put(ctx context.Context, e models.Executor) error {
+	return e.Cleanup(ctx)
+}
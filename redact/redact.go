@@ -0,0 +1,170 @@
+// Package redact masks secret values in log lines, output and errors.
+package redact
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Mask replaces every secret value.
+const Mask = "[REDACTED]"
+
+// minSecretLength is the shortest value treated as a secret.
+//
+// Shorter values (e.g. "1" or "true") would mask unrelated output.
+const minSecretLength = 4
+
+// Redactor masks known secret values.
+//
+// The zero value and a nil Redactor do not mask anything.
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// New returns a Redactor masking the provided secret values.
+func New(secrets ...string) *Redactor {
+	unique := make(map[string]struct{}, len(secrets))
+	for _, s := range secrets {
+		if len(s) < minSecretLength {
+			continue
+		}
+		unique[s] = struct{}{}
+	}
+	if len(unique) == 0 {
+		return &Redactor{}
+	}
+	sorted := make([]string, 0, len(unique))
+	for s := range unique {
+		sorted = append(sorted, s)
+	}
+	// replace longest secrets first so secrets containing other secrets are fully masked
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	oldnew := make([]string, 0, len(sorted)*2)
+	for _, s := range sorted {
+		oldnew = append(oldnew, s, Mask)
+	}
+	return &Redactor{
+		replacer: strings.NewReplacer(oldnew...),
+	}
+}
+
+// String returns s with all secret values masked.
+func (r *Redactor) String(s string) string {
+	if r == nil || r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Error wraps err so its message has all secret values masked.
+//
+// The wrapped error is still available through errors.Is and errors.As.
+func (r *Redactor) Error(err error) error {
+	if err == nil || r == nil || r.replacer == nil {
+		return err
+	}
+	return &redactedError{err: err, r: r}
+}
+
+// Logger returns a logger masking secret values in messages and fields.
+func (r *Redactor) Logger(logger *zap.Logger) *zap.Logger {
+	if r == nil || r.replacer == nil {
+		return logger
+	}
+	return logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &redactCore{Core: c, r: r}
+	}))
+}
+
+// Writer returns a writer masking secret values in each Write call before writing to w.
+//
+// Secrets split across Write calls are not masked, write whole lines.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil || r.replacer == nil {
+		return w
+	}
+	return &redactWriter{w: w, r: r}
+}
+
+type redactWriter struct {
+	w io.Writer
+	r *Redactor
+}
+
+// Write masks p and reports len(p) as written when the masked content was written.
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type redactedError struct {
+	err error
+	r   *Redactor
+}
+
+func (e *redactedError) Error() string {
+	return e.r.String(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactCore masks secret values before passing entries to the wrapped Core.
+type redactCore struct {
+	zapcore.Core
+	r *Redactor
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.fields(fields)), r: c.r}
+}
+
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.String(ent.Message)
+	return c.Core.Write(ent, c.fields(fields))
+}
+
+// fields returns a copy of fields with string values masked.
+func (c *redactCore) fields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = c.r.String(f.String)
+		case zapcore.ByteStringType:
+			if b, ok := f.Interface.([]byte); ok {
+				f.Interface = []byte(c.r.String(string(b)))
+			}
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok {
+				f.Interface = c.r.Error(err)
+			}
+		case zapcore.StringerType:
+			if s, ok := f.Interface.(fmt.Stringer); ok {
+				f = zap.String(f.Key, c.r.String(s.String()))
+			}
+		}
+		redacted[i] = f
+	}
+	return redacted
+}
@@ -0,0 +1,55 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRedactor_String(t *testing.T) {
+	r := New("secret-token", "secret-token-long", "1", "")
+	require.Equal(t, "token=[REDACTED] other=[REDACTED] 1", r.String("token=secret-token other=secret-token-long 1"))
+
+	var empty *Redactor
+	require.Equal(t, "secret-token", empty.String("secret-token"))
+}
+
+func TestRedactor_Error(t *testing.T) {
+	r := New("secret-token")
+	base := errors.New("failed with secret-token")
+	err := r.Error(fmt.Errorf("install: %w", base))
+	require.EqualError(t, err, "install: failed with [REDACTED]")
+	require.ErrorIs(t, err, base)
+	require.NoError(t, r.Error(nil))
+}
+
+func TestRedactor_Logger(t *testing.T) {
+	r := New("secret-token")
+	core, logs := observer.New(zap.DebugLevel)
+	logger := r.Logger(zap.New(core)).With(zap.String("token", "secret-token"))
+
+	logger.Info("using secret-token", zap.Error(errors.New("bad secret-token")))
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "using [REDACTED]", entries[0].Message)
+	fields := entries[0].ContextMap()
+	require.Equal(t, "[REDACTED]", fields["token"])
+	require.Equal(t, "bad [REDACTED]", fields["error"])
+}
+
+func TestRedactor_Writer(t *testing.T) {
+	r := New("secret-token")
+	var buf strings.Builder
+	w := r.Writer(&buf)
+	n, err := io.WriteString(w, "token secret-token\n")
+	require.NoError(t, err)
+	require.Equal(t, len("token secret-token\n"), n)
+	require.Equal(t, "token [REDACTED]\n", buf.String())
+}
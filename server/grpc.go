@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/environment-toolkit/go-synth/server/synthpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the gRPC service of the Server, defined by synthpb/synth.proto.
+const ServiceName = "gosynth.v1.Synth"
+
+// formats maps the protobuf formats to the Server formats.
+var formats = map[synthpb.Format]Format{
+	synthpb.Format_FORMAT_UNSPECIFIED: "",
+	synthpb.Format_FORMAT_FILES:       FormatFiles,
+	synthpb.Format_FORMAT_TAR_GZ:      FormatTarGz,
+	synthpb.Format_FORMAT_ZIP:         FormatZip,
+}
+
+// grpcService implements the protobuf service with a Server.
+type grpcService struct {
+	synthpb.UnimplementedSynthServer
+	s *Server
+}
+
+func (g *grpcService) Configure(ctx context.Context, req *synthpb.ConfigureRequest) (*synthpb.ConfigureResponse, error) {
+	if err := g.s.authenticate(ctx, bearerToken(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	var config models.AppConfig
+	if err := decodeConfig(req.ConfigJson, &config); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := g.s.checkConfig(config); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := g.s.Configure(ctx, config); err != nil {
+		return nil, grpcError(err)
+	}
+	return &synthpb.ConfigureResponse{}, nil
+}
+
+// Eval streams an Event for each log line, the Result is the last Event.
+//
+// A failed Eval is reported by the status of the stream.
+func (g *grpcService) Eval(in *synthpb.EvalRequest, stream synthpb.Synth_EvalServer) error {
+	ctx := stream.Context()
+	if err := g.s.authenticate(ctx, bearerToken(ctx)); err != nil {
+		return grpcError(err)
+	}
+	req, err := evalRequestFromProto(in)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var mu sync.Mutex
+	resp, err := g.s.Eval(ctx, req, func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the client went away if the event can not be sent
+		_ = stream.Send(&synthpb.Event{Event: &synthpb.Event_Log{Log: line}})
+	})
+	if err != nil {
+		return grpcError(err)
+	}
+	return stream.Send(&synthpb.Event{Event: &synthpb.Event_Result{Result: evalResponseToProto(resp)}})
+}
+
+// decodeConfig decodes the AppConfig JSON document of a request, rejecting unknown fields.
+func decodeConfig(data string, config *models.AppConfig) error {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return fmt.Errorf("invalid config_json: %w", err)
+	}
+	return nil
+}
+
+func evalRequestFromProto(in *synthpb.EvalRequest) (EvalRequest, error) {
+	format, ok := formats[in.Format]
+	if !ok {
+		return EvalRequest{}, fmt.Errorf("unknown format %d", in.Format)
+	}
+	req := EvalRequest{MainTs: in.MainTs, Src: in.Src, Format: format}
+	if in.ConfigJson != "" {
+		req.Config = &models.AppConfig{}
+		if err := decodeConfig(in.ConfigJson, req.Config); err != nil {
+			return EvalRequest{}, err
+		}
+	}
+	return req, nil
+}
+
+func evalRequestToProto(req EvalRequest) (*synthpb.EvalRequest, error) {
+	out := &synthpb.EvalRequest{MainTs: req.MainTs, Src: req.Src, Format: formatToProto(req.Format)}
+	if req.Config != nil {
+		data, err := json.Marshal(req.Config)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding config: %w", err)
+		}
+		out.ConfigJson = string(data)
+	}
+	return out, nil
+}
+
+func evalResponseToProto(resp *EvalResponse) *synthpb.EvalResponse {
+	out := &synthpb.EvalResponse{Format: formatToProto(resp.Format), Archive: resp.Archive}
+	if resp.Files != nil {
+		out.Files = make(map[string][]byte, len(resp.Files))
+		for name, content := range resp.Files {
+			out.Files[name] = []byte(content)
+		}
+	}
+	return out
+}
+
+func evalResponseFromProto(in *synthpb.EvalResponse) *EvalResponse {
+	resp := &EvalResponse{Format: formats[in.Format], Archive: in.Archive}
+	if in.Files != nil {
+		resp.Files = make(map[string]string, len(in.Files))
+		for name, content := range in.Files {
+			resp.Files[name] = string(content)
+		}
+	}
+	return resp
+}
+
+func formatToProto(format Format) synthpb.Format {
+	for pf, f := range formats {
+		if f == format {
+			return pf
+		}
+	}
+	return synthpb.Format_FORMAT_UNSPECIFIED
+}
+
+// bearerToken returns the token of the "authorization" metadata of ctx.
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	token, _ := strings.CutPrefix(values[0], "Bearer ")
+	return token
+}
+
+// grpcError returns err with the gRPC code of its statusError.
+func grpcError(err error) error {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return status.Error(statusErr.code, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// Client calls a Server over gRPC.
+type Client struct {
+	client synthpb.SynthClient
+}
+
+// NewClient returns a Client using cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{client: synthpb.NewSynthClient(cc)}
+}
+
+// Configure sets the config of the next Eval requests.
+func (c *Client) Configure(ctx context.Context, config models.AppConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	_, err = c.client.Configure(ctx, &synthpb.ConfigureRequest{ConfigJson: string(data)})
+	return err
+}
+
+// Eval runs req, calling onLog with each line of the executor output if set.
+func (c *Client) Eval(ctx context.Context, req EvalRequest, onLog func(line string)) (*EvalResponse, error) {
+	in, err := evalRequestToProto(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.client.Eval(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("eval stream ended without a result")
+			}
+			return nil, err
+		}
+		if result := event.GetResult(); result != nil {
+			return evalResponseFromProto(result), nil
+		}
+		if onLog != nil {
+			onLog(event.GetLog())
+		}
+	}
+}
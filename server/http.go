@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"go.uber.org/zap"
+)
+
+// ndjson is the content type of streamed Eval events.
+const ndjson = "application/x-ndjson"
+
+// Handler returns the HTTP API of the Server:
+//
+//	POST /v1/configure  AppConfig body, sets the config of the next Eval requests
+//	POST /v1/eval       EvalRequest body, returns an EvalResponse, or the Event
+//	                    stream with "Accept: application/x-ndjson"
+//	GET  /healthz       200 while the process runs
+//	GET  /readyz        200 until the Server drains
+//
+// The handlers set with WithHTTPHandler are served as well. All but the health
+// checks are authenticated with the WithAuth function.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for pattern, h := range s.handlers {
+		mux.Handle(pattern, s.withAuth(h))
+	}
+	mux.Handle("POST /v1/configure", s.withAuth(http.HandlerFunc(s.handleConfigure)))
+	mux.Handle("POST /v1/eval", s.withAuth(http.HandlerFunc(s.handleEval)))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return mux
+}
+
+// withAuth serves h once the bearer token of the request is authenticated.
+func (s *Server) withAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if err := s.authenticate(r.Context(), token); err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(w, err)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleConfigure(w http.ResponseWriter, r *http.Request) {
+	var config models.AppConfig
+	if err := s.decode(w, r, &config); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.checkConfig(config); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.Configure(r.Context(), config); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ConfigureResponse{})
+}
+
+func (s *Server) handleEval(w http.ResponseWriter, r *http.Request) {
+	var req EvalRequest
+	if err := s.decode(w, r, &req); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), ndjson) {
+		resp, err := s.Eval(r.Context(), req, nil)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	// the status is sent with the first event, failures are reported by the last event
+	stream := &eventStream{w: w, enc: json.NewEncoder(w)}
+	stream.flusher, _ = w.(http.Flusher)
+	w.Header().Set("Content-Type", ndjson)
+	resp, err := s.Eval(r.Context(), req, func(line string) {
+		stream.send(Event{Log: line})
+	})
+	if err != nil {
+		if !stream.isStarted() {
+			s.writeError(w, err)
+			return
+		}
+		stream.send(Event{Error: err.Error()})
+		return
+	}
+	stream.send(Event{Result: resp})
+}
+
+// decode decodes the JSON body of r into v, rejecting unknown fields and bodies over the size limit.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return &statusError{status: http.StatusRequestEntityTooLarge, err: err}
+		}
+		return badRequest(err)
+	}
+	return nil
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		status = statusErr.status
+	}
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	if status == http.StatusInternalServerError {
+		s.logger.Error("request failed", zap.Error(err))
+	}
+	writeJSON(w, status, Event{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// the client went away if the body can not be written
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// eventStream writes Events as NDJSON, flushing each event.
+type eventStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	started bool
+}
+
+func (e *eventStream) isStarted() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.started
+}
+
+func (e *eventStream) send(event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started {
+		e.w.WriteHeader(http.StatusOK)
+		e.started = true
+	}
+	_ = e.enc.Encode(event)
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+}
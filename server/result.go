@@ -0,0 +1,36 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/spf13/afero"
+)
+
+// newEvalResponse returns the files of root in fs in format.
+func newEvalResponse(fs afero.Fs, root string, format Format) (*EvalResponse, error) {
+	files, err := archive.ReadFiles(fs, root)
+	if err != nil {
+		return nil, fmt.Errorf("error reading result: %w", err)
+	}
+	resp := &EvalResponse{Format: format}
+	var buf bytes.Buffer
+	switch format {
+	case FormatTarGz:
+		err = archive.TarGz(&buf, files)
+		resp.Archive = buf.Bytes()
+	case FormatZip:
+		err = archive.Zip(&buf, files)
+		resp.Archive = buf.Bytes()
+	default:
+		resp.Files = make(map[string]string, len(files))
+		for name, content := range files {
+			resp.Files[name] = string(content)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error archiving result: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,489 @@
+// Package server exposes a synth App over HTTP+JSON and gRPC.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/environment-toolkit/go-synth"
+	"github.com/environment-toolkit/go-synth/auth"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/environment-toolkit/go-synth/server/synthpb"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Format selects how the synthesized files are returned.
+type Format string
+
+const (
+	// FormatFiles returns the files as a map of slash separated paths to contents.
+	FormatFiles Format = "files"
+	// FormatTarGz returns the files as a gzipped tarball.
+	FormatTarGz Format = "tar.gz"
+	// FormatZip returns the files as a zip archive.
+	FormatZip Format = "zip"
+)
+
+// EvalRequest runs a main.ts script.
+type EvalRequest struct {
+	// MainTs is the main.ts script to run.
+	MainTs string `json:"mainTs"`
+	// Src is the directory returned once the script has run, defaults to cdktf.out.
+	Src string `json:"src,omitempty"`
+	// Format of the result, defaults to FormatFiles.
+	Format Format `json:"format,omitempty"`
+	// Config is used instead of the config set by Configure.
+	Config *models.AppConfig `json:"config,omitempty"`
+}
+
+// EvalResponse holds the synthesized files.
+type EvalResponse struct {
+	Format Format `json:"format"`
+	// Files is set for FormatFiles.
+	Files map[string]string `json:"files,omitempty"`
+	// Archive is set for FormatTarGz and FormatZip.
+	Archive []byte `json:"archive,omitempty"`
+}
+
+// Event is streamed while an Eval runs, the last event holds the Result or the Error.
+type Event struct {
+	// Log is a line of the executor output.
+	Log string `json:"log,omitempty"`
+	// Result is set once Eval succeeded.
+	Result *EvalResponse `json:"result,omitempty"`
+	// Error is set once Eval failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ConfigureResponse is returned by Configure.
+type ConfigureResponse struct{}
+
+// Override is a field of a request config the Server rejects unless allowed by WithAllowedOverrides.
+type Override string
+
+const (
+	// OverrideEnv allows requests to set EnvPolicy.Allow, i.e. the host variables passed to their scripts.
+	OverrideEnv Override = "env"
+	// OverrideCodeArtifact allows requests to set the CodeArtifact options of their scopes,
+	// which select the role, profile and endpoint used with the AWS credentials of the Server.
+	OverrideCodeArtifact Override = "codeArtifact"
+	// OverrideRegistries allows requests to set scopes with requiresAuth or a
+	// registry other than DefaultRegistryURL. The registry tokens are minted with
+	// the credentials of the Server and sent to the registry by the install.
+	OverrideRegistries Override = "registries"
+)
+
+// DefaultRegistryURL is the public npm registry, the only registry of a
+// request config scope unless OverrideRegistries is allowed.
+const DefaultRegistryURL = "https://registry.npmjs.org/"
+
+// AuthFunc authenticates a request from its bearer token, empty if the request has none.
+type AuthFunc func(ctx context.Context, token string) error
+
+// Server runs the Eval requests received over HTTP and gRPC.
+type Server struct {
+	newExecutorFn   models.NewExecutorFn
+	logger          *zap.Logger
+	appOptions      []synth.Option
+	maxRequestBytes int64
+	drainTimeout    time.Duration
+	sem             chan struct{}
+	health          *health.Server
+	handlers        map[string]http.Handler
+	auth            AuthFunc
+	overrides       []Override
+
+	mu       sync.RWMutex
+	config   *models.AppConfig
+	draining atomic.Bool
+}
+
+// Option configures a Server created by New.
+type Option func(*Server)
+
+// WithAppOptions sets the options of the App created for each Eval.
+//
+// WithOutputSink is set by the Server to stream the executor output.
+func WithAppOptions(opts ...synth.Option) Option {
+	return func(s *Server) {
+		s.appOptions = append(s.appOptions, opts...)
+	}
+}
+
+// WithMaxConcurrent sets the number of Eval requests running at once, extra requests are rejected.
+//
+// Defaults to runtime.GOMAXPROCS(0).
+func WithMaxConcurrent(n int) Option {
+	return func(s *Server) {
+		s.sem = make(chan struct{}, max(n, 1))
+	}
+}
+
+// WithMaxRequestBytes sets the size limit of a request body or message.
+//
+// Defaults to 10 MiB.
+func WithMaxRequestBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxRequestBytes = n
+	}
+}
+
+// WithDrainTimeout sets how long Run waits for the running requests once its context is done.
+//
+// Defaults to 30s.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.drainTimeout = d
+	}
+}
+
+// WithHTTPHandler serves h for pattern next to the Server API, e.g. the jobs API.
+func WithHTTPHandler(pattern string, h http.Handler) Option {
+	return func(s *Server) {
+		if s.handlers == nil {
+			s.handlers = map[string]http.Handler{}
+		}
+		s.handlers[pattern] = h
+	}
+}
+
+// WithAuth authenticates the Configure and Eval requests and the WithHTTPHandler
+// handlers with fn, the health checks are not authenticated.
+//
+// Requests are not authenticated by default.
+func WithAuth(fn AuthFunc) Option {
+	return func(s *Server) {
+		s.auth = fn
+	}
+}
+
+// WithBearerToken authenticates the requests sending token, see WithAuth.
+//
+// HTTP requests send "Authorization: Bearer <token>", gRPC requests the same
+// value in the "authorization" metadata.
+func WithBearerToken(token string) Option {
+	return WithAuth(func(ctx context.Context, got string) error {
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return errUnauthenticated
+		}
+		return nil
+	})
+}
+
+// WithAllowedOverrides allows the request configs to set the fields of overrides.
+func WithAllowedOverrides(overrides ...Override) Option {
+	return func(s *Server) {
+		s.overrides = append(s.overrides, overrides...)
+	}
+}
+
+// New returns a Server creating executors with newFn.
+func New(newFn models.NewExecutorFn, logger *zap.Logger, opts ...Option) *Server {
+	s := &Server{
+		newExecutorFn: newFn,
+		logger:        logger,
+		// authenticators and their tokens are cached across the App of each request
+		appOptions:      []synth.Option{synth.WithAuthProvider(auth.NewAuthProvider())},
+		maxRequestBytes: 10 << 20,
+		drainTimeout:    30 * time.Second,
+		sem:             make(chan struct{}, runtime.GOMAXPROCS(0)),
+		health:          health.NewServer(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+var (
+	errDraining        = errors.New("server is shutting down")
+	errBusy            = errors.New("too many concurrent requests")
+	errNotConfigured   = errors.New("server is not configured, call Configure or set the request config")
+	errUnauthenticated = errors.New("missing or invalid bearer token")
+)
+
+// statusError is an error with the HTTP status and gRPC code reporting it.
+type statusError struct {
+	status int
+	code   codes.Code
+	err    error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+func (e *statusError) Unwrap() error { return e.err }
+
+func badRequest(err error) error {
+	return &statusError{status: http.StatusBadRequest, code: codes.InvalidArgument, err: err}
+}
+
+func unavailable(err error) error {
+	return &statusError{status: http.StatusServiceUnavailable, code: codes.Unavailable, err: err}
+}
+
+func busy(err error) error {
+	return &statusError{status: http.StatusTooManyRequests, code: codes.ResourceExhausted, err: err}
+}
+
+func unauthenticated(err error) error {
+	return &statusError{status: http.StatusUnauthorized, code: codes.Unauthenticated, err: err}
+}
+
+func forbidden(err error) error {
+	return &statusError{status: http.StatusForbidden, code: codes.PermissionDenied, err: err}
+}
+
+// evalFailed reports a script which could not be synthesized.
+func evalFailed(err error) error {
+	return &statusError{status: http.StatusUnprocessableEntity, code: codes.Aborted, err: err}
+}
+
+// authenticate checks the bearer token of a request with the WithAuth function.
+func (s *Server) authenticate(ctx context.Context, token string) error {
+	if s.auth == nil {
+		return nil
+	}
+	if err := s.auth(ctx, token); err != nil {
+		return unauthenticated(err)
+	}
+	return nil
+}
+
+// CheckOverrides returns an error if config sets a field not in allowed.
+//
+// A request setting EnvPolicy.Allow or EnvInherit could read the host
+// environment, one setting CodeArtifact options could use the AWS credentials
+// of the host for any role or endpoint, and one setting an authenticated
+// scope could send a registry token of the host to any registry. The HCL
+// schema file, read from the host, is never allowed.
+func CheckOverrides(config models.AppConfig, allowed ...Override) error {
+	if !slices.Contains(allowed, OverrideEnv) && (len(config.Env.Allow) > 0 || config.Env.Mode == models.EnvInherit) {
+		return errors.New("env.allow and env.mode inherit are not allowed in request configs")
+	}
+	if hcl := config.CopyOptions.HCL; hcl != nil && hcl.SchemaFile != "" {
+		return errors.New("copy.hcl.schemaFile is not allowed in request configs")
+	}
+	for _, scope := range config.Scopes {
+		if !slices.Contains(allowed, OverrideCodeArtifact) && scope.CodeArtifact != nil {
+			return fmt.Errorf("codeArtifact of scope %s is not allowed in request configs", scope.Scope)
+		}
+		if slices.Contains(allowed, OverrideRegistries) {
+			continue
+		}
+		if scope.RequiresAuth {
+			return fmt.Errorf("requiresAuth of scope %s is not allowed in request configs", scope.Scope)
+		}
+		if strings.TrimSuffix(scope.RegistryURL, "/") != strings.TrimSuffix(DefaultRegistryURL, "/") {
+			return fmt.Errorf("registryURL %s of scope %s is not allowed in request configs", scope.RegistryURL, scope.Scope)
+		}
+	}
+	return nil
+}
+
+// checkConfig checks a request config with CheckOverrides and the WithAllowedOverrides fields.
+func (s *Server) checkConfig(config models.AppConfig) error {
+	if err := CheckOverrides(config, s.overrides...); err != nil {
+		return forbidden(err)
+	}
+	return nil
+}
+
+// RestrictEnv returns config with EnvInherit, also the default without EnvVars,
+// replaced by EnvAllowlist so the scripts never get the whole host environment.
+func RestrictEnv(config models.AppConfig) models.AppConfig {
+	if config.Env.Mode == models.EnvInherit || (config.Env.Mode == "" && len(config.EnvVars) == 0) {
+		config.Env.Mode = models.EnvAllowlist
+	}
+	return config
+}
+
+// Configure validates config, authenticates its registries and uses it for the next Eval requests.
+//
+// config is trusted, the Configure requests received over HTTP and gRPC are
+// checked with CheckOverrides first.
+func (s *Server) Configure(ctx context.Context, config models.AppConfig) error {
+	if s.draining.Load() {
+		return unavailable(errDraining)
+	}
+	config = RestrictEnv(config)
+	app := synth.NewApp(s.newExecutorFn, s.logger, s.appOptions...)
+	if err := app.Configure(ctx, config); err != nil {
+		return badRequest(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = &config
+	return nil
+}
+
+// Eval runs req, calling onLog with each line of the executor output.
+//
+// The request config is checked with CheckOverrides and its environment
+// restricted with RestrictEnv.
+//
+// onLog may be called concurrently.
+func (s *Server) Eval(ctx context.Context, req EvalRequest, onLog func(line string)) (*EvalResponse, error) {
+	if s.draining.Load() {
+		return nil, unavailable(errDraining)
+	}
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	default:
+		return nil, busy(errBusy)
+	}
+	config, err := s.requestConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.MainTs == "" {
+		return nil, badRequest(errors.New("mainTs is required"))
+	}
+	format := req.Format
+	if format == "" {
+		format = FormatFiles
+	}
+	if format != FormatFiles && format != FormatTarGz && format != FormatZip {
+		return nil, badRequest(fmt.Errorf("unknown format %q, expected one of %s, %s, %s", format, FormatFiles, FormatTarGz, FormatZip))
+	}
+	src := req.Src
+	if src == "" {
+		src = "cdktf.out"
+	}
+
+	opts := append(s.appOptions[:len(s.appOptions):len(s.appOptions)], synth.WithOutputSink(lineFunc(onLog)))
+	app := synth.NewApp(s.newExecutorFn, s.logger, opts...)
+	if err := app.Configure(ctx, config); err != nil {
+		return nil, badRequest(err)
+	}
+	dstFs := afero.NewMemMapFs()
+	if err := app.Eval(ctx, dstFs, req.MainTs, src, "out"); err != nil {
+		return nil, evalFailed(err)
+	}
+	return newEvalResponse(dstFs, "out", format)
+}
+
+// requestConfig returns the config of req or the config set by Configure.
+func (s *Server) requestConfig(req EvalRequest) (models.AppConfig, error) {
+	if req.Config != nil {
+		if err := s.checkConfig(*req.Config); err != nil {
+			return models.AppConfig{}, err
+		}
+		return RestrictEnv(*req.Config), nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.config == nil {
+		return models.AppConfig{}, badRequest(errNotConfigured)
+	}
+	return *s.config, nil
+}
+
+// Ready reports whether the Server accepts new requests.
+func (s *Server) Ready() bool {
+	return !s.draining.Load()
+}
+
+// Drain rejects new requests, the running requests complete.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+	s.health.Shutdown()
+}
+
+// RegisterGRPC registers the synth and health services on gs.
+func (s *Server) RegisterGRPC(gs *grpc.Server) {
+	synthpb.RegisterSynthServer(gs, &grpcService{s: s})
+	healthpb.RegisterHealthServer(gs, s.health)
+}
+
+// Run serves HTTP on httpLn and gRPC on grpcLn until ctx is done, either listener may be nil.
+//
+// Once ctx is done, the Server drains: new requests are rejected and Run
+// waits for the running requests up to the drain timeout.
+func (s *Server) Run(ctx context.Context, httpLn, grpcLn net.Listener) error {
+	errs := make(chan error, 2)
+	var servers int
+	var httpServer *http.Server
+	if httpLn != nil {
+		servers++
+		httpServer = &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := httpServer.Serve(httpLn); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("http server: %w", err)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	var grpcServer *grpc.Server
+	if grpcLn != nil {
+		servers++
+		grpcServer = grpc.NewServer(grpc.MaxRecvMsgSize(int(s.maxRequestBytes)))
+		s.RegisterGRPC(grpcServer)
+		go func() {
+			if err := grpcServer.Serve(grpcLn); err != nil {
+				errs <- fmt.Errorf("grpc server: %w", err)
+				return
+			}
+			errs <- nil
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+		servers--
+	}
+	s.logger.Info("draining server")
+	s.Drain()
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	if httpServer != nil {
+		if e := httpServer.Shutdown(drainCtx); e != nil {
+			err = errors.Join(err, fmt.Errorf("http server: %w", e))
+		}
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-drainCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+	for ; servers > 0; servers-- {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+// lineFunc is an io.Writer calling fn with each written line.
+//
+// The App output sink writes whole lines.
+type lineFunc func(line string)
+
+func (f lineFunc) Write(p []byte) (int, error) {
+	if f != nil {
+		f(strings.TrimSuffix(string(p), "\n"))
+	}
+	return len(p), nil
+}
@@ -0,0 +1,492 @@
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/environment-toolkit/go-synth/server/synthpb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	defaultWait  = 5 * time.Second
+	pollInterval = 10 * time.Millisecond
+)
+
+// fakeExecutor logs and synthesizes main.ts as cdktf.out/main.tf.json.
+//
+// A main.ts containing "fail" fails, one containing "block" waits for release,
+// one containing "env" synthesizes the value of SERVER_TEST_SECRET.
+type fakeExecutor struct {
+	output  io.Writer
+	mainTS  string
+	release chan struct{}
+}
+
+func (f *fakeExecutor) Setup(ctx context.Context, config models.AppConfig, envVars map[string]string) error {
+	return nil
+}
+
+func (f *fakeExecutor) Exec(ctx context.Context, mainTS string, envVars map[string]string) error {
+	f.mainTS = mainTS
+	if strings.Contains(mainTS, "env") {
+		f.mainTS = envVars["SERVER_TEST_SECRET"]
+	}
+	if f.output != nil {
+		io.WriteString(f.output, "synthesizing\n")
+	}
+	if strings.Contains(mainTS, "block") {
+		<-f.release
+	}
+	if strings.Contains(mainTS, "fail") {
+		return errors.New("synth failed")
+	}
+	return nil
+}
+
+func (f *fakeExecutor) CopyTo(ctx context.Context, srcDir string, dstFs afero.Fs, dstDir string, opts models.CopyOptions) (models.CopyResult, error) {
+	result := models.CopyResult{Added: []string{"stacks/main.tf.json"}}
+	return result, afero.WriteFile(dstFs, filepath.Join(dstDir, "stacks", "main.tf.json"), []byte(f.mainTS), 0644)
+}
+
+func (f *fakeExecutor) ArchiveTo(ctx context.Context, srcDir string, w io.Writer, format models.ArchiveFormat, opts models.CopyOptions) (models.CopyResult, error) {
+	result := models.CopyResult{Added: []string{"stacks/main.tf.json"}}
+	return result, archive.Write(w, format, map[string][]byte{"stacks/main.tf.json": []byte(f.mainTS)})
+}
+
+func (f *fakeExecutor) CopyFrom(ctx context.Context, srcFs afero.Fs, srcDir, dstDir string, opts models.CopyOptions) (models.CopyResult, error) {
+	return models.CopyResult{}, nil
+}
+
+func (f *fakeExecutor) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+func newTestServer(t *testing.T, opts ...Option) (*Server, chan struct{}) {
+	release := make(chan struct{})
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{output: models.NewExecutorSettings(opts...).Output, release: release}, nil
+	}
+	return New(newFn, zap.NewNop(), opts...), release
+}
+
+func post(t *testing.T, url, body string, header http.Header) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func Test_Server_HTTP(t *testing.T) {
+	s, _ := newTestServer(t, WithMaxRequestBytes(1024))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := post(t, ts.URL+"/v1/eval", `{"mainTs": "// stack"}`, nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(t, ts.URL+"/v1/configure", `{"dependencies": {"cdktf": "1.2.3"}}`, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFiles  map[string]string
+		wantError  string
+	}{
+		{
+			name:       "files",
+			body:       `{"mainTs": "// stack"}`,
+			wantStatus: http.StatusOK,
+			wantFiles:  map[string]string{"stacks/main.tf.json": "// stack"},
+		},
+		{
+			name:       "invalid config",
+			body:       `{"mainTs": "// stack", "config": {"dependencies": {"cdktf": "not a version!"}}}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid AppConfig",
+		},
+		{
+			name:       "unknown format",
+			body:       `{"mainTs": "// stack", "format": "rar"}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  `unknown format "rar"`,
+		},
+		{
+			name:       "unknown field",
+			body:       `{"mainTs": "// stack", "script": "main.ts"}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  `unknown field "script"`,
+		},
+		{
+			name:       "too large",
+			body:       `{"mainTs": "` + strings.Repeat("a", 2048) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "synth failure",
+			body:       `{"mainTs": "// fail"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantError:  "synth failed",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := post(t, ts.URL+"/v1/eval", tc.body, nil)
+			require.Equal(t, tc.wantStatus, resp.StatusCode)
+			var body struct {
+				EvalResponse
+				Error string `json:"error"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			require.Contains(t, body.Error, tc.wantError)
+			if tc.wantFiles != nil {
+				require.Equal(t, tc.wantFiles, body.Files)
+			}
+		})
+	}
+}
+
+func Test_Server_Auth(t *testing.T) {
+	extra := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	s, _ := newTestServer(t, WithBearerToken("s3cret"), WithHTTPHandler("/v1/extra/", extra))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	testCases := []struct {
+		name       string
+		path       string
+		header     http.Header
+		wantStatus int
+	}{
+		{name: "no token", path: "/v1/eval", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", path: "/v1/eval", header: http.Header{"Authorization": {"Bearer nope"}}, wantStatus: http.StatusUnauthorized},
+		{name: "extra handler", path: "/v1/extra/1", wantStatus: http.StatusUnauthorized},
+		{name: "configure", path: "/v1/configure", header: http.Header{"Authorization": {"Bearer s3cret"}}, wantStatus: http.StatusOK},
+		{name: "eval", path: "/v1/eval", header: http.Header{"Authorization": {"Bearer s3cret"}}, wantStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"mainTs": "// stack"}`
+			if tc.path == "/v1/configure" {
+				body = `{}`
+			}
+			resp := post(t, ts.URL+tc.path, body, tc.header)
+			require.Equal(t, tc.wantStatus, resp.StatusCode)
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_Server_Overrides(t *testing.T) {
+	t.Setenv("SERVER_TEST_SECRET", "secret")
+	testCases := []struct {
+		name       string
+		options    []Option
+		config     string
+		wantStatus int
+		wantFile   string
+	}{
+		{name: "default env", config: `{}`, wantStatus: http.StatusOK},
+		{name: "inherit", config: `{"env": {"mode": "inherit"}}`, wantStatus: http.StatusForbidden},
+		{name: "allow", config: `{"env": {"allow": ["SERVER_TEST_*"]}}`, wantStatus: http.StatusForbidden},
+		{name: "hcl schema file", config: `{"copy": {"hcl": {"schemaFile": "/etc/passwd"}}}`, wantStatus: http.StatusForbidden},
+		{
+			name:       "code artifact",
+			config:     `{"scopes": [{"scope": "@acme", "registryURL": "https://acme.d.codeartifact.us-east-1.amazonaws.com/npm/npm/", "codeArtifact": {"roleARN": "arn:aws:iam::123456789012:role/admin"}}]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "authenticated scope",
+			config:     `{"scopes": [{"scope": "@acme", "registryURL": "https://attacker.example/x/d-123456789012.d.codeartifact.us-east-1.amazonaws.com/", "requiresAuth": true}]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "other registry",
+			config:     `{"scopes": [{"scope": "@acme", "registryURL": "https://npm.acme.dev/"}]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "default registry",
+			config:     `{"scopes": [{"scope": "@acme", "registryURL": "https://registry.npmjs.org"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed registry",
+			options:    []Option{WithAllowedOverrides(OverrideRegistries)},
+			config:     `{"scopes": [{"scope": "@acme", "registryURL": "https://npm.acme.dev/"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed inherit is restricted",
+			options:    []Option{WithAllowedOverrides(OverrideEnv)},
+			config:     `{"env": {"mode": "inherit"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed allowlist",
+			options:    []Option{WithAllowedOverrides(OverrideEnv)},
+			config:     `{"env": {"mode": "allowlist", "allow": ["SERVER_TEST_*"]}}`,
+			wantStatus: http.StatusOK,
+			wantFile:   "secret",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t, tc.options...)
+			ts := httptest.NewServer(s.Handler())
+			defer ts.Close()
+
+			resp := post(t, ts.URL+"/v1/eval", `{"mainTs": "// env", "config": `+tc.config+`}`, nil)
+			require.Equal(t, tc.wantStatus, resp.StatusCode)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var body EvalResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			require.Equal(t, map[string]string{"stacks/main.tf.json": tc.wantFile}, body.Files)
+		})
+	}
+}
+
+func Test_Server_HTTPHandler(t *testing.T) {
+	extra := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	s, _ := newTestServer(t, WithHTTPHandler("/v1/extra/", extra))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/extra/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTeapot, resp.StatusCode)
+}
+
+func Test_Server_HTTPStream(t *testing.T) {
+	s, _ := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	header := http.Header{"Accept": {ndjson}}
+
+	readEvents := func(resp *http.Response) []Event {
+		var events []Event
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var event Event
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+			events = append(events, event)
+		}
+		return events
+	}
+
+	resp := post(t, ts.URL+"/v1/eval", `{"mainTs": "// stack", "format": "tar.gz", "config": {}}`, header)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, ndjson, resp.Header.Get("Content-Type"))
+	events := readEvents(resp)
+	require.Len(t, events, 2)
+	require.Equal(t, "synthesizing", events[0].Log)
+	result := events[1].Result
+	require.NotNil(t, result)
+	require.Equal(t, FormatTarGz, result.Format)
+
+	gz, err := gzip.NewReader(bytes.NewReader(result.Archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	header0, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "stacks/main.tf.json", header0.Name)
+	content, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "// stack", string(content))
+
+	resp = post(t, ts.URL+"/v1/eval", `{"mainTs": "// fail", "config": {}}`, header)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	events = readEvents(resp)
+	require.Len(t, events, 2)
+	require.Contains(t, events[1].Error, "synth failed")
+}
+
+func Test_Server_Limits(t *testing.T) {
+	s, release := newTestServer(t, WithMaxConcurrent(1))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	done := make(chan int)
+	go func() {
+		resp, err := http.Post(ts.URL+"/v1/eval", "application/json", strings.NewReader(`{"mainTs": "// block", "config": {}}`))
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	// wait for the blocked request to hold the only slot
+	require.Eventually(t, func() bool { return len(s.sem) == 1 }, defaultWait, pollInterval)
+
+	resp := post(t, ts.URL+"/v1/eval", `{"mainTs": "// stack", "config": {}}`, nil)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	s.Drain()
+	resp, err := http.Get(ts.URL + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp, err = http.Get(ts.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = post(t, ts.URL+"/v1/eval", `{"mainTs": "// stack", "config": {}}`, nil)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// the running request completes while draining
+	close(release)
+	require.Equal(t, http.StatusOK, <-done)
+}
+
+func Test_Server_GRPC(t *testing.T) {
+	s, _ := newTestServer(t)
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	s.RegisterGRPC(gs)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+	client := NewClient(conn)
+
+	_, err = client.Eval(ctx, EvalRequest{MainTs: "// stack"}, nil)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	require.NoError(t, client.Configure(ctx, models.AppConfig{}))
+	var logs []string
+	resp, err := client.Eval(ctx, EvalRequest{MainTs: "// stack"}, func(line string) {
+		logs = append(logs, line)
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"synthesizing"}, logs)
+	require.Equal(t, map[string]string{"stacks/main.tf.json": "// stack"}, resp.Files)
+
+	_, err = client.Eval(ctx, EvalRequest{MainTs: "// fail"}, nil)
+	require.Equal(t, codes.Aborted, status.Code(err))
+	require.ErrorContains(t, err, "synth failed")
+
+	// generated stubs of other languages call the same protobuf service
+	stream, err := synthpb.NewSynthClient(conn).Eval(ctx, &synthpb.EvalRequest{MainTs: "// stack", Format: synthpb.Format_FORMAT_ZIP})
+	require.NoError(t, err)
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "synthesizing", event.GetLog())
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, synthpb.Format_FORMAT_ZIP, event.GetResult().GetFormat())
+	files, err := archive.Read(event.GetResult().GetArchive())
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"stacks/main.tf.json": []byte("// stack")}, files)
+
+	healthClient := healthpb.NewHealthClient(conn)
+	check, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, check.Status)
+	s.Drain()
+	check, err = healthClient.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check.Status)
+	_, err = client.Eval(ctx, EvalRequest{MainTs: "// stack"}, nil)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func Test_Server_GRPCAuth(t *testing.T) {
+	s, _ := newTestServer(t, WithBearerToken("s3cret"))
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	s.RegisterGRPC(gs)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := NewClient(conn)
+
+	ctx := context.Background()
+	require.Equal(t, codes.Unauthenticated, status.Code(client.Configure(ctx, models.AppConfig{})))
+	_, err = client.Eval(ctx, EvalRequest{MainTs: "// stack"}, nil)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer s3cret")
+	require.NoError(t, client.Configure(ctx, models.AppConfig{}))
+	_, err = client.Eval(ctx, EvalRequest{MainTs: "// stack"}, nil)
+	require.NoError(t, err)
+}
+
+func Test_Server_Run(t *testing.T) {
+	s, _ := newTestServer(t)
+	httpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx, httpLn, grpcLn) }()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + httpLn.Addr().String() + "/readyz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, defaultWait, pollInterval)
+	cancel()
+	require.NoError(t, <-done)
+	require.False(t, s.Ready())
+}
@@ -0,0 +1,4 @@
+// Package synthpb holds the gRPC service of the server package, generated from synth.proto.
+package synthpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative synth.proto
@@ -0,0 +1,181 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: synth.proto
+
+package synthpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Synth_Configure_FullMethodName = "/gosynth.v1.Synth/Configure"
+	Synth_Eval_FullMethodName      = "/gosynth.v1.Synth/Eval"
+)
+
+// SynthClient is the client API for Synth service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Synth runs main.ts scripts, see the server package.
+//
+// Requests are authenticated with the "authorization: Bearer <token>" metadata
+// when the server requires a token.
+type SynthClient interface {
+	// Configure validates the config, authenticates its registries and uses it
+	// for the next Eval requests.
+	Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error)
+	// Eval streams an Event for each line of the executor output, the last
+	// Event holds the result. A failed Eval is reported by the stream status.
+	Eval(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type synthClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSynthClient(cc grpc.ClientConnInterface) SynthClient {
+	return &synthClient{cc}
+}
+
+func (c *synthClient) Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfigureResponse)
+	err := c.cc.Invoke(ctx, Synth_Configure_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *synthClient) Eval(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Synth_ServiceDesc.Streams[0], Synth_Eval_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EvalRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Synth_EvalClient = grpc.ServerStreamingClient[Event]
+
+// SynthServer is the server API for Synth service.
+// All implementations must embed UnimplementedSynthServer
+// for forward compatibility.
+//
+// Synth runs main.ts scripts, see the server package.
+//
+// Requests are authenticated with the "authorization: Bearer <token>" metadata
+// when the server requires a token.
+type SynthServer interface {
+	// Configure validates the config, authenticates its registries and uses it
+	// for the next Eval requests.
+	Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error)
+	// Eval streams an Event for each line of the executor output, the last
+	// Event holds the result. A failed Eval is reported by the stream status.
+	Eval(*EvalRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedSynthServer()
+}
+
+// UnimplementedSynthServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSynthServer struct{}
+
+func (UnimplementedSynthServer) Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Configure not implemented")
+}
+func (UnimplementedSynthServer) Eval(*EvalRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Eval not implemented")
+}
+func (UnimplementedSynthServer) mustEmbedUnimplementedSynthServer() {}
+func (UnimplementedSynthServer) testEmbeddedByValue()               {}
+
+// UnsafeSynthServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SynthServer will
+// result in compilation errors.
+type UnsafeSynthServer interface {
+	mustEmbedUnimplementedSynthServer()
+}
+
+func RegisterSynthServer(s grpc.ServiceRegistrar, srv SynthServer) {
+	// If the following call pancis, it indicates UnimplementedSynthServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Synth_ServiceDesc, srv)
+}
+
+func _Synth_Configure_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SynthServer).Configure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Synth_Configure_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SynthServer).Configure(ctx, req.(*ConfigureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Synth_Eval_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EvalRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SynthServer).Eval(m, &grpc.GenericServerStream[EvalRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Synth_EvalServer = grpc.ServerStreamingServer[Event]
+
+// Synth_ServiceDesc is the grpc.ServiceDesc for Synth service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Synth_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gosynth.v1.Synth",
+	HandlerType: (*SynthServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Configure",
+			Handler:    _Synth_Configure_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Eval",
+			Handler:       _Synth_Eval_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "synth.proto",
+}
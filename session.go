@@ -0,0 +1,161 @@
+package synth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+)
+
+// ErrSessionUnsupported is returned by Prepare when the Executor does not implement models.WorkspaceExecutor.
+var ErrSessionUnsupported = errors.New("executor does not support sessions")
+
+// ErrSessionClosed is returned by Session.Eval after Close.
+var ErrSessionClosed = errors.New("session is closed")
+
+// Session is an Executor working directory set up once and shared by many scripts.
+//
+// Each Eval runs in its own sub directory, so the scripts do not see each
+// other's output. A Session is safe for concurrent use.
+type Session interface {
+	// Eval runs mainTs in a new sub directory of the working directory and
+	// copies its src directory to dest in fs.
+	Eval(ctx context.Context, fs afero.Fs, mainTs, src, dest string) error
+	// EvalArchive runs mainTs like Eval and streams its src directory to w as a format archive.
+	EvalArchive(ctx context.Context, w io.Writer, format models.ArchiveFormat, mainTs, src string) error
+	// Run runs a single request like Eval or EvalArchive and returns its result.
+	Run(ctx context.Context, req EvalRequest) EvalResult
+	// EvalMany runs the requests with at most workers concurrent Eval calls.
+	//
+	// workers <= 0 uses runtime.GOMAXPROCS(0).
+	EvalMany(ctx context.Context, requests []EvalRequest, workers int) []EvalResult
+	// Executor returns the prepared Executor, e.g. to copy shared files in.
+	Executor() models.WorkspaceExecutor
+	// Close releases the Executor, the Session can not be used afterwards.
+	Close(ctx context.Context) error
+}
+
+type session struct {
+	app      *app
+	env      *environment
+	executor models.WorkspaceExecutor
+	runs     atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Prepare returns a Session with the dependencies installed once.
+//
+// The setup hooks and AppConfig.PreSetupFn run here, the exec and copy hooks
+// run for each Session.Eval.
+func (a *app) Prepare(ctx context.Context) (Session, error) {
+	env := a.environment()
+	s, err := a.prepare(ctx, env)
+	return s, env.redactor.Error(err)
+}
+
+func (a *app) prepare(ctx context.Context, env *environment) (*session, error) {
+	e, err := a.pool.Get(ctx, func() (models.Executor, error) {
+		return a.newExecutor(env)
+	})
+	if err != nil {
+		return nil, a.setupFailed(ctx, nil, err)
+	}
+	we, ok := e.(models.WorkspaceExecutor)
+	if !ok {
+		return nil, errors.Join(ErrSessionUnsupported, a.pool.Put(ctx, e))
+	}
+	if env.config.PreSetupFn != nil {
+		if err := env.config.PreSetupFn(e); err != nil {
+			return nil, errors.Join(a.setupFailed(ctx, e, err), a.pool.Put(ctx, e))
+		}
+	}
+	if err := a.runPhase(ctx, e, PhaseSetup, func(*PhaseInfo) error {
+		return e.Setup(ctx, env.config, env.installEnv)
+	}); err != nil {
+		return nil, errors.Join(err, a.pool.Put(ctx, e))
+	}
+	return &session{app: a, env: env, executor: we}, nil
+}
+
+func (a *app) EvalBatch(ctx context.Context, requests []EvalRequest, workers int) ([]EvalResult, error) {
+	env := a.environment()
+	s, err := a.prepare(ctx, env)
+	if err != nil {
+		return nil, env.redactor.Error(err)
+	}
+	results := s.EvalMany(ctx, requests, workers)
+	return results, env.redactor.Error(s.Close(ctx))
+}
+
+func (s *session) Executor() models.WorkspaceExecutor {
+	return s.executor
+}
+
+func (s *session) Eval(ctx context.Context, dstFs afero.Fs, mainTs, src, dstPath string) error {
+	_, err := s.eval(ctx, EvalRequest{Fs: dstFs, MainTs: mainTs, Src: src, Dest: dstPath})
+	return s.env.redactor.Error(err)
+}
+
+func (s *session) EvalArchive(ctx context.Context, w io.Writer, format models.ArchiveFormat, mainTs, src string) error {
+	_, err := s.eval(ctx, EvalRequest{Archive: w, Format: format, MainTs: mainTs, Src: src})
+	return s.env.redactor.Error(err)
+}
+
+func (s *session) Run(ctx context.Context, req EvalRequest) EvalResult {
+	return s.app.timed(s.env.redactor, func() (EvalResult, error) { return s.eval(ctx, req) })
+}
+
+func (s *session) EvalMany(ctx context.Context, requests []EvalRequest, workers int) []EvalResult {
+	return s.app.evalMany(requests, workers, s.env.redactor, func(req EvalRequest) (EvalResult, error) {
+		return s.eval(ctx, req)
+	})
+}
+
+func (s *session) eval(ctx context.Context, req EvalRequest) (EvalResult, error) {
+	// hold the read lock so Close waits for the running scripts
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return EvalResult{}, ErrSessionClosed
+	}
+	if err := checkRequest(s.env, req); err != nil {
+		return EvalResult{}, err
+	}
+	a, e := s.app, s.executor
+	start := a.now()
+	dir := path.Join(models.RunsDir, strconv.FormatUint(s.runs.Add(1), 10))
+	defer func() {
+		if err := e.RemoveDir(ctx, dir); err != nil {
+			a.logger.Warn("error removing run directory", zap.String("dir", dir), zap.Error(err))
+		}
+	}()
+	if err := a.runPhase(ctx, e, PhaseExec, func(*PhaseInfo) error {
+		return e.ExecIn(ctx, dir, req.MainTs, s.env.execEnv)
+	}); err != nil {
+		return EvalResult{}, err
+	}
+	return a.copyAndValidate(ctx, s.env, e, req, path.Join(dir, req.Src), start)
+}
+
+func (s *session) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if err := s.app.pool.Put(ctx, s.executor); err != nil {
+		return fmt.Errorf("error closing session: %w", err)
+	}
+	return nil
+}
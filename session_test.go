@@ -0,0 +1,168 @@
+package synth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// workspaceExecutor is a fakeExecutor keeping the main.ts of each run directory.
+type workspaceExecutor struct {
+	fakeExecutor
+	setups   atomic.Int32
+	cleanups atomic.Int32
+
+	mu      sync.Mutex
+	runs    map[string]string
+	removed []string
+}
+
+func newWorkspaceExecutor() *workspaceExecutor {
+	return &workspaceExecutor{runs: map[string]string{}}
+}
+
+func (w *workspaceExecutor) Setup(ctx context.Context, config models.AppConfig, envVars map[string]string) error {
+	w.setups.Add(1)
+	return nil
+}
+
+func (w *workspaceExecutor) ExecIn(ctx context.Context, dir, mainTS string, envVars map[string]string) error {
+	if strings.Contains(mainTS, "fail") {
+		return errors.New("synth failed")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.runs[dir] = mainTS
+	return nil
+}
+
+func (w *workspaceExecutor) RemoveDir(ctx context.Context, dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removed = append(w.removed, dir)
+	return nil
+}
+
+// CopyTo writes the main.ts of the run directory containing srcDir to dstDir.
+func (w *workspaceExecutor) CopyTo(ctx context.Context, srcDir string, dstFS afero.Fs, dstDir string, options models.CopyOptions) (models.CopyResult, error) {
+	w.mu.Lock()
+	mainTS, ok := w.runs[path.Dir(srcDir)]
+	w.mu.Unlock()
+	if !ok {
+		return models.CopyResult{}, fmt.Errorf("unknown run directory for %s", srcDir)
+	}
+	result := models.CopyResult{Added: []string{"main.ts"}}
+	return result, afero.WriteFile(dstFS, filepath.Join(dstDir, "main.ts"), []byte(mainTS), 0644)
+}
+
+func (w *workspaceExecutor) Cleanup(ctx context.Context) error {
+	w.cleanups.Add(1)
+	return nil
+}
+
+func Test_app_EvalBatch(t *testing.T) {
+	ctx := context.Background()
+	executor := newWorkspaceExecutor()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return executor, nil
+	}
+	a := NewApp(newFn, zap.NewNop())
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+
+	dstFs := afero.NewMemMapFs()
+	var requests []EvalRequest
+	for i := 0; i < 6; i++ {
+		mainTs := fmt.Sprintf("// stack %d", i)
+		if i == 2 {
+			mainTs = "// fail"
+		}
+		requests = append(requests, EvalRequest{
+			Fs:     dstFs,
+			MainTs: mainTs,
+			Src:    "cdktf.out",
+			Dest:   fmt.Sprintf("out/%d", i),
+		})
+	}
+	results, err := a.EvalBatch(ctx, requests, 3)
+	require.NoError(t, err)
+	require.Len(t, results, len(requests))
+	for i, result := range results {
+		if i == 2 {
+			require.EqualError(t, result.Err, "synth failed")
+			continue
+		}
+		require.NoError(t, result.Err)
+		content, err := afero.ReadFile(dstFs, fmt.Sprintf("out/%d/main.ts", i))
+		require.NoError(t, err)
+		require.Equal(t, requests[i].MainTs, string(content))
+	}
+	require.Equal(t, int32(1), executor.setups.Load())
+	require.Equal(t, int32(1), executor.cleanups.Load())
+	require.Len(t, executor.removed, len(requests))
+	require.Len(t, executor.runs, len(requests)-1)
+}
+
+func Test_session_Run(t *testing.T) {
+	ctx := context.Background()
+	executor := newWorkspaceExecutor()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return executor, nil
+	}
+	a := NewApp(newFn, zap.NewNop())
+	require.NoError(t, a.Configure(ctx, models.AppConfig{}))
+	s, err := a.Prepare(ctx)
+	require.NoError(t, err)
+	defer s.Close(ctx)
+
+	dstFs := afero.NewMemMapFs()
+	result := s.Run(ctx, EvalRequest{Fs: dstFs, MainTs: "// stack", Src: "cdktf.out", Dest: "out"})
+	require.NoError(t, result.Err)
+	require.Equal(t, models.CopyResult{Added: []string{"main.ts"}}, result.Copy)
+	result = s.Run(ctx, EvalRequest{Fs: dstFs, MainTs: "// fail", Src: "cdktf.out", Dest: "out"})
+	require.EqualError(t, result.Err, "synth failed")
+}
+
+func Test_session_Close(t *testing.T) {
+	ctx := context.Background()
+	executor := newWorkspaceExecutor()
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return executor, nil
+	}
+	a := NewApp(newFn, zap.NewNop())
+	s, err := a.Prepare(ctx)
+	require.NoError(t, err)
+	require.Equal(t, executor, s.Executor())
+
+	dstFs := afero.NewMemMapFs()
+	require.NoError(t, s.Eval(ctx, dstFs, "// stack", "cdktf.out", "out"))
+	require.NoError(t, s.Close(ctx))
+	require.NoError(t, s.Close(ctx))
+	require.ErrorIs(t, s.Eval(ctx, dstFs, "// stack", "cdktf.out", "out"), ErrSessionClosed)
+	require.Equal(t, int32(1), executor.cleanups.Load())
+}
+
+func Test_app_PrepareUnsupported(t *testing.T) {
+	ctx := context.Background()
+	pool := &countingPool{}
+	newFn := func(logger *zap.Logger, opts ...models.ExecutorOption) (models.Executor, error) {
+		return &fakeExecutor{logger: logger}, nil
+	}
+	a := NewApp(newFn, zap.NewNop(), WithExecutorPool(pool))
+	_, err := a.Prepare(ctx)
+	require.ErrorIs(t, err, ErrSessionUnsupported)
+	_, err = a.EvalBatch(ctx, nil, 1)
+	require.ErrorIs(t, err, ErrSessionUnsupported)
+	require.Equal(t, 2, pool.gets)
+	require.Equal(t, 2, pool.puts)
+}
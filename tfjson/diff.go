@@ -0,0 +1,342 @@
+package tfjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Change is how a stack, object or attribute differs between two outputs.
+type Change string
+
+const (
+	// ChangeAdded is only in the second output.
+	ChangeAdded Change = "added"
+	// ChangeRemoved is only in the first output.
+	ChangeRemoved Change = "removed"
+	// ChangeChanged is in both outputs with different values.
+	ChangeChanged Change = "changed"
+)
+
+// Kind is the kind of a Terraform object of a stack, the objects of a
+// StackDiff are sorted in the order of the constants.
+type Kind string
+
+const (
+	KindBackend          Kind = "backend"
+	KindRequiredProvider Kind = "required_provider"
+	KindProvider         Kind = "provider"
+	KindVariable         Kind = "variable"
+	KindLocal            Kind = "local"
+	KindData             Kind = "data"
+	KindResource         Kind = "resource"
+	KindModule           Kind = "module"
+	KindOutput           Kind = "output"
+)
+
+// kindOrder sorts the objects of a StackDiff.
+var kindOrder = map[Kind]int{
+	KindBackend:          0,
+	KindRequiredProvider: 1,
+	KindProvider:         2,
+	KindVariable:         3,
+	KindLocal:            4,
+	KindData:             5,
+	KindResource:         6,
+	KindModule:           7,
+	KindOutput:           8,
+}
+
+// Diff lists the stacks which differ between two outputs, by name.
+type Diff struct {
+	Stacks []StackDiff `json:"stacks"`
+}
+
+// StackDiff lists the objects which differ in a stack, by kind and address.
+type StackDiff struct {
+	Name    string         `json:"name"`
+	Change  Change         `json:"change"`
+	Objects []ObjectChange `json:"objects,omitempty"`
+}
+
+// ObjectChange is a Terraform object added, removed or changed.
+type ObjectChange struct {
+	Kind Kind `json:"kind"`
+	// Address is the Terraform address, e.g. aws_s3_bucket.b, data.aws_region.r,
+	// aws.west for an aliased provider or var.name.
+	Address string `json:"address"`
+	Change  Change `json:"change"`
+	// Attributes are only set for changed objects.
+	Attributes []AttributeChange `json:"attributes,omitempty"`
+}
+
+// AttributeChange is a value of a changed object, by JSON path.
+type AttributeChange struct {
+	// Path is relative to the object, e.g. tags.Name or ingress[0].from_port.
+	Path   string `json:"path"`
+	Change Change `json:"change"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// Empty reports whether the outputs have the same stacks.
+func (d *Diff) Empty() bool {
+	return len(d.Stacks) == 0
+}
+
+// ErrNoStacks is returned by DiffFiles when an output has no stacks/<name>/cdk.tf.json file.
+var ErrNoStacks = errors.New("no stacks/<name>/cdk.tf.json file")
+
+// stackPath matches the synthesized stacks of a cdktf.out tree, under an optional directory.
+var stackPath = regexp.MustCompile(`^(?:(.+)/)?stacks/([^/]+)/cdk\.tf\.json$`)
+
+// DiffFiles compares the stacks of two cdktf.out trees, given by slash
+// separated path as returned by archive.ReadFiles or archive.Read.
+//
+// The stacks are the stacks/<name>/cdk.tf.json files, all under the same
+// directory, e.g. cdktf.out/stacks/<name>/cdk.tf.json for an archive of the
+// cdktf.out directory. The `//` metadata blocks are ignored. ErrNoStacks is
+// returned when an output has no stacks, so an unexpected layout is not
+// reported as no changes.
+func DiffFiles(before, after map[string][]byte) (*Diff, error) {
+	beforeStacks, err := parseStacks(before)
+	if err != nil {
+		return nil, fmt.Errorf("before: %w", err)
+	}
+	afterStacks, err := parseStacks(after)
+	if err != nil {
+		return nil, fmt.Errorf("after: %w", err)
+	}
+	diff := &Diff{Stacks: []StackDiff{}}
+	for _, name := range unionKeys(beforeStacks, afterStacks) {
+		b, inBefore := beforeStacks[name]
+		a, inAfter := afterStacks[name]
+		stack := StackDiff{Name: name, Change: ChangeChanged}
+		switch {
+		case !inBefore:
+			stack.Change = ChangeAdded
+		case !inAfter:
+			stack.Change = ChangeRemoved
+		}
+		stack.Objects = diffObjects(b, a)
+		if stack.Change == ChangeChanged && len(stack.Objects) == 0 {
+			continue
+		}
+		diff.Stacks = append(diff.Stacks, stack)
+	}
+	return diff, nil
+}
+
+// object is a Terraform object of a stack.
+type object struct {
+	kind    Kind
+	address string
+	body    any
+}
+
+// parseStacks returns the objects of each stack by kind and address.
+func parseStacks(files map[string][]byte) (map[string]map[string]object, error) {
+	stacks := map[string]map[string]object{}
+	dirs := map[string]bool{}
+	for name, content := range files {
+		match := stackPath.FindStringSubmatch(path.Clean(name))
+		if match == nil {
+			continue
+		}
+		dirs[match[1]] = true
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		var stack map[string]any
+		if err := decoder.Decode(&stack); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		stacks[match[2]] = stackObjects(stack)
+	}
+	if len(stacks) == 0 {
+		return nil, ErrNoStacks
+	}
+	if len(dirs) > 1 {
+		return nil, fmt.Errorf("stacks found in several directories: %q", unionKeys(dirs, nil))
+	}
+	return stacks, nil
+}
+
+// stackObjects returns the objects of a cdk.tf.json by kind and address.
+func stackObjects(stack map[string]any) map[string]object {
+	objects := map[string]object{}
+	add := func(kind Kind, address string, body any) {
+		objects[string(kind)+" "+address] = object{kind: kind, address: address, body: withoutMetadata(body)}
+	}
+	for typ, byName := range asMap(stack["resource"]) {
+		for name, body := range asMap(byName) {
+			add(KindResource, typ+"."+name, body)
+		}
+	}
+	for typ, byName := range asMap(stack["data"]) {
+		for name, body := range asMap(byName) {
+			add(KindData, "data."+typ+"."+name, body)
+		}
+	}
+	for name, configs := range asMap(stack["provider"]) {
+		list, ok := configs.([]any)
+		if !ok {
+			list = []any{configs}
+		}
+		for _, config := range list {
+			address := name
+			if alias, ok := asMap(config)["alias"].(string); ok && alias != "" {
+				address += "." + alias
+			}
+			add(KindProvider, address, config)
+		}
+	}
+	terraform := asMap(stack["terraform"])
+	for typ, body := range asMap(terraform["backend"]) {
+		add(KindBackend, typ, body)
+	}
+	for name, body := range asMap(terraform["required_providers"]) {
+		add(KindRequiredProvider, name, body)
+	}
+	for name, body := range asMap(stack["variable"]) {
+		add(KindVariable, "var."+name, body)
+	}
+	for name, body := range asMap(stack["locals"]) {
+		add(KindLocal, "local."+name, body)
+	}
+	for name, body := range asMap(stack["module"]) {
+		add(KindModule, "module."+name, body)
+	}
+	for name, body := range asMap(stack["output"]) {
+		add(KindOutput, "output."+name, body)
+	}
+	return objects
+}
+
+// diffObjects returns the objects which differ, sorted by kind and address.
+func diffObjects(before, after map[string]object) []ObjectChange {
+	var changes []ObjectChange
+	for _, key := range unionKeys(before, after) {
+		b, inBefore := before[key]
+		a, inAfter := after[key]
+		switch {
+		case !inBefore:
+			changes = append(changes, ObjectChange{Kind: a.kind, Address: a.address, Change: ChangeAdded})
+		case !inAfter:
+			changes = append(changes, ObjectChange{Kind: b.kind, Address: b.address, Change: ChangeRemoved})
+		default:
+			if attributes := diffValues("", b.body, a.body, nil); len(attributes) > 0 {
+				changes = append(changes, ObjectChange{Kind: a.kind, Address: a.address, Change: ChangeChanged, Attributes: attributes})
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return kindOrder[changes[i].Kind] < kindOrder[changes[j].Kind]
+		}
+		return changes[i].Address < changes[j].Address
+	})
+	return changes
+}
+
+// diffValues appends the attributes which differ below path.
+func diffValues(p string, before, after any, changes []AttributeChange) []AttributeChange {
+	beforeMap, beforeIsMap := before.(map[string]any)
+	afterMap, afterIsMap := after.(map[string]any)
+	if beforeIsMap && afterIsMap {
+		for _, key := range unionKeys(beforeMap, afterMap) {
+			b, inBefore := beforeMap[key]
+			a, inAfter := afterMap[key]
+			child := joinKey(p, key)
+			switch {
+			case !inBefore:
+				changes = append(changes, AttributeChange{Path: child, Change: ChangeAdded, After: a})
+			case !inAfter:
+				changes = append(changes, AttributeChange{Path: child, Change: ChangeRemoved, Before: b})
+			default:
+				changes = diffValues(child, b, a, changes)
+			}
+		}
+		return changes
+	}
+	beforeList, beforeIsList := before.([]any)
+	afterList, afterIsList := after.([]any)
+	if beforeIsList && afterIsList {
+		for i := 0; i < max(len(beforeList), len(afterList)); i++ {
+			child := p + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(beforeList):
+				changes = append(changes, AttributeChange{Path: child, Change: ChangeAdded, After: afterList[i]})
+			case i >= len(afterList):
+				changes = append(changes, AttributeChange{Path: child, Change: ChangeRemoved, Before: beforeList[i]})
+			default:
+				changes = diffValues(child, beforeList[i], afterList[i], changes)
+			}
+		}
+		return changes
+	}
+	if !reflect.DeepEqual(before, after) {
+		changes = append(changes, AttributeChange{Path: p, Change: ChangeChanged, Before: before, After: after})
+	}
+	return changes
+}
+
+// identifier matches the keys written without quotes in a path.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func joinKey(p, key string) string {
+	if !identifier.MatchString(key) {
+		return p + "[" + strconv.Quote(key) + "]"
+	}
+	if p == "" {
+		return key
+	}
+	return p + "." + key
+}
+
+// withoutMetadata returns v without its `//` metadata blocks.
+func withoutMetadata(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		clean := make(map[string]any, len(v))
+		for key, child := range v {
+			if key != MetadataKey {
+				clean[key] = withoutMetadata(child)
+			}
+		}
+		return clean
+	case []any:
+		clean := make([]any, len(v))
+		for i, child := range v {
+			clean[i] = withoutMetadata(child)
+		}
+		return clean
+	default:
+		return v
+	}
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+// unionKeys returns the keys of both maps in order.
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
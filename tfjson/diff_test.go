@@ -0,0 +1,116 @@
+package tfjson
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffFiles(t *testing.T) {
+	before := map[string][]byte{
+		"manifest.json": []byte(`{"version":"0.20.7"}`),
+		"stacks/dev/cdk.tf.json": []byte(`{
+			"//": {"metadata": {"version": "0.20.7"}},
+			"terraform": {
+				"backend": {"s3": {"bucket": "state"}},
+				"required_providers": {"aws": {"source": "aws", "version": "5.0.0"}}
+			},
+			"provider": {"aws": [{"region": "us-east-1"}, {"alias": "west", "region": "us-west-2"}]},
+			"variable": {"env": {"type": "string"}},
+			"resource": {
+				"aws_s3_bucket": {
+					"b": {"//": {"metadata": {"path": "dev/b"}}, "bucket": "b", "tags": {"Name": "b", "team.name": "x"}},
+					"old": {"bucket": "old"}
+				},
+				"aws_security_group": {"sg": {"ingress": [{"from_port": 80}, {"from_port": 443}]}}
+			},
+			"output": {"url": {"value": "${aws_s3_bucket.b.id}"}}
+		}`),
+		"stacks/removed/cdk.tf.json": []byte(`{"resource": {"null_resource": {"r": {}}}}`),
+		"stacks/same/cdk.tf.json":    []byte(`{"resource": {"null_resource": {"r": {"triggers": {"a": 1}}}}}`),
+	}
+	after := map[string][]byte{
+		"stacks/dev/cdk.tf.json": []byte(`{
+			"//": {"metadata": {"version": "0.20.8"}},
+			"terraform": {
+				"backend": {"s3": {"bucket": "state"}},
+				"required_providers": {"aws": {"source": "aws", "version": "5.1.0"}}
+			},
+			"provider": {"aws": [{"region": "us-east-1"}, {"alias": "west", "region": "eu-west-1"}]},
+			"variable": {"env": {"type": "string"}},
+			"resource": {
+				"aws_s3_bucket": {
+					"b": {"//": {"metadata": {"path": "dev/bucket"}}, "bucket": "b", "tags": {"Name": "bucket", "team.name": "x", "Env": "dev"}}
+				},
+				"aws_security_group": {"sg": {"ingress": [{"from_port": 80}]}}
+			},
+			"data": {"aws_region": {"r": {}}},
+			"output": {"url": {"value": "${aws_s3_bucket.b.id}"}, "arn": {"value": "${aws_s3_bucket.b.arn}"}}
+		}`),
+		"stacks/added/cdk.tf.json": []byte(`{"output": {"o": {"value": 1}}}`),
+		"stacks/same/cdk.tf.json":  []byte(`{"resource":{"null_resource":{"r":{"triggers":{"a":1}}}}}`),
+	}
+
+	diff, err := DiffFiles(before, after)
+	require.NoError(t, err)
+	require.False(t, diff.Empty())
+	require.Equal(t, []StackDiff{
+		{Name: "added", Change: ChangeAdded, Objects: []ObjectChange{
+			{Kind: KindOutput, Address: "output.o", Change: ChangeAdded},
+		}},
+		{Name: "dev", Change: ChangeChanged, Objects: []ObjectChange{
+			{Kind: KindRequiredProvider, Address: "aws", Change: ChangeChanged, Attributes: []AttributeChange{
+				{Path: "version", Change: ChangeChanged, Before: "5.0.0", After: "5.1.0"},
+			}},
+			{Kind: KindProvider, Address: "aws.west", Change: ChangeChanged, Attributes: []AttributeChange{
+				{Path: "region", Change: ChangeChanged, Before: "us-west-2", After: "eu-west-1"},
+			}},
+			{Kind: KindData, Address: "data.aws_region.r", Change: ChangeAdded},
+			{Kind: KindResource, Address: "aws_s3_bucket.b", Change: ChangeChanged, Attributes: []AttributeChange{
+				{Path: "tags.Env", Change: ChangeAdded, After: "dev"},
+				{Path: "tags.Name", Change: ChangeChanged, Before: "b", After: "bucket"},
+			}},
+			{Kind: KindResource, Address: "aws_s3_bucket.old", Change: ChangeRemoved},
+			{Kind: KindResource, Address: "aws_security_group.sg", Change: ChangeChanged, Attributes: []AttributeChange{
+				{Path: "ingress[1]", Change: ChangeRemoved, Before: map[string]any{"from_port": json.Number("443")}},
+			}},
+			{Kind: KindOutput, Address: "output.arn", Change: ChangeAdded},
+		}},
+		{Name: "removed", Change: ChangeRemoved, Objects: []ObjectChange{
+			{Kind: KindResource, Address: "null_resource.r", Change: ChangeRemoved},
+		}},
+	}, diff.Stacks)
+
+	diff, err = DiffFiles(after, after)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	_, err = DiffFiles(map[string][]byte{"stacks/x/cdk.tf.json": []byte("{")}, nil)
+	require.ErrorContains(t, err, "invalid stacks/x/cdk.tf.json")
+
+	// the stacks of an archive of the cdktf.out directory are under cdktf.out/
+	prefixed := map[string][]byte{}
+	for name, content := range after {
+		prefixed["cdktf.out/"+name] = content
+	}
+	diff, err = DiffFiles(after, prefixed)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	_, err = DiffFiles(before, map[string][]byte{"out/cdk.tf.json": []byte("{}")})
+	require.ErrorIs(t, err, ErrNoStacks)
+	require.ErrorContains(t, err, "after: no stacks")
+	_, err = DiffFiles(before, map[string][]byte{
+		"a/stacks/x/cdk.tf.json": []byte("{}"),
+		"b/stacks/y/cdk.tf.json": []byte("{}"),
+	})
+	require.ErrorContains(t, err, `stacks found in several directories: ["a" "b"]`)
+}
+
+func Test_joinKey(t *testing.T) {
+	require.Equal(t, "tags", joinKey("", "tags"))
+	require.Equal(t, "tags.Name", joinKey("tags", "Name"))
+	require.Equal(t, `tags["team.name"]`, joinKey("tags", "team.name"))
+	require.Equal(t, `["a b"]`, joinKey("", "a b"))
+}
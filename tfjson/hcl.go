@@ -0,0 +1,566 @@
+package tfjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultHCLBlocks are the nested block types written as blocks by ToHCL,
+// whatever the provider schema.
+var DefaultHCLBlocks = []string{
+	"lifecycle",
+	"provisioner",
+	"connection",
+	"precondition",
+	"postcondition",
+	"validation",
+	"dynamic",
+	"content",
+}
+
+// DefaultHCLAttributes are the object attributes of the provider blocks
+// written as attributes by ToHCL without the provider schema.
+var DefaultHCLAttributes = []string{
+	"labels",
+	"tags",
+	"tags_all",
+	"triggers",
+}
+
+// metaBlocks are the nested blocks defined by Terraform rather than by the providers.
+var metaBlocks = []string{"lifecycle", "provisioner", "connection", "precondition", "postcondition", "validation"}
+
+// HCLOptions configure ToHCL.
+//
+// Terraform JSON does not tell attributes from nested blocks, e.g. the
+// ingress blocks of aws_security_group. The provider, resource and data
+// blocks follow Schema when it covers their type, otherwise an object value
+// must be listed in Blocks or Attributes, or ToHCL fails rather than write
+// HCL Terraform rejects.
+type HCLOptions struct {
+	// Schema holds the provider schemas, see ParseSchema.
+	Schema *Schema
+	// Blocks are the nested block types written as blocks without the schema,
+	// in addition to DefaultHCLBlocks.
+	Blocks []string
+	// Attributes are the object attributes written as attributes without the
+	// schema, in addition to DefaultHCLAttributes.
+	Attributes []string
+}
+
+// ToHCL converts a Terraform JSON configuration, e.g. cdk.tf.json, to the
+// HCL native syntax.
+//
+// The blocks and attributes are sorted by name, the `//` metadata is
+// dropped and a string made of a single interpolation is written as a bare
+// expression, e.g. "${var.name}" as var.name. An object of a provider,
+// resource or data block which may be a nested block or an attribute is an
+// error, see HCLOptions.
+func ToHCL(data []byte, options HCLOptions) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var config map[string]any
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	w := &hclWriter{
+		schema:     options.Schema,
+		blocks:     append(slices.Clone(DefaultHCLBlocks), options.Blocks...),
+		attributes: append(slices.Clone(DefaultHCLAttributes), options.Attributes...),
+	}
+	if err := w.config(config); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+type hclWriter struct {
+	buf        bytes.Buffer
+	schema     *Schema
+	blocks     []string
+	attributes []string
+	// blocksWritten separates the top-level blocks with a blank line.
+	blocksWritten int
+}
+
+// blockScope tells the nested blocks of a block from its attributes.
+type blockScope struct {
+	// schema of the block, nil if unknown.
+	schema *schemaBlock
+	// strict is set for the provider blocks without schema, their objects
+	// must be listed in the blocks or attributes.
+	strict bool
+}
+
+// providerScope returns the scope of a provider, resource or data block.
+func (w *hclWriter) providerScope(kind, name string) blockScope {
+	if schema := w.schema.block(kind, name); schema != nil {
+		return blockScope{schema: schema}
+	}
+	return blockScope{strict: true}
+}
+
+// config writes the top-level blocks in the order of a hand written configuration.
+func (w *hclWriter) config(config map[string]any) error {
+	for key := range config {
+		switch key {
+		case MetadataKey, "terraform", "provider", "variable", "locals", "data", "resource", "module", "output",
+			"check", "import", "moved", "removed":
+		default:
+			return fmt.Errorf("unsupported top-level block %q", key)
+		}
+	}
+	if terraform, ok := config["terraform"]; ok {
+		if err := w.topBlock(terraform, blockScope{}, "terraform"); err != nil {
+			return err
+		}
+	}
+	providers := asMap(config["provider"])
+	for _, name := range sortedKeys(providers) {
+		// a provider holds a list of configurations, one per alias
+		configs, ok := providers[name].([]any)
+		if !ok {
+			configs = []any{providers[name]}
+		}
+		for _, body := range configs {
+			if err := w.topBlock(body, w.providerScope("provider", name), "provider", name); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.namedBlocks(config, "variable"); err != nil {
+		return err
+	}
+	if locals, ok := config["locals"]; ok {
+		if err := w.topBlock(locals, blockScope{}, "locals"); err != nil {
+			return err
+		}
+	}
+	for _, kind := range []string{"data", "resource"} {
+		byType := asMap(config[kind])
+		for _, typ := range sortedKeys(byType) {
+			byName := asMap(byType[typ])
+			for _, name := range sortedKeys(byName) {
+				if err := w.topBlock(byName[name], w.providerScope(kind, typ), kind, typ, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, kind := range []string{"module", "output", "check"} {
+		if err := w.namedBlocks(config, kind); err != nil {
+			return err
+		}
+	}
+	for _, kind := range []string{"import", "moved", "removed"} {
+		if err := w.unlabeledBlocks(config, kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlabeledBlocks writes a block without label for each item of config[kind],
+// a list of objects.
+func (w *hclWriter) unlabeledBlocks(config map[string]any, kind string) error {
+	value, ok := config[kind]
+	if !ok {
+		return nil
+	}
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	for _, body := range items {
+		if err := w.topBlock(body, blockScope{}, kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namedBlocks writes a block with a single label for each key of config[kind].
+func (w *hclWriter) namedBlocks(config map[string]any, kind string) error {
+	byName := asMap(config[kind])
+	for _, name := range sortedKeys(byName) {
+		if err := w.topBlock(byName[name], blockScope{}, kind, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topBlock writes a top-level block, after a blank line unless it is the first.
+func (w *hclWriter) topBlock(body any, scope blockScope, typ string, labels ...string) error {
+	if w.blocksWritten > 0 {
+		w.buf.WriteString("\n")
+	}
+	w.blocksWritten++
+	if err := w.block(0, typ, labels, body, scope); err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(append([]string{typ}, labels...), "."), err)
+	}
+	return nil
+}
+
+// block writes a block of typ with labels, body must be an object.
+func (w *hclWriter) block(depth int, typ string, labels []string, body any, scope blockScope) error {
+	attrs, ok := body.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s block must be an object, got %s", typ, formatJSON(body))
+	}
+	indent := strings.Repeat("  ", depth)
+	w.buf.WriteString(indent + typ)
+	for _, label := range labels {
+		w.buf.WriteString(" " + quote(label))
+	}
+	w.buf.WriteString(" {\n")
+	if err := w.body(depth+1, typ, attrs, scope); err != nil {
+		return err
+	}
+	w.buf.WriteString(indent + "}\n")
+	return nil
+}
+
+// body writes the attributes, then the nested blocks, of a block of typ.
+func (w *hclWriter) body(depth int, typ string, attrs map[string]any, scope blockScope) error {
+	indent := strings.Repeat("  ", depth)
+	var nested []string
+	for _, key := range sortedKeys(attrs) {
+		if key == MetadataKey {
+			continue
+		}
+		isBlock, err := w.isBlock(typ, key, attrs[key], scope)
+		if err != nil {
+			return err
+		}
+		if isBlock {
+			nested = append(nested, key)
+			continue
+		}
+		w.buf.WriteString(indent + attributeName(key) + " = ")
+		if isReference(typ, key) {
+			w.references(depth, attrs[key])
+		} else {
+			w.expression(depth, attrs[key])
+		}
+		w.buf.WriteString("\n")
+	}
+	for _, key := range nested {
+		if err := w.nestedBlocks(depth, typ, key, attrs[key], scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isBlock reports whether the key of a block of typ is a nested block.
+func (w *hclWriter) isBlock(typ, key string, value any, scope blockScope) (bool, error) {
+	switch typ {
+	case "terraform":
+		return key == "backend" || key == "cloud" || key == "required_providers", nil
+	case "cloud":
+		return key == "workspaces", nil
+	case "check":
+		return key == "data" || key == "assert", nil
+	case "dynamic":
+		return key == "content", nil
+	case "locals", "required_providers":
+		return false, nil
+	}
+	if scope.schema.nested(key) != nil {
+		// an empty list is no block
+		items, ok := value.([]any)
+		return isObject(value) || (ok && len(items) == 0), nil
+	}
+	if !isObject(value) {
+		return false, nil
+	}
+	switch {
+	case slices.Contains(w.blocks, key):
+		return true, nil
+	case scope.schema != nil || !scope.strict || key == "for_each" || slices.Contains(w.attributes, key):
+		return false, nil
+	}
+	return false, fmt.Errorf("%s may be a nested block or an attribute, set the provider schema or list it in the blocks or attributes", key)
+}
+
+// isObject reports whether value is an object or a non-empty list of objects.
+func isObject(value any) bool {
+	switch value := value.(type) {
+	case map[string]any:
+		return true
+	case []any:
+		for _, item := range value {
+			if _, ok := item.(map[string]any); !ok {
+				return false
+			}
+		}
+		return len(value) > 0
+	}
+	return false
+}
+
+// nestedScope returns the scope of the nested block key of a block of typ.
+func nestedScope(typ, key string, scope blockScope) blockScope {
+	switch {
+	case typ == "dynamic":
+		// the content of a dynamic block has the scope of the generated blocks
+		return scope
+	case scope.schema.nested(key) != nil:
+		return blockScope{schema: scope.schema.nested(key)}
+	case slices.Contains(metaBlocks, key):
+		return blockScope{}
+	}
+	return blockScope{strict: scope.strict}
+}
+
+// isReference reports whether the key of a block of typ holds references
+// or a type constraint, which are strings in JSON and bare in HCL.
+func isReference(typ, key string) bool {
+	switch key {
+	case "depends_on", "ignore_changes", "replace_triggered_by":
+		return true
+	case "type":
+		return typ == "variable"
+	case "provider":
+		return typ == "resource" || typ == "data" || typ == "import"
+	case "to":
+		return typ == "import" || typ == "moved"
+	case "from":
+		return typ == "moved" || typ == "removed"
+	}
+	return false
+}
+
+// references writes a string, or a list of strings, as bare expressions.
+func (w *hclWriter) references(depth int, value any) {
+	switch value := value.(type) {
+	case string:
+		w.buf.WriteString(strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(value, "${"), "}")))
+	case []any:
+		indent := strings.Repeat("  ", depth)
+		w.buf.WriteString("[\n")
+		for _, item := range value {
+			w.buf.WriteString(indent + "  ")
+			w.references(depth+1, item)
+			w.buf.WriteString(",\n")
+		}
+		w.buf.WriteString(indent + "]")
+	default:
+		w.expression(depth, value)
+	}
+}
+
+// nestedBlocks writes the blocks of key of a block of typ, labeled by their
+// keys for the backend, provisioner and dynamic blocks and by their type and
+// name for the data blocks of a check.
+func (w *hclWriter) nestedBlocks(depth int, typ, key string, value any, scope blockScope) error {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	if key == "data" {
+		for _, item := range items {
+			byType := asMap(item)
+			for _, dataType := range sortedKeys(byType) {
+				byName := asMap(byType[dataType])
+				for _, name := range sortedKeys(byName) {
+					if err := w.block(depth, key, []string{dataType, name}, byName[name], w.providerScope("data", dataType)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	labeled := key == "backend" || key == "provisioner" || key == "dynamic"
+	for _, item := range items {
+		if !labeled {
+			if err := w.block(depth, key, nil, item, nestedScope(typ, key, scope)); err != nil {
+				return err
+			}
+			continue
+		}
+		byLabel := asMap(item)
+		for _, label := range sortedKeys(byLabel) {
+			// a dynamic block generates the nested blocks of its label
+			labelScope := nestedScope(typ, key, scope)
+			if key == "dynamic" {
+				labelScope = nestedScope(typ, label, scope)
+			}
+			if err := w.block(depth, key, []string{label}, byLabel[label], labelScope); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expression writes a JSON value as an HCL expression.
+func (w *hclWriter) expression(depth int, value any) {
+	indent := strings.Repeat("  ", depth)
+	switch value := value.(type) {
+	case nil:
+		w.buf.WriteString("null")
+	case bool, json.Number:
+		fmt.Fprint(&w.buf, value)
+	case string:
+		w.buf.WriteString(templateExpression(value))
+	case []any:
+		if len(value) == 0 {
+			w.buf.WriteString("[]")
+			return
+		}
+		w.buf.WriteString("[\n")
+		for _, item := range value {
+			w.buf.WriteString(indent + "  ")
+			w.expression(depth+1, item)
+			w.buf.WriteString(",\n")
+		}
+		w.buf.WriteString(indent + "]")
+	case map[string]any:
+		keys := sortedKeys(value)
+		if i := slices.Index(keys, MetadataKey); i >= 0 {
+			keys = slices.Delete(keys, i, i+1)
+		}
+		if len(keys) == 0 {
+			w.buf.WriteString("{}")
+			return
+		}
+		w.buf.WriteString("{\n")
+		for _, key := range keys {
+			w.buf.WriteString(indent + "  " + objectKey(key) + " = ")
+			w.expression(depth+1, value[key])
+			w.buf.WriteString("\n")
+		}
+		w.buf.WriteString(indent + "}")
+	default:
+		fmt.Fprintf(&w.buf, "%q", fmt.Sprint(value))
+	}
+}
+
+// attributeName returns key, quoted if it is not an identifier.
+func attributeName(key string) string {
+	if identifier.MatchString(key) {
+		return key
+	}
+	return quote(key)
+}
+
+// objectKey returns the key of an object expression, quoted unless it is an identifier.
+func objectKey(key string) string {
+	if identifier.MatchString(key) && key != "null" && key != "true" && key != "false" {
+		return key
+	}
+	return quote(key)
+}
+
+// templateExpression returns a JSON string as an HCL expression: the
+// expression of a single interpolation, or a quoted template.
+func templateExpression(s string) string {
+	if strings.HasPrefix(s, "${") {
+		if end := templateEnd(s, 2); end == len(s)-1 {
+			return strings.TrimSpace(s[2:end])
+		}
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "$${") || strings.HasPrefix(s[i:], "%%{"):
+			// escaped template sequences are the same in both syntaxes
+			b.WriteString(s[i : i+3])
+			i += 2
+		case strings.HasPrefix(s[i:], "${") || strings.HasPrefix(s[i:], "%{"):
+			end := templateEnd(s, i+2)
+			if end < 0 {
+				// an unterminated sequence is kept as a literal
+				b.WriteString(s[i:i+1] + s[i:i+1] + "{")
+				i++
+				continue
+			}
+			// the expression is written as is, its strings need no escaping
+			b.WriteString(s[i : end+1])
+			i = end
+		default:
+			b.WriteString(escapeChar(s[i]))
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// templateEnd returns the index of the brace closing the template sequence
+// whose expression starts at start, -1 if there is none.
+func templateEnd(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			// skip a quoted string of the expression, it may hold braces
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// quote returns s as a quoted HCL string without template sequences.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "${") || strings.HasPrefix(s[i:], "%{") {
+			b.WriteString(s[i:i+1] + s[i:i+1])
+			continue
+		}
+		b.WriteString(escapeChar(s[i]))
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func escapeChar(c byte) string {
+	switch c {
+	case '"':
+		return `\"`
+	case '\\':
+		return `\\`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	}
+	if c < 0x20 {
+		return fmt.Sprintf(`\u%04x`, c)
+	}
+	return string(c)
+}
+
+func formatJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]any) []string {
+	return unionKeys(m, nil)
+}
@@ -0,0 +1,283 @@
+package tfjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToHCL(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		options HCLOptions
+		want    string
+		wantErr string
+	}{
+		{
+			name: "stack",
+			input: `{
+				"//": {"metadata": {"stackName": "dev"}},
+				"terraform": {
+					"backend": {"s3": {"bucket": "state", "key": "dev.tfstate"}},
+					"required_providers": {"aws": {"source": "hashicorp/aws", "version": "5.0.0"}}
+				},
+				"provider": {"aws": [{"region": "us-east-1"}, {"alias": "west", "region": "us-west-2"}]},
+				"variable": {"env": {"type": "string", "default": "dev"}},
+				"locals": {"prefix": "app-${var.env}"},
+				"data": {"aws_region": {"current": {}}},
+				"resource": {"aws_s3_bucket": {"b": {
+					"//": {"metadata": {"path": "dev/b"}},
+					"bucket": "${local.prefix}",
+					"count": 2,
+					"depends_on": ["data.aws_region.current"],
+					"tags": {"Name": "b", "team.name": "infra"},
+					"lifecycle": {"ignore_changes": ["tags"], "prevent_destroy": true}
+				}}},
+				"module": {"vpc": {"source": "./vpc", "cidr": "10.0.0.0/16"}},
+				"output": {"arn": {"value": "${aws_s3_bucket.b.arn}", "sensitive": false}}
+			}`,
+			want: `terraform {
+  backend "s3" {
+    bucket = "state"
+    key = "dev.tfstate"
+  }
+  required_providers {
+    aws = {
+      source = "hashicorp/aws"
+      version = "5.0.0"
+    }
+  }
+}
+
+provider "aws" {
+  region = "us-east-1"
+}
+
+provider "aws" {
+  alias = "west"
+  region = "us-west-2"
+}
+
+variable "env" {
+  default = "dev"
+  type = string
+}
+
+locals {
+  prefix = "app-${var.env}"
+}
+
+data "aws_region" "current" {
+}
+
+resource "aws_s3_bucket" "b" {
+  bucket = local.prefix
+  count = 2
+  depends_on = [
+    data.aws_region.current,
+  ]
+  tags = {
+    Name = "b"
+    "team.name" = "infra"
+  }
+  lifecycle {
+    ignore_changes = [
+      tags,
+    ]
+    prevent_destroy = true
+  }
+}
+
+module "vpc" {
+  cidr = "10.0.0.0/16"
+  source = "./vpc"
+}
+
+output "arn" {
+  sensitive = false
+  value = aws_s3_bucket.b.arn
+}
+`,
+		},
+		{
+			name:  "templates",
+			input: `{"locals": {"quoted": "say \"${lookup(var.m, \"k\", \"}\")}\"\n", "escaped": "$${literal}", "directive": "%{ if var.on }on%{ endif }", "unterminated": "${oops"}}`,
+			want: `locals {
+  directive = "%{ if var.on }on%{ endif }"
+  escaped = "$${literal}"
+  quoted = "say \"${lookup(var.m, "k", "}")}\"\n"
+  unterminated = "$${oops"
+}
+`,
+		},
+		{
+			name:    "nested blocks",
+			input:   `{"resource": {"aws_security_group": {"sg": {"ingress": [{"from_port": 80}, {"from_port": 443}], "egress": [{"from_port": 0}], "provisioner": [{"local-exec": {"command": "echo"}}]}}}}`,
+			options: HCLOptions{Blocks: []string{"ingress"}, Attributes: []string{"egress"}},
+			want: `resource "aws_security_group" "sg" {
+  egress = [
+    {
+      from_port = 0
+    },
+  ]
+  ingress {
+    from_port = 80
+  }
+  ingress {
+    from_port = 443
+  }
+  provisioner "local-exec" {
+    command = "echo"
+  }
+}
+`,
+		},
+		{name: "invalid", input: `{"a":`, wantErr: "invalid JSON"},
+		{
+			name: "refactoring and checks",
+			input: `{
+				"resource": {"aws_instance": {"b": {"provider": "aws.west", "ami": "ami-1"}}},
+				"moved": [{"from": "aws_instance.a", "to": "aws_instance.b"}],
+				"import": [{"to": "aws_instance.b", "id": "i-123", "provider": "aws.west"}],
+				"removed": [{"from": "aws_instance.old", "lifecycle": {"destroy": false}}],
+				"check": {"health": {
+					"data": {"http": {"site": {"url": "https://example.com"}}},
+					"assert": [{"condition": "${data.http.site.status_code == 200}", "error_message": "down"}]
+				}}
+			}`,
+			want: `resource "aws_instance" "b" {
+  ami = "ami-1"
+  provider = aws.west
+}
+
+check "health" {
+  assert {
+    condition = data.http.site.status_code == 200
+    error_message = "down"
+  }
+  data "http" "site" {
+    url = "https://example.com"
+  }
+}
+
+import {
+  id = "i-123"
+  provider = aws.west
+  to = aws_instance.b
+}
+
+moved {
+  from = aws_instance.a
+  to = aws_instance.b
+}
+
+removed {
+  from = aws_instance.old
+  lifecycle {
+    destroy = false
+  }
+}
+`,
+		},
+		{name: "unsupported block", input: `{"ephemeral": {}}`, wantErr: `unsupported top-level block "ephemeral"`},
+		{
+			name:    "ambiguous object",
+			input:   `{"resource": {"aws_security_group": {"sg": {"ingress": [{"from_port": 80}]}}}}`,
+			wantErr: "resource.aws_security_group.sg: ingress may be a nested block or an attribute",
+		},
+		{
+			name: "schema",
+			input: `{
+				"provider": {"aws": [{"region": "us-east-1", "default_tags": {"tags": {"team": "a"}}}]},
+				"resource": {"aws_security_group": {"sg": {
+					"ingress": [{"from_port": 80, "cidr_blocks": []}],
+					"egress": [],
+					"dynamic": {"ingress": {"for_each": {"a": 1}, "content": {"from_port": "${ingress.value}"}}}
+				}}},
+				"check": {"c": {"data": {"aws_ami": {"a": {"filter": [{"name": "n"}]}}}}}
+			}`,
+			options: HCLOptions{Schema: testSchema(t)},
+			want: `provider "aws" {
+  region = "us-east-1"
+  default_tags {
+    tags = {
+      team = "a"
+    }
+  }
+}
+
+resource "aws_security_group" "sg" {
+  dynamic "ingress" {
+    for_each = {
+      a = 1
+    }
+    content {
+      from_port = ingress.value
+    }
+  }
+  ingress {
+    cidr_blocks = []
+    from_port = 80
+  }
+}
+
+check "c" {
+  data "aws_ami" "a" {
+    filter {
+      name = "n"
+    }
+  }
+}
+`,
+		},
+		{name: "block not an object", input: `{"output": {"o": "x"}}`, wantErr: `output block must be an object, got "x"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ToHCL([]byte(tc.input), tc.options)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func testSchema(t *testing.T) *Schema {
+	t.Helper()
+	schema, err := ParseSchema([]byte(`{"format_version": "1.0", "provider_schemas": {"registry.terraform.io/hashicorp/aws": {
+		"provider": {"block": {"attributes": {"region": {}}, "block_types": {"default_tags": {"nesting_mode": "list", "block": {"attributes": {"tags": {}}}}}}},
+		"resource_schemas": {"aws_security_group": {"block": {"block_types": {
+			"ingress": {"nesting_mode": "set", "block": {"attributes": {"from_port": {}, "cidr_blocks": {}}}},
+			"egress": {"nesting_mode": "set", "block": {"attributes": {"from_port": {}}}}
+		}}}},
+		"data_source_schemas": {"aws_ami": {"block": {"block_types": {"filter": {"nesting_mode": "set", "block": {}}}}}}
+	}}}`))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestParseSchema(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "valid", input: `{"provider_schemas": {"registry.terraform.io/hashicorp/null": {"resource_schemas": {"null_resource": {"block": {}}}}}}`},
+		{name: "no providers", input: `{"format_version": "1.0"}`, wantErr: "no provider_schemas"},
+		{name: "invalid", input: `{`, wantErr: "invalid provider schemas"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseSchema([]byte(tc.input))
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
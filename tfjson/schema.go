@@ -0,0 +1,88 @@
+package tfjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+)
+
+// Schema holds the provider schemas printed by `terraform providers schema -json`,
+// used by ToHCL to tell the nested blocks from the attributes.
+type Schema struct {
+	// providers are keyed by local name, e.g. aws for registry.terraform.io/hashicorp/aws.
+	providers   map[string]*schemaBlock
+	resources   map[string]*schemaBlock
+	dataSources map[string]*schemaBlock
+}
+
+// schemaBlock is a block of the provider schemas, only its nested block types are used.
+type schemaBlock struct {
+	BlockTypes map[string]schemaBlockType `json:"block_types"`
+}
+
+type schemaBlockType struct {
+	Block *schemaBlock `json:"block"`
+}
+
+// ParseSchema parses the output of `terraform providers schema -json`.
+func ParseSchema(data []byte) (*Schema, error) {
+	var doc struct {
+		ProviderSchemas map[string]struct {
+			Provider          schemaBlockType            `json:"provider"`
+			ResourceSchemas   map[string]schemaBlockType `json:"resource_schemas"`
+			DataSourceSchemas map[string]schemaBlockType `json:"data_source_schemas"`
+		} `json:"provider_schemas"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid provider schemas: %w", err)
+	}
+	if len(doc.ProviderSchemas) == 0 {
+		return nil, errors.New("invalid provider schemas: no provider_schemas")
+	}
+	s := &Schema{
+		providers:   map[string]*schemaBlock{},
+		resources:   map[string]*schemaBlock{},
+		dataSources: map[string]*schemaBlock{},
+	}
+	for source, provider := range doc.ProviderSchemas {
+		if provider.Provider.Block != nil {
+			s.providers[path.Base(source)] = provider.Provider.Block
+		}
+		for typ, resource := range provider.ResourceSchemas {
+			if resource.Block != nil {
+				s.resources[typ] = resource.Block
+			}
+		}
+		for typ, data := range provider.DataSourceSchemas {
+			if data.Block != nil {
+				s.dataSources[typ] = data.Block
+			}
+		}
+	}
+	return s, nil
+}
+
+// block returns the schema of a provider, resource or data block, nil if it is unknown.
+func (s *Schema) block(kind, name string) *schemaBlock {
+	if s == nil {
+		return nil
+	}
+	switch kind {
+	case "provider":
+		return s.providers[name]
+	case "resource":
+		return s.resources[name]
+	case "data":
+		return s.dataSources[name]
+	}
+	return nil
+}
+
+// nested returns the schema of the nested block type name, nil if name is not a block.
+func (b *schemaBlock) nested(name string) *schemaBlock {
+	if b == nil {
+		return nil
+	}
+	return b.BlockTypes[name].Block
+}
@@ -0,0 +1,111 @@
+// Package tfjson normalizes the JSON files synthesized by CDKTF, e.g.
+// cdk.tf.json, so the same configuration gives the same bytes across
+// machines and runs, and compares, validates and converts them to HCL.
+package tfjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MetadataKey is the key of the CDKTF metadata blocks.
+const MetadataKey = "//"
+
+// WorkDirPlaceholder replaces the absolute path of the working directory.
+const WorkDirPlaceholder = "<workdir>"
+
+// Options configure Normalize.
+type Options struct {
+	// StripMetadata are the keys removed at any depth of the `//` metadata
+	// blocks, e.g. stackTrace.
+	StripMetadata []string
+	// Replace maps the strings found in the values to their replacement,
+	// e.g. an absolute path to WorkDirPlaceholder. Longer strings are replaced first.
+	Replace map[string]string
+}
+
+// Normalize returns data with the keys sorted, indented with two spaces and
+// the options applied. Numbers are kept as written.
+func Normalize(data []byte, options Options) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the top-level value")
+	}
+	n := normalizer{strip: options.StripMetadata, replacer: newReplacer(options.Replace)}
+	v = n.value(v, false)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// Terraform expressions often hold <, > and &
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+type normalizer struct {
+	strip    []string
+	replacer *strings.Replacer
+}
+
+// value normalizes v, inMetadata is set inside a `//` block.
+func (n normalizer) value(v any, inMetadata bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if inMetadata && slices.Contains(n.strip, key) {
+				delete(v, key)
+				continue
+			}
+			v[key] = n.value(child, inMetadata || key == MetadataKey)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = n.value(child, inMetadata)
+		}
+		return v
+	case string:
+		if n.replacer != nil {
+			return n.replacer.Replace(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// newReplacer returns a Replacer of the longest strings first, nil if there are none.
+func newReplacer(replace map[string]string) *strings.Replacer {
+	olds := make([]string, 0, len(replace))
+	for old := range replace {
+		if old != "" {
+			olds = append(olds, old)
+		}
+	}
+	if len(olds) == 0 {
+		return nil
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	pairs := make([]string, 0, 2*len(olds))
+	for _, old := range olds {
+		pairs = append(pairs, old, replace[old])
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,56 @@
+package tfjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		options Options
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "sorts keys and indents",
+			input: `{"b":1,"a":{"d":[1,2],"c":"x"}}`,
+			want:  "{\n  \"a\": {\n    \"c\": \"x\",\n    \"d\": [\n      1,\n      2\n    ]\n  },\n  \"b\": 1\n}\n",
+		},
+		{
+			name:  "keeps numbers and expressions as written",
+			input: `{"count":1.50,"big":12345678901234567890,"expr":"${a < b && c > d}"}`,
+			want:  "{\n  \"big\": 12345678901234567890,\n  \"count\": 1.50,\n  \"expr\": \"${a < b && c > d}\"\n}\n",
+		},
+		{
+			name:    "strips metadata keys",
+			input:   `{"//":{"metadata":{"path":"s/r","stackTrace":["at /tmp/x/main.ts:1"]}},"resource":{"r":{"//":{"stackTrace":[]},"stackTrace":"kept"}}}`,
+			options: Options{StripMetadata: []string{"stackTrace"}},
+			want:    "{\n  \"//\": {\n    \"metadata\": {\n      \"path\": \"s/r\"\n    }\n  },\n  \"resource\": {\n    \"r\": {\n      \"//\": {},\n      \"stackTrace\": \"kept\"\n    }\n  }\n}\n",
+		},
+		{
+			name:    "replaces the longest strings first",
+			input:   `{"source":"/tmp/work/cdktf.out/assets","other":"/tmp/elsewhere","env":"dev-123"}`,
+			options: Options{Replace: map[string]string{"/tmp": "<tmp>", "/tmp/work": WorkDirPlaceholder, "dev-123": "dev"}},
+			want:    "{\n  \"env\": \"dev\",\n  \"other\": \"<tmp>/elsewhere\",\n  \"source\": \"<workdir>/cdktf.out/assets\"\n}\n",
+		},
+		{name: "invalid", input: `{"a":`, wantErr: "invalid JSON"},
+		{name: "trailing data", input: `{} {}`, wantErr: "unexpected data after the top-level value"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Normalize([]byte(tc.input), tc.options)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, string(got))
+			again, err := Normalize(got, tc.options)
+			require.NoError(t, err)
+			require.Equal(t, string(got), string(again), "normalizing twice changes nothing")
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package tfjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severity tells whether a Diagnostic makes the configuration invalid.
+type Severity string
+
+const (
+	// SeverityError is a configuration Terraform rejects.
+	SeverityError Severity = "error"
+	// SeverityWarning is a configuration Terraform accepts which is likely a mistake.
+	SeverityWarning Severity = "warning"
+)
+
+// Code identifies the check reporting a Diagnostic.
+type Code string
+
+const (
+	// CodeInvalidJSON is a file which is not a JSON object.
+	CodeInvalidJSON Code = "invalid_json"
+	// CodeUnknownBlock is a top-level key Terraform does not know.
+	CodeUnknownBlock Code = "unknown_block"
+	// CodeInvalidBlock is a block which is not an object.
+	CodeInvalidBlock Code = "invalid_block"
+	// CodeDuplicateKey is a key repeated in an object, e.g. two resources with the same address.
+	CodeDuplicateKey Code = "duplicate_key"
+	// CodeInvalidName is a block name which is not an identifier.
+	CodeInvalidName Code = "invalid_name"
+	// CodeUnresolvedReference is a reference to a resource, data source,
+	// variable, local or module which is not declared.
+	CodeUnresolvedReference Code = "unresolved_reference"
+	// CodeUndeclaredProvider is a provider missing from the required_providers.
+	CodeUndeclaredProvider Code = "undeclared_provider"
+	// CodeUnknownProvider is a provider meta-argument without a matching provider block.
+	CodeUnknownProvider Code = "unknown_provider"
+)
+
+// Diagnostic is a finding of Validate.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     Code     `json:"code"`
+	// Stack is the name of the stack, empty for Validate.
+	Stack string `json:"stack,omitempty"`
+	// Address is the Terraform address of the object, e.g. aws_s3_bucket.b,
+	// or the JSON path of a duplicate key.
+	Address string `json:"address,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(string(d.Severity) + ": ")
+	if d.Stack != "" {
+		b.WriteString(d.Stack + ": ")
+	}
+	if d.Address != "" {
+		b.WriteString(d.Address + ": ")
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// Diagnostics are the findings of a validation.
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether a Diagnostic is an error.
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the errors joined, nil if there are none.
+func (d Diagnostics) Err() error {
+	var errs []error
+	for _, diag := range d {
+		if diag.Severity == SeverityError {
+			errs = append(errs, errors.New(diag.String()))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid Terraform JSON: %w", errors.Join(errs...))
+}
+
+// ValidateFiles checks the stacks of a cdktf.out tree, given by slash
+// separated path as for DiffFiles, see Validate.
+//
+// The diagnostics are sorted by stack.
+func ValidateFiles(files map[string][]byte) Diagnostics {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var diags Diagnostics
+	for _, name := range names {
+		match := stackPath.FindStringSubmatch(path.Clean(name))
+		if match == nil {
+			continue
+		}
+		for _, diag := range Validate(files[name]) {
+			diag.Stack = match[2]
+			diags = append(diags, diag)
+		}
+	}
+	return diags
+}
+
+// Validate checks the structure of a Terraform JSON configuration, e.g.
+// cdk.tf.json, without the providers:
+//
+//   - the top-level blocks are known and their objects unique and named by identifiers,
+//   - the references of the expressions, e.g. ${aws_vpc.x.id}, and of
+//     depends_on point to declared objects,
+//   - the provider blocks and the providers of the resource types are in the
+//     required_providers, and the provider meta-arguments match a provider block.
+func Validate(data []byte) Diagnostics {
+	v := &validator{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var config map[string]any
+	if err := decoder.Decode(&config); err != nil {
+		v.errorf(CodeInvalidJSON, "", "invalid JSON: %v", err)
+		return v.diags
+	}
+	v.duplicateKeys(data)
+	v.config(config)
+	return v.diags
+}
+
+type validator struct {
+	diags Diagnostics
+	// declared are the addresses which can be referenced, e.g. var.name.
+	declared map[string]bool
+	// resourceTypes are the declared resource types.
+	resourceTypes map[string]bool
+	// bound are the names of the for expressions and dynamic blocks.
+	bound map[string]bool
+}
+
+func (v *validator) errorf(code Code, address, format string, args ...any) {
+	v.diags = append(v.diags, Diagnostic{Severity: SeverityError, Code: code, Address: address, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(code Code, address, format string, args ...any) {
+	v.diags = append(v.diags, Diagnostic{Severity: SeverityWarning, Code: code, Address: address, Message: fmt.Sprintf(format, args...)})
+}
+
+// topLevelBlocks are the top-level keys of the Terraform JSON syntax.
+var topLevelBlocks = map[string]bool{
+	MetadataKey: true,
+	"terraform": true,
+	"provider":  true,
+	"variable":  true,
+	"locals":    true,
+	"data":      true,
+	"resource":  true,
+	"module":    true,
+	"output":    true,
+	"moved":     true,
+	"import":    true,
+	"removed":   true,
+	"check":     true,
+}
+
+// config runs the checks on the decoded configuration.
+func (v *validator) config(config map[string]any) {
+	for _, key := range sortedKeys(config) {
+		if !topLevelBlocks[key] {
+			v.errorf(CodeUnknownBlock, key, "unknown top-level block %q", key)
+		}
+	}
+	objects := v.declare(config)
+	v.providers(config)
+	for _, o := range objects {
+		v.references(o.address, o.body)
+	}
+}
+
+// declare records the declared objects, checking their names, and returns
+// the objects whose references are checked in order.
+func (v *validator) declare(config map[string]any) []object {
+	v.declared = map[string]bool{}
+	v.resourceTypes = map[string]bool{}
+	v.bound = map[string]bool{}
+	var objects []object
+	for _, kind := range []string{"data", "resource"} {
+		byType, ok := v.objectBlock(config, kind, kind)
+		if !ok {
+			continue
+		}
+		for _, typ := range sortedKeys(byType) {
+			byName, ok := v.objectBlock(byType, typ, kind+"."+typ)
+			if !ok {
+				continue
+			}
+			for _, name := range sortedKeys(byName) {
+				address := typ + "." + name
+				if kind == "data" {
+					address = "data." + address
+				} else {
+					v.resourceTypes[typ] = true
+				}
+				if v.checkName(address, name) {
+					v.declared[address] = true
+				}
+				if _, ok := v.objectBlock(byName, name, address); ok {
+					objects = append(objects, object{kind: Kind(kind), address: address, body: byName[name]})
+				}
+			}
+		}
+	}
+	for _, kind := range []string{"variable", "locals", "module", "output", "provider"} {
+		byName, ok := v.objectBlock(config, kind, kind)
+		if !ok {
+			continue
+		}
+		prefix := map[string]string{"variable": "var.", "locals": "local.", "module": "module.", "output": "output.", "provider": "provider."}[kind]
+		for _, name := range sortedKeys(byName) {
+			address := prefix + name
+			if v.checkName(address, name) && kind != "output" && kind != "provider" {
+				v.declared[address] = true
+			}
+			objects = append(objects, object{kind: Kind(kind), address: address, body: byName[name]})
+		}
+	}
+	return objects
+}
+
+// objectBlock returns parent[key] if it is an object, reporting it otherwise.
+func (v *validator) objectBlock(parent map[string]any, key, address string) (map[string]any, bool) {
+	value, ok := parent[key]
+	if !ok {
+		return nil, false
+	}
+	block, ok := value.(map[string]any)
+	if !ok {
+		v.errorf(CodeInvalidBlock, address, "must be an object, got %s", formatJSON(value))
+	}
+	return block, ok
+}
+
+// checkName reports a name which is not an identifier.
+func (v *validator) checkName(address, name string) bool {
+	if identifier.MatchString(name) {
+		return true
+	}
+	v.errorf(CodeInvalidName, address, "invalid name %q, names must start with a letter or underscore and hold letters, digits, underscores and dashes", name)
+	return false
+}
+
+// builtinProvider is the provider of terraform_data and terraform_remote_state.
+const builtinProvider = "terraform"
+
+// providers checks the provider blocks and meta-arguments against the required_providers.
+func (v *validator) providers(config map[string]any) {
+	required := asMap(asMap(config["terraform"])["required_providers"])
+	requiredOrBuiltin := func(name string) bool {
+		_, ok := required[name]
+		return ok || name == builtinProvider
+	}
+	configured := map[string]bool{}
+	providers := asMap(config["provider"])
+	for _, name := range sortedKeys(providers) {
+		if !requiredOrBuiltin(name) {
+			v.errorf(CodeUndeclaredProvider, "provider."+name, "provider %q is not in the required_providers", name)
+		}
+		configured[name] = true
+		configs, ok := providers[name].([]any)
+		if !ok {
+			configs = []any{providers[name]}
+		}
+		for _, c := range configs {
+			if alias, ok := asMap(c)["alias"].(string); ok && alias != "" {
+				configured[name+"."+alias] = true
+			}
+		}
+	}
+	for _, kind := range []string{"data", "resource"} {
+		byType := asMap(config[kind])
+		for _, typ := range sortedKeys(byType) {
+			byName := asMap(byType[typ])
+			for _, name := range sortedKeys(byName) {
+				address := typ + "." + name
+				if kind == "data" {
+					address = "data." + address
+				}
+				if ref, ok := asMap(byName[name])["provider"].(string); ok {
+					ref = bareReference(ref)
+					local, _, _ := strings.Cut(ref, ".")
+					if !configured[ref] && (strings.Contains(ref, ".") || !requiredOrBuiltin(local)) {
+						v.errorf(CodeUnknownProvider, address, "provider %q has no provider block", ref)
+					}
+					continue
+				}
+				// a resource type is prefixed by the local name of its provider
+				local, _, _ := strings.Cut(typ, "_")
+				if !requiredOrBuiltin(local) && !configured[local] {
+					v.warnf(CodeUndeclaredProvider, address, "provider %q of %s is not in the required_providers", local, typ)
+				}
+			}
+		}
+	}
+}
+
+// duplicateKeys reports the keys repeated in an object, which encoding/json
+// silently merges.
+func (v *validator) duplicateKeys(data []byte) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// the document was decoded already, only the duplicates are reported
+	_ = v.walkTokens(decoder, "")
+}
+
+func (v *validator) walkTokens(decoder *json.Decoder, p string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		seen := map[string]bool{}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := token.(string)
+			child := joinKey(p, key)
+			if seen[key] {
+				v.errorf(CodeDuplicateKey, child, "duplicate key %q", key)
+			}
+			seen[key] = true
+			if err := v.walkTokens(decoder, child); err != nil {
+				return err
+			}
+		}
+		_, err = decoder.Token()
+	case json.Delim('['):
+		for i := 0; decoder.More(); i++ {
+			if err := v.walkTokens(decoder, p+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		_, err = decoder.Token()
+	}
+	return err
+}
+
+// references checks the references of the expressions of an object.
+func (v *validator) references(address string, body any) {
+	switch body := body.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(body) {
+			switch key {
+			case MetadataKey:
+				continue
+			case "depends_on":
+				// references written without ${}
+				list, _ := body[key].([]any)
+				for _, item := range list {
+					if s, ok := item.(string); ok {
+						v.expression(address, bareReference(s))
+					}
+				}
+				continue
+			case "dynamic":
+				// the dynamic blocks are iterated by their label, or their iterator
+				for label, block := range asMap(body[key]) {
+					v.bound[label] = true
+					if iterator, ok := asMap(block)["iterator"].(string); ok {
+						v.bound[iterator] = true
+					}
+				}
+			}
+			v.references(address, body[key])
+		}
+	case []any:
+		for _, item := range body {
+			v.references(address, item)
+		}
+	case string:
+		for i := 0; i < len(body); i++ {
+			if strings.HasPrefix(body[i:], "$${") || strings.HasPrefix(body[i:], "%%{") {
+				i += 2
+				continue
+			}
+			if !strings.HasPrefix(body[i:], "${") && !strings.HasPrefix(body[i:], "%{") {
+				continue
+			}
+			end := templateEnd(body, i+2)
+			if end < 0 {
+				return
+			}
+			v.expression(address, body[i+2:end])
+			i = end
+		}
+	}
+}
+
+var (
+	// traversal matches the references of an expression, without its strings.
+	traversal = regexp.MustCompile(`(^|[^\w.-])([A-Za-z_][\w-]*)((?:\.[A-Za-z_][\w-]*)+)`)
+	// forNames matches the names bound by a for expression.
+	forNames = regexp.MustCompile(`\bfor\s+([A-Za-z_][\w-]*)(?:\s*,\s*([A-Za-z_][\w-]*))?\s+in\b`)
+	// quoted matches a quoted string of an expression.
+	quoted = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+// expression checks the references of an expression, e.g. aws_vpc.x.id.
+func (v *validator) expression(address, expr string) {
+	expr = quoted.ReplaceAllString(expr, `""`)
+	bound := map[string]bool{}
+	for _, match := range forNames.FindAllStringSubmatch(expr, -1) {
+		bound[match[1]], bound[match[2]] = true, true
+	}
+	for _, match := range traversal.FindAllStringSubmatch(expr, -1) {
+		root, parts := match[2], strings.Split(match[3][1:], ".")
+		if bound[root] || v.bound[root] {
+			continue
+		}
+		var ref string
+		switch root {
+		case "var", "local", "module":
+			ref = root + "." + parts[0]
+		case "data":
+			if len(parts) < 2 {
+				v.errorf(CodeUnresolvedReference, address, "reference to data.%s has no name", parts[0])
+				continue
+			}
+			ref = "data." + parts[0] + "." + parts[1]
+		case "count", "each", "self", "path", "terraform", "ephemeral":
+			continue
+		default:
+			// a resource type is prefixed by its provider, other names are
+			// attributes of object expressions or block iterators
+			if !strings.Contains(root, "_") && !v.resourceTypes[root] {
+				continue
+			}
+			ref = root + "." + parts[0]
+		}
+		if !v.declared[ref] {
+			v.errorf(CodeUnresolvedReference, address, "reference to undeclared %s", ref)
+		}
+	}
+}
+
+// bareReference returns a reference without its ${}, e.g. aws.west for "${aws.west}".
+func bareReference(s string) string {
+	if strings.HasPrefix(s, "${") && strings.HasSuffix(s, "}") {
+		s = s[2 : len(s)-1]
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,121 @@
+package tfjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  Diagnostics
+	}{
+		{
+			name: "valid",
+			input: `{
+				"//": {"metadata": {"stackName": "dev"}},
+				"terraform": {"required_providers": {"aws": {"source": "hashicorp/aws"}}},
+				"provider": {"aws": [{"region": "us-east-1"}, {"alias": "west", "region": "us-west-2"}]},
+				"variable": {"cidr": {"type": "string"}},
+				"locals": {"tags": {"Name": "${var.cidr}"}},
+				"data": {"aws_region": {"current": {"provider": "aws.west"}}},
+				"resource": {
+					"aws_vpc": {"x": {"cidr_block": "${var.cidr}", "tags": "${local.tags}", "depends_on": ["data.aws_region.current"]}},
+					"aws_subnet": {"s": {
+						"count": 2,
+						"vpc_id": "${aws_vpc.x.id}",
+						"cidr_block": "${cidrsubnet(aws_vpc.x.cidr_block, 8, count.index)}",
+						"tags": "${{ for k, v in local.tags : k => \"${v}.aws_fake.name\" }}",
+						"dynamic": {"route": {"for_each": "${var.cidr}", "content": {"cidr": "${route.value}"}}}
+					}},
+					"terraform_data": {"d": {"input": "$${aws_missing.x.id} ${module.net.id}"}}
+				},
+				"module": {"net": {"source": "./net"}},
+				"output": {"ids": {"value": "${[for s in aws_subnet.s : s.id]}"}}
+			}`,
+		},
+		{
+			name:  "invalid JSON",
+			input: `{"resource":`,
+			want:  Diagnostics{{Severity: SeverityError, Code: CodeInvalidJSON, Message: "invalid JSON: unexpected EOF"}},
+		},
+		{
+			name:  "unknown and invalid blocks",
+			input: `{"resources": {}, "variable": [], "resource": {"aws_vpc": {"bad name": {}, "y": "x"}}, "terraform": {"required_providers": {"aws": {}}}}`,
+			want: Diagnostics{
+				{Severity: SeverityError, Code: CodeUnknownBlock, Address: "resources", Message: `unknown top-level block "resources"`},
+				{Severity: SeverityError, Code: CodeInvalidName, Address: "aws_vpc.bad name", Message: `invalid name "bad name", names must start with a letter or underscore and hold letters, digits, underscores and dashes`},
+				{Severity: SeverityError, Code: CodeInvalidBlock, Address: "aws_vpc.y", Message: `must be an object, got "x"`},
+				{Severity: SeverityError, Code: CodeInvalidBlock, Address: "variable", Message: "must be an object, got []"},
+			},
+		},
+		{
+			name:  "duplicate addresses",
+			input: `{"resource": {"null_resource": {"r": {}, "r": {}}}, "terraform": {"required_providers": {"null": {}}}}`,
+			want:  Diagnostics{{Severity: SeverityError, Code: CodeDuplicateKey, Address: "resource.null_resource.r", Message: `duplicate key "r"`}},
+		},
+		{
+			name: "unresolved references",
+			input: `{
+				"terraform": {"required_providers": {"aws": {}}},
+				"resource": {"aws_subnet": {"s": {
+					"vpc_id": "${aws_vpc.x.id}",
+					"name": "subnet-${var.name}-${local.suffix}",
+					"region": "${data.aws_region}",
+					"depends_on": ["module.net"]
+				}}}
+			}`,
+			want: Diagnostics{
+				{Severity: SeverityError, Code: CodeUnresolvedReference, Address: "aws_subnet.s", Message: "reference to undeclared module.net"},
+				{Severity: SeverityError, Code: CodeUnresolvedReference, Address: "aws_subnet.s", Message: "reference to undeclared var.name"},
+				{Severity: SeverityError, Code: CodeUnresolvedReference, Address: "aws_subnet.s", Message: "reference to undeclared local.suffix"},
+				{Severity: SeverityError, Code: CodeUnresolvedReference, Address: "aws_subnet.s", Message: "reference to data.aws_region has no name"},
+				{Severity: SeverityError, Code: CodeUnresolvedReference, Address: "aws_subnet.s", Message: "reference to undeclared aws_vpc.x"},
+			},
+		},
+		{
+			name: "providers",
+			input: `{
+				"terraform": {"required_providers": {"aws": {}}},
+				"provider": {"google": [{}]},
+				"resource": {
+					"aws_vpc": {"x": {"provider": "${aws.east}"}},
+					"google_bucket": {"b": {}},
+					"random_id": {"r": {}}
+				}
+			}`,
+			want: Diagnostics{
+				{Severity: SeverityError, Code: CodeUndeclaredProvider, Address: "provider.google", Message: `provider "google" is not in the required_providers`},
+				{Severity: SeverityError, Code: CodeUnknownProvider, Address: "aws_vpc.x", Message: `provider "aws.east" has no provider block`},
+				{Severity: SeverityWarning, Code: CodeUndeclaredProvider, Address: "random_id.r", Message: `provider "random" of random_id is not in the required_providers`},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Validate([]byte(tc.input))
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	diags := ValidateFiles(map[string][]byte{
+		"stacks/b/cdk.tf.json": []byte(`{"output": {"o": {"value": "${var.missing}"}}}`),
+		"stacks/a/cdk.tf.json": []byte(`{"unknown": {}}`),
+		"manifest.json":        []byte(`{"unknown": {}}`),
+	})
+	require.Equal(t, Diagnostics{
+		{Severity: SeverityError, Code: CodeUnknownBlock, Stack: "a", Address: "unknown", Message: `unknown top-level block "unknown"`},
+		{Severity: SeverityError, Code: CodeUnresolvedReference, Stack: "b", Address: "output.o", Message: "reference to undeclared var.missing"},
+	}, diags)
+	require.True(t, diags.HasErrors())
+	require.EqualError(t, diags.Err(), "invalid Terraform JSON: error: a: unknown: unknown top-level block \"unknown\"\n"+
+		"error: b: output.o: reference to undeclared var.missing")
+
+	warnings := Diagnostics{{Severity: SeverityWarning, Message: "w"}}
+	require.False(t, warnings.HasErrors())
+	require.NoError(t, warnings.Err())
+}
@@ -0,0 +1,31 @@
+package synth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/environment-toolkit/go-synth/archive"
+	"github.com/environment-toolkit/go-synth/models"
+	"github.com/environment-toolkit/go-synth/tfjson"
+	"github.com/spf13/afero"
+)
+
+// validatedFiles select the stacks of the src directory of an Eval.
+var validatedFiles = models.CopyOptions{
+	IgnorePatterns: []string{"*"},
+	AllowPatterns:  []string{"stacks/*/cdk.tf.json"},
+}
+
+// validateSource validates the Terraform JSON stacks of the executor src
+// directory, before they are copied, normalized or converted to HCL.
+func validateSource(ctx context.Context, e models.Executor, src string) (tfjson.Diagnostics, error) {
+	fs := afero.NewMemMapFs()
+	if _, err := e.CopyTo(ctx, src, fs, "src", validatedFiles); err != nil {
+		return nil, fmt.Errorf("error reading stacks to validate: %w", err)
+	}
+	files, err := archive.ReadFiles(fs, "src")
+	if err != nil {
+		return nil, fmt.Errorf("error reading stacks to validate: %w", err)
+	}
+	return tfjson.ValidateFiles(files), nil
+}